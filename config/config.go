@@ -1,7 +1,13 @@
 package config
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -9,9 +15,14 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Export   ExportConfig
+	OAuth    OAuthConfig
+	Badges   []BadgeConfig
+	XP       XPConfig
 }
 
 type ServerConfig struct {
+	Env             string
 	Port            string
 	Log             string
 	Counter         int
@@ -26,15 +37,97 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret string
-	Expiry time.Duration
+	// HS256, the default, signs with Secret; RS256 and EdDSA are opt-in and
+	// use rotating key pairs that are published at /.well-known/jwks.json.
+	Algorithm       string
+	Secret          string
+	Issuer          string
+	Audience        string
+	Expiry          time.Duration
+	ChallengeExpiry time.Duration
+	TOTPIssuer      string
+	// A new key is created every RotationInterval and published
+	// PrepublishLead before it starts signing, so verifiers can pick it up.
+	RotationInterval time.Duration
+	PrepublishLead   time.Duration
+	// Encrypts the private signing keys stored in the database. 32 bytes,
+	// base64 encoded in JWT_KEY_ENCRYPTION_KEY.
+	KeyEncryptionKey []byte
 }
 
+type ExportConfig struct {
+	Dir        string
+	LinkExpiry time.Duration
+}
+
+type OAuthConfig struct {
+	Providers   []OAuthProviderConfig
+	StateExpiry time.Duration
+}
+
+// OAuthProviderConfig describes an OpenID Connect provider. Providers are
+// listed in OAUTH_PROVIDERS and configured with OAUTH_<NAME>_* variables.
+type OAuthProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// BadgeConfig defines an achievement a member earns in a club once the rule
+// reaches the threshold. Rules are checkins (total check-ins), streak
+// (longest streak in days), score and rank (place on the leaderboard, at or
+// above the threshold).
+type BadgeConfig struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Rule        string `json:"rule"`
+	Threshold   int    `json:"threshold"`
+}
+
+// XPConfig sets how check-ins earn XP and how much XP each level needs. The
+// first check-in of the day in a club earns PerCheckIn; every further one
+// that day in the same club earns DailyDecay times the one before. Reaching
+// level 2 takes LevelBase XP and every level after needs LevelGrowth times
+// more than the previous one.
+type XPConfig struct {
+	PerCheckIn  int
+	DailyDecay  float64
+	LevelBase   int
+	LevelGrowth float64
+}
+
+var defaultBadges = []BadgeConfig{
+	{Key: "first_checkin", Name: "First Step", Description: "Checked in for the first time", Rule: "checkins", Threshold: 1},
+	{Key: "checkins_100", Name: "Centurion", Description: "Checked in 100 times", Rule: "checkins", Threshold: 100},
+	{Key: "streak_7", Name: "On a Roll", Description: "Checked in 7 days in a row", Rule: "streak", Threshold: 7},
+	{Key: "streak_30", Name: "Habit Formed", Description: "Checked in 30 days in a row", Rule: "streak", Threshold: 30},
+	{Key: "streak_100", Name: "Unstoppable", Description: "Checked in 100 days in a row", Rule: "streak", Threshold: 100},
+	{Key: "rank_1", Name: "Top of the Club", Description: "Reached first place on the leaderboard", Rule: "rank", Threshold: 1},
+}
+
+// Everything but dev is treated as production. Dev mode has to be asked for
+// with APP_ENV=dev, so a deployment that forgets APP_ENV doesn't run with
+// dev secrets.
+const (
+	EnvDev           = "dev"
+	EnvProduction    = "production"
+	defaultJWTSecret = "dev-secret"
+)
+
 var AppConfig Config
 
+// loadErr holds the first setting Load could not read, until Validate
+// reports it.
+var loadErr error
+
 func Load() {
 	AppConfig = Config{
 		Server: ServerConfig{
+			Env:             getEnv("APP_ENV", EnvProduction),
 			Port:            getEnv("SERVER_PORT", "8080"),
 			Log:             getEnv("LOG_LEVEL", "info"),
 			Counter:         1,
@@ -45,15 +138,184 @@ func Load() {
 			DSN:    getEnv("DB_DSN", "klubranks.db"),
 		},
 		JWT: JWTConfig{
-			Secret: getEnv("JWT_SECRET", "dev-secret"),
-			Expiry: 48 * time.Hour,
+			Algorithm:        getEnv("JWT_ALGORITHM", "HS256"),
+			Secret:           getEnv("JWT_SECRET", defaultJWTSecret),
+			Issuer:           getEnv("JWT_ISSUER", "klubranks"),
+			Audience:         getEnv("JWT_AUDIENCE", "klubranks-api"),
+			Expiry:           48 * time.Hour,
+			ChallengeExpiry:  5 * time.Minute,
+			TOTPIssuer:       getEnv("TOTP_ISSUER", "KlubRanks"),
+			RotationInterval: 30 * 24 * time.Hour,
+			PrepublishLead:   24 * time.Hour,
+		},
+		Export: ExportConfig{
+			Dir:        getEnv("EXPORT_DIR", "exports"),
+			LinkExpiry: 24 * time.Hour,
 		},
+		OAuth: OAuthConfig{
+			Providers:   loadOAuthProviders(),
+			StateExpiry: 10 * time.Minute,
+		},
+	}
+	var err error
+	if AppConfig.JWT.KeyEncryptionKey, err = loadKeyEncryptionKey(getEnv("JWT_KEY_ENCRYPTION_KEY", "")); err != nil {
+		setLoadErr("JWT_KEY_ENCRYPTION_KEY", err)
+	}
+	if AppConfig.Badges, err = loadBadges(getEnv("BADGES_FILE", "")); err != nil {
+		setLoadErr("BADGES_FILE", err)
+	}
+	AppConfig.XP = XPConfig{
+		PerCheckIn:  getEnvInt("XP_PER_CHECKIN", 10),
+		DailyDecay:  getEnvFloat("XP_DAILY_DECAY", 0.5),
+		LevelBase:   getEnvInt("XP_LEVEL_BASE", 100),
+		LevelGrowth: getEnvFloat("XP_LEVEL_GROWTH", 1.5),
 	}
 }
 
+// Validate reports configuration that is unsafe to run with.
+func Validate() error {
+	switch AppConfig.JWT.Algorithm {
+	case "HS256", "RS256", "EdDSA":
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %q", AppConfig.JWT.Algorithm)
+	}
+
+	if AppConfig.Server.Env != EnvDev && AppConfig.JWT.Algorithm == "HS256" && AppConfig.JWT.Secret == defaultJWTSecret {
+		return errors.New("JWT_SECRET must be set outside dev mode")
+	}
+
+	if loadErr != nil {
+		return loadErr
+	}
+	if AppConfig.Server.Env != EnvDev && AppConfig.JWT.Algorithm != "HS256" && AppConfig.JWT.KeyEncryptionKey == nil {
+		return errors.New("JWT_KEY_ENCRYPTION_KEY must be set outside dev mode")
+	}
+
+	keys := make(map[string]bool)
+	for _, badge := range AppConfig.Badges {
+		switch {
+		case badge.Key == "" || badge.Name == "":
+			return errors.New("badges need a key and a name")
+		case keys[badge.Key]:
+			return fmt.Errorf("duplicate badge key %q", badge.Key)
+		case badge.Threshold < 1:
+			return fmt.Errorf("badge %q needs a positive threshold", badge.Key)
+		}
+		switch badge.Rule {
+		case "checkins", "streak", "score", "rank":
+		default:
+			return fmt.Errorf("badge %q has unsupported rule %q", badge.Key, badge.Rule)
+		}
+		keys[badge.Key] = true
+	}
+
+	xp := AppConfig.XP
+	switch {
+	case xp.PerCheckIn < 0:
+		return errors.New("XP_PER_CHECKIN must not be negative")
+	case xp.DailyDecay < 0 || xp.DailyDecay > 1:
+		return errors.New("XP_DAILY_DECAY must be between 0 and 1")
+	case xp.LevelBase < 1:
+		return errors.New("XP_LEVEL_BASE must be positive")
+	case xp.LevelGrowth < 1:
+		return errors.New("XP_LEVEL_GROWTH must be at least 1")
+	}
+
+	return nil
+}
+
+// loadKeyEncryptionKey decodes a base64 AES-256 key, or returns nil when
+// none is set.
+func loadKeyEncryptionKey(encoded string) ([]byte, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// loadBadges reads badge definitions from a JSON array in path, or returns
+// the built-in set when path is empty.
+func loadBadges(path string) ([]BadgeConfig, error) {
+	if path == "" {
+		return defaultBadges, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var badges []BadgeConfig
+	if err := json.Unmarshal(data, &badges); err != nil {
+		return nil, err
+	}
+	return badges, nil
+}
+
+func loadOAuthProviders() []OAuthProviderConfig {
+	var providers []OAuthProviderConfig
+
+	for _, name := range strings.Split(getEnv("OAUTH_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+
+		providers = append(providers, OAuthProviderConfig{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid profile email")),
+		})
+	}
+
+	return providers
+}
+
 func getEnv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		setLoadErr(key, err)
+		return fallback
+	}
+	return n
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		setLoadErr(key, err)
+		return fallback
+	}
+	return f
+}
+
+func setLoadErr(key string, err error) {
+	if loadErr == nil {
+		loadErr = fmt.Errorf("%s: %w", key, err)
+	}
+}
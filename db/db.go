@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"klubRanks/config"
 	"log"
 	"time"
@@ -54,6 +55,16 @@ func InitDB() {
 
 }
 
+// IsUniqueViolation reports whether err is the driver's error for a
+// duplicate key in a unique index.
+func IsUniqueViolation(err error) bool {
+	translator, ok := DB.Dialector.(gorm.ErrorTranslator)
+	if !ok {
+		return false
+	}
+	return errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey)
+}
+
 // func createTables(driver string) error {
 // 	stmts := []string{}
 
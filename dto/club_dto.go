@@ -5,10 +5,13 @@ import "time"
 /*************** REQUEST DTOs ***************/
 
 type CreateClubRequest struct {
-	Name        string  `json:"name" binding:"required"`
-	Description *string `json:"description,omitempty"`
-	IsPrivate   bool    `json:"is_private"`
-	Action      string  `json:"action" binding:"required"`
+	Name        string   `json:"name" binding:"required"`
+	Description *string  `json:"description,omitempty"`
+	IsPrivate   bool     `json:"is_private"`
+	Action      string   `json:"action" binding:"required"`
+	Tags        []string `json:"tags,omitempty" example:"running,morning"`
+	// Omit for no limit.
+	MaxMembers *int `json:"max_members,omitempty" example:"50"`
 }
 
 type UpdateClubRequest struct {
@@ -16,6 +19,90 @@ type UpdateClubRequest struct {
 	Description *string `json:"description,omitempty"`
 	IsPrivate   bool    `json:"is_private"`
 	Action      string  `json:"action"`
+	// Omit to keep the current tags.
+	Tags []string `json:"tags,omitempty" example:"running,morning"`
+	// Omit to keep the current limit, 0 to remove it.
+	MaxMembers *int `json:"max_members,omitempty" example:"50"`
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required" example:"moderator" enums:"admin,moderator,member"`
+}
+
+type CreateClubInviteRequest struct {
+	// Role granted on join, defaults to member.
+	Role *string `json:"role,omitempty" example:"member" enums:"admin,moderator,member"`
+	// Omit for unlimited uses.
+	MaxUses *int `json:"max_uses,omitempty" example:"10"`
+	// Omit for an invite that never expires.
+	ExpiresInHours *int `json:"expires_in_hours,omitempty" example:"72"`
+}
+
+type InviteUserRequest struct {
+	Username string `json:"username" binding:"required" example:"john"`
+}
+
+type DeleteClubRequest struct {
+	// Must repeat the club name exactly.
+	Confirm string `json:"confirm" binding:"required" example:"Morning Runners"`
+}
+
+type TransferOwnershipRequest struct {
+	UserID uint `json:"user_id" binding:"required" example:"42"`
+}
+
+type BanMemberRequest struct {
+	Reason *string `json:"reason,omitempty" example:"spamming the chat"`
+	// Omit for a permanent ban.
+	ExpiresInDays *int `json:"expires_in_days,omitempty" example:"7"`
+}
+
+// ClubActionRequest creates or replaces a club action.
+type ClubActionRequest struct {
+	Name string `json:"name" binding:"required" example:"running"`
+	Unit string `json:"unit,omitempty" example:"km"`
+	// Points per unit on the combined leaderboard, for check-ins from now on.
+	// Defaults to 1.
+	Points *int `json:"points,omitempty" example:"2"`
+	// Minimum time between check-ins of this action per member.
+	CooldownMinutes int `json:"cooldown_minutes,omitempty" example:"60"`
+}
+
+type TeamRequest struct {
+	Name string `json:"name" binding:"required" example:"Marketing"`
+}
+
+type AssignTeamRequest struct {
+	// Omit or null to take the member out of their team.
+	TeamID *uint `json:"team_id" example:"3"`
+}
+
+type TeamSettingsRequest struct {
+	// Let members join and leave teams themselves.
+	SelfSelect bool   `json:"self_select"`
+	Scoring    string `json:"scoring" binding:"required" example:"top" enums:"sum,average,top"`
+	// How many of a team's best scores count with top scoring.
+	TopN *int `json:"top_n,omitempty" example:"5"`
+}
+
+type CreateChallengeRequest struct {
+	OpponentClubID uint      `json:"opponent_club_id" binding:"required" example:"7"`
+	Metric         string    `json:"metric" binding:"required" example:"total_checkins" enums:"total_checkins,average_per_member"`
+	StartsAt       time.Time `json:"starts_at" binding:"required"`
+	EndsAt         time.Time `json:"ends_at" binding:"required"`
+}
+
+type CreateDuelRequest struct {
+	OpponentID uint `json:"opponent_id" binding:"required" example:"42"`
+	// How long the duel runs once accepted. Defaults to 7.
+	Days *int `json:"days,omitempty" example:"7"`
+}
+
+type GoalRequest struct {
+	Period string `json:"period" binding:"required" enums:"day,week,month" example:"month"`
+	Target int    `json:"target" example:"30"`
+	// Share the goal and its completion with the club.
+	Visible bool `json:"visible" example:"true"`
 }
 
 /*************** RESPONSE DTOs ***************/
@@ -26,18 +113,26 @@ type ClubResponse struct {
 	Description     *string    `json:"description,omitempty"`
 	Code            string     `json:"code"`
 	Action          string     `json:"action"`
+	Tags            []string   `json:"tags"`
 	IsPrivate       bool       `json:"is_private"`
 	NumberOfMembers int        `json:"number_of_members"`
+	MaxMembers      *int       `json:"max_members,omitempty"`
 	CurrentRank     int        `json:"current_rank"`
 	LastCheckedIn   *time.Time `json:"last_checkedin,omitempty"`
-	NextCheckIn     *time.Time `json:"next_checkin,omitempty"`
 	CreatedBy       uint       `json:"created_by"`
 	CreatedAt       time.Time  `json:"created_at"`
+	ArchivedAt      *time.Time `json:"archived_at,omitempty"`
+	// The user's goals in the club, only when listing their clubs.
+	Goals []GoalResponse `json:"goals,omitempty"`
+	// The user's totals and next check-in per action, only when listing
+	// their clubs. Cooldowns are per action.
+	Actions []ActionStats `json:"actions,omitempty"`
 }
 
 type MemberResponse struct {
 	User     User      `json:"user"`
 	Role     string    `json:"role"`
+	TeamID   *uint     `json:"team_id,omitempty"`
 	JoinedAt time.Time `json:"joined_at"`
 }
 
@@ -60,4 +155,173 @@ type UserStats struct {
 	Rank          int        `json:"rank"`
 
 	GraphData []GraphDataPoint `json:"graph_data"`
+
+	Actions []ActionStats   `json:"actions"`
+	Duels   DuelRecord      `json:"duels"`
+	Badges  []BadgeResponse `json:"badges"`
+	// Hidden goals are only included in the user's own stats.
+	Goals []GoalResponse `json:"goals"`
+}
+
+// ActionStats is a member's total for one of the club's actions.
+type ActionStats struct {
+	Action        ClubActionResponse `json:"action"`
+	Amount        int                `json:"amount"`
+	Points        int                `json:"points"`
+	LastCheckedIn *time.Time         `json:"last_checkedin,omitempty"`
+	NextCheckIn   *time.Time         `json:"next_checkin,omitempty"`
+}
+
+type ClubActionResponse struct {
+	ID              uint      `json:"id"`
+	Name            string    `json:"name"`
+	Unit            string    `json:"unit,omitempty"`
+	Points          int       `json:"points"`
+	CooldownMinutes int       `json:"cooldown_minutes"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type ClubBanResponse struct {
+	User      User       `json:"user"`
+	BannedBy  uint       `json:"banned_by"`
+	Reason    *string    `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type ClubInviteResponse struct {
+	ID        uint       `json:"id"`
+	Code      string     `json:"code"`
+	Role      string     `json:"role"`
+	Uses      int        `json:"uses"`
+	MaxUses   *int       `json:"max_uses,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// Default is true for the invite whose code is the club code.
+	Default   bool      `json:"default"`
+	Active    bool      `json:"active"`
+	CreatedBy uint      `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type JoinRequestResponse struct {
+	ID        uint       `json:"id"`
+	ClubID    uint       `json:"club_id"`
+	ClubName  string     `json:"club_name"`
+	User      User       `json:"user"`
+	Status    string     `json:"status"`
+	Role      string     `json:"role"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type DiscoverClubResponse struct {
+	ID              uint      `json:"id"`
+	Name            string    `json:"name"`
+	Description     *string   `json:"description,omitempty"`
+	Action          string    `json:"action"`
+	Tags            []string  `json:"tags"`
+	NumberOfMembers int       `json:"number_of_members"`
+	RecentActivity  int       `json:"recent_activity"`
+	IsMember        bool      `json:"is_member"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type InvitationResponse struct {
+	ID          uint       `json:"id"`
+	ClubID      uint       `json:"club_id"`
+	ClubName    string     `json:"club_name"`
+	Inviter     User       `json:"inviter"`
+	Invitee     User       `json:"invitee"`
+	Status      string     `json:"status"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type WaitlistEntryResponse struct {
+	ClubID    uint      `json:"club_id"`
+	ClubName  string    `json:"club_name"`
+	User      User      `json:"user"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TeamResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TeamLeaderboardEntryResponse struct {
+	Team        TeamResponse `json:"team"`
+	MemberCount int          `json:"member_count"`
+	Score       float64      `json:"score"`
+}
+
+type TeamSettingsResponse struct {
+	SelfSelect bool   `json:"self_select"`
+	Scoring    string `json:"scoring"`
+	TopN       *int   `json:"top_n,omitempty"`
+}
+
+type ChallengeClubStanding struct {
+	ClubID   uint    `json:"club_id"`
+	Name     string  `json:"name"`
+	CheckIns int     `json:"checkins"`
+	Members  int     `json:"members"`
+	Score    float64 `json:"score"`
+}
+
+type ChallengeResponse struct {
+	ID     uint   `json:"id"`
+	Metric string `json:"metric"`
+	Status string `json:"status" enums:"pending,accepted,declined,cancelled,finished"`
+	// Challenger first. Live while the challenge runs, final once finished.
+	Standings    []ChallengeClubStanding `json:"standings"`
+	StartsAt     time.Time               `json:"starts_at"`
+	EndsAt       time.Time               `json:"ends_at"`
+	WinnerClubID *uint                   `json:"winner_club_id,omitempty"`
+	CreatedAt    time.Time               `json:"created_at"`
+}
+
+type DuelRecord struct {
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Draws  int `json:"draws"`
+}
+
+type DuelParticipant struct {
+	User     User `json:"user"`
+	CheckIns int  `json:"checkins"`
+}
+
+type DuelResponse struct {
+	ID       uint   `json:"id"`
+	ClubID   uint   `json:"club_id"`
+	ClubName string `json:"club_name"`
+	Status   string `json:"status" enums:"pending,accepted,declined,cancelled,finished"`
+	Days     int    `json:"days"`
+	// Check-ins count from when the opponent accepts.
+	Challenger DuelParticipant `json:"challenger"`
+	Opponent   DuelParticipant `json:"opponent"`
+	StartsAt   *time.Time      `json:"starts_at,omitempty"`
+	EndsAt     *time.Time      `json:"ends_at,omitempty"`
+	WinnerID   *uint           `json:"winner_id,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type GoalResponse struct {
+	ID      uint   `json:"id"`
+	UserID  uint   `json:"user_id"`
+	ClubID  uint   `json:"club_id"`
+	Period  string `json:"period" enums:"day,week,month"`
+	Target  int    `json:"target"`
+	Visible bool   `json:"visible"`
+	// Check-ins in the current period, which runs from period_start until
+	// period_end (UTC).
+	CheckIns    int       `json:"checkins"`
+	Completed   bool      `json:"completed"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	CreatedAt   time.Time `json:"created_at"`
 }
@@ -12,6 +12,21 @@ import "time"
 // 	Score int `json:"score" binding:"required"`
 // }
 
+// CheckInRequest is optional; an empty body checks in one unit of the
+// club's default action.
+type CheckInRequest struct {
+	ActionID uint `json:"action_id,omitempty" example:"3"`
+	// Defaults to 1.
+	Amount *int `json:"amount,omitempty" example:"5"`
+}
+
+// AdjustScoreRequest corrects a member's score by hand.
+type AdjustScoreRequest struct {
+	// Added to the score; negative to deduct.
+	Points int     `json:"points" example:"-5"`
+	Reason *string `json:"reason,omitempty" example:"duplicate check-in"`
+}
+
 /*************** RESPONSE DTOs ***************/
 
 type LeaderboardEntryResponse struct {
@@ -21,3 +36,25 @@ type LeaderboardEntryResponse struct {
 	LongestStreak int        `json:"longest_streak"`
 	LastCheckedIn *time.Time `json:"last_checkedin,omitempty"`
 }
+
+type CheckInResponse struct {
+	Action      ClubActionResponse `json:"action"`
+	Amount      int                `json:"amount"`
+	Points      int                `json:"points"`
+	NextCheckIn *time.Time         `json:"next_checkin,omitempty"`
+	// Badges earned with this check-in.
+	Badges []BadgeResponse `json:"badges"`
+	// XP earned with this check-in, and the level it left the user at.
+	XP        int  `json:"xp"`
+	Level     int  `json:"level"`
+	LeveledUp bool `json:"leveled_up"`
+	// Goals this check-in completed for the current period.
+	CompletedGoals []GoalResponse `json:"completed_goals"`
+}
+
+type ActionLeaderboardEntryResponse struct {
+	User          User       `json:"user"`
+	Amount        int        `json:"amount"`
+	Points        int        `json:"points"`
+	LastCheckedIn *time.Time `json:"last_checkedin,omitempty"`
+}
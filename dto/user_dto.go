@@ -1,5 +1,11 @@
 package dto
 
+import (
+	"time"
+
+	"klubRanks/utils"
+)
+
 type SignupRequest struct {
 	Username string `json:"username" binding:"required" example:"john"`
 	AvatarID string `json:"avatar_id" binding:"required"`
@@ -34,4 +40,174 @@ type User struct {
 	ID       uint   `json:"id"`
 	Username string `json:"username"`
 	AvatarID string `json:"avatar_id"`
+	XP       int    `json:"xp"`
+	Level    int    `json:"level"`
+}
+
+type UpdateProfileRequest struct {
+	Username    *string `json:"username,omitempty" example:"john_doe"`
+	DisplayName *string `json:"display_name,omitempty" example:"John Doe"`
+	Bio         *string `json:"bio,omitempty" example:"Runs every morning"`
+	Timezone    *string `json:"timezone,omitempty" example:"Europe/Berlin"`
+}
+
+type ClubMembershipSummary struct {
+	ClubID        uint      `json:"club_id"`
+	Name          string    `json:"name"`
+	Role          string    `json:"role"`
+	Score         int       `json:"score"`
+	Rank          int       `json:"rank"`
+	CurrentStreak int       `json:"current_streak"`
+	JoinedAt      time.Time `json:"joined_at"`
+	Archived      bool      `json:"archived"`
+}
+
+type SharedClub struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+type AggregateStats struct {
+	ClubCount     int        `json:"club_count"`
+	TotalScore    int        `json:"total_score"`
+	TotalCheckIns int        `json:"total_checkins"`
+	LongestStreak int        `json:"longest_streak"`
+	Duels         DuelRecord `json:"duels"`
+}
+
+type BadgeResponse struct {
+	Key         string    `json:"key" example:"streak_7"`
+	Name        string    `json:"name" example:"On a Roll"`
+	Description string    `json:"description" example:"Checked in 7 days in a row"`
+	ClubID      uint      `json:"club_id"`
+	AwardedAt   time.Time `json:"awarded_at"`
+}
+
+type ProfileResponse struct {
+	ID          uint                    `json:"id"`
+	Username    string                  `json:"username"`
+	DisplayName string                  `json:"display_name"`
+	Bio         string                  `json:"bio"`
+	Timezone    string                  `json:"timezone"`
+	AvatarID    string                  `json:"avatar_id"`
+	XP          int                     `json:"xp"`
+	Level       int                     `json:"level"`
+	CreatedAt   time.Time               `json:"created_at"`
+	Clubs       []ClubMembershipSummary `json:"clubs"`
+	Badges      []BadgeResponse         `json:"badges"`
+}
+
+type PublicProfileResponse struct {
+	ID                uint            `json:"id"`
+	Username          string          `json:"username"`
+	DisplayName       string          `json:"display_name"`
+	Bio               string          `json:"bio"`
+	AvatarID          string          `json:"avatar_id"`
+	XP                int             `json:"xp"`
+	Level             int             `json:"level"`
+	CreatedAt         time.Time       `json:"created_at"`
+	PreviousUsernames []string        `json:"previous_usernames"`
+	SharedClubs       []SharedClub    `json:"shared_clubs"`
+	Stats             AggregateStats  `json:"stats"`
+	Badges            []BadgeResponse `json:"badges"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required" example:"strongpassword"`
+}
+
+// SetPasswordRequest changes the password, or sets a first one for users
+// who signed up through a login provider. CurrentPassword is required once
+// the user has a password.
+type SetPasswordRequest struct {
+	CurrentPassword string `json:"current_password" example:"oldpassword"`
+	NewPassword     string `json:"new_password" binding:"required" example:"strongpassword"`
+}
+
+type DataExportResponse struct {
+	ID          uint       `json:"id"`
+	Status      string     `json:"status" example:"ready"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty" example:"/exports/3f9a..."`
+	Error       string     `json:"error,omitempty"`
+}
+
+type TwoFactorChallengeResponse struct {
+	Message           string `json:"message" example:"two-factor authentication required"`
+	TwoFactorRequired bool   `json:"two_factor_required" example:"true"`
+	ChallengeToken    string `json:"challenge_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required" example:"123456"`
+}
+
+type TwoFactorSetupRequest struct {
+	Password string `json:"password" binding:"required" example:"strongpassword"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/KlubRanks:john?secret=JBSWY3DPEHPK3PXP&issuer=KlubRanks"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password" binding:"required" example:"strongpassword"`
+	Code     string `json:"code" binding:"required" example:"123456"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"3f9a1-c07e2"`
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled                bool  `json:"enabled"`
+	RemainingRecoveryCodes int64 `json:"remaining_recovery_codes"`
+}
+
+type LoginProvidersResponse struct {
+	Providers []string `json:"providers" example:"google"`
+}
+
+type AuthorizationURLResponse struct {
+	AuthorizationURL string `json:"authorization_url" example:"https://accounts.example.com/authorize?response_type=code&..."`
+}
+
+type ExternalIdentityResponse struct {
+	Provider    string     `json:"provider" example:"google"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required" example:"watch auto check-in"`
+	Scopes        []string `json:"scopes" binding:"required" example:"checkin"`
+	ExpiresInDays *int     `json:"expires_in_days,omitempty" example:"90"`
+}
+
+type APITokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" example:"kr_pat_3f9a1c"`
+	Scopes     []string   `json:"scopes" example:"checkin"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAPITokenResponse struct {
+	APITokenResponse
+	Token string `json:"token" example:"kr_pat_3f9a1c..."`
+}
+
+type JWKSResponse struct {
+	Keys []utils.JSONWebKey `json:"keys"`
 }
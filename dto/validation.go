@@ -0,0 +1,354 @@
+package dto
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"klubRanks/utils"
+)
+
+type FieldError struct {
+	Field   string `json:"field" example:"username"`
+	Message string `json:"message" example:"is reserved"`
+}
+
+type ValidationErrorResponse struct {
+	Error  string       `json:"error" example:"validation failed"`
+	Fields []FieldError `json:"fields"`
+}
+
+// Validate checks the signup payload against the username and password
+// policy. Uniqueness is checked separately since it needs the database.
+func (r SignupRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	if err := utils.ValidateUsername(r.Username); err != nil {
+		errs = append(errs, FieldError{Field: "username", Message: err.Error()})
+	}
+	if err := utils.ValidatePassword(r.Password); err != nil {
+		errs = append(errs, FieldError{Field: "password", Message: err.Error()})
+	}
+
+	return errs
+}
+
+// Validate checks the new password against the password policy.
+func (r SetPasswordRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	if err := utils.ValidatePassword(r.NewPassword); err != nil {
+		errs = append(errs, FieldError{Field: "new_password", Message: err.Error()})
+	}
+
+	return errs
+}
+
+const (
+	DisplayNameMaxLength = 40
+	BioMaxLength         = 280
+)
+
+// Validate checks the fields that are present in the profile update.
+func (r UpdateProfileRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	if r.Username != nil {
+		if err := utils.ValidateUsername(*r.Username); err != nil {
+			errs = append(errs, FieldError{Field: "username", Message: err.Error()})
+		}
+	}
+	if r.DisplayName != nil && utf8.RuneCountInString(*r.DisplayName) > DisplayNameMaxLength {
+		errs = append(errs, FieldError{Field: "display_name", Message: fmt.Sprintf("must be at most %d characters", DisplayNameMaxLength)})
+	}
+	if r.Bio != nil && utf8.RuneCountInString(*r.Bio) > BioMaxLength {
+		errs = append(errs, FieldError{Field: "bio", Message: fmt.Sprintf("must be at most %d characters", BioMaxLength)})
+	}
+	if r.Timezone != nil {
+		if _, err := time.LoadLocation(*r.Timezone); err != nil || *r.Timezone == "" || *r.Timezone == "Local" {
+			errs = append(errs, FieldError{Field: "timezone", Message: "must be a valid IANA time zone"})
+		}
+	}
+
+	return errs
+}
+
+const (
+	APITokenNameMaxLength     = 60
+	APITokenDefaultExpiryDays = 90
+	APITokenMaxExpiryDays     = 365
+)
+
+// Validate checks the token name, scopes and expiry.
+func (r CreateAPITokenRequest) Validate(validScopes []string) []FieldError {
+	var errs []FieldError
+
+	if name := strings.TrimSpace(r.Name); name == "" || utf8.RuneCountInString(name) > APITokenNameMaxLength {
+		errs = append(errs, FieldError{Field: "name", Message: fmt.Sprintf("must be between 1 and %d characters", APITokenNameMaxLength)})
+	}
+
+	if len(r.Scopes) == 0 {
+		errs = append(errs, FieldError{Field: "scopes", Message: "must contain at least one scope"})
+	}
+	for _, scope := range r.Scopes {
+		if !slices.Contains(validScopes, scope) {
+			errs = append(errs, FieldError{Field: "scopes", Message: fmt.Sprintf("unknown scope %q, expected one of %s", scope, strings.Join(validScopes, ", "))})
+		}
+	}
+
+	if r.ExpiresInDays != nil && (*r.ExpiresInDays < 1 || *r.ExpiresInDays > APITokenMaxExpiryDays) {
+		errs = append(errs, FieldError{Field: "expires_in_days", Message: fmt.Sprintf("must be between 1 and %d", APITokenMaxExpiryDays)})
+	}
+
+	return errs
+}
+
+const (
+	BanReasonMaxLength = 200
+	BanMaxExpiryDays   = 3650
+)
+
+// Validate checks the ban reason and expiry.
+func (r BanMemberRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	if r.Reason != nil && utf8.RuneCountInString(strings.TrimSpace(*r.Reason)) > BanReasonMaxLength {
+		errs = append(errs, FieldError{Field: "reason", Message: fmt.Sprintf("must be at most %d characters", BanReasonMaxLength)})
+	}
+	if r.ExpiresInDays != nil && (*r.ExpiresInDays < 1 || *r.ExpiresInDays > BanMaxExpiryDays) {
+		errs = append(errs, FieldError{Field: "expires_in_days", Message: fmt.Sprintf("must be between 1 and %d", BanMaxExpiryDays)})
+	}
+
+	return errs
+}
+
+const (
+	InviteMaxUses        = 10000
+	InviteMaxExpiryHours = 24 * 365
+)
+
+// Validate checks the invite usage limit and expiry.
+func (r CreateClubInviteRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	if r.MaxUses != nil && (*r.MaxUses < 1 || *r.MaxUses > InviteMaxUses) {
+		errs = append(errs, FieldError{Field: "max_uses", Message: fmt.Sprintf("must be between 1 and %d", InviteMaxUses)})
+	}
+	if r.ExpiresInHours != nil && (*r.ExpiresInHours < 1 || *r.ExpiresInHours > InviteMaxExpiryHours) {
+		errs = append(errs, FieldError{Field: "expires_in_hours", Message: fmt.Sprintf("must be between 1 and %d", InviteMaxExpiryHours)})
+	}
+
+	return errs
+}
+
+const (
+	ClubMaxTags         = 5
+	ClubTagMaxLength    = 24
+	ClubMaxMembersLimit = 10000
+)
+
+// Validate checks the club tags and capacity.
+func (r CreateClubRequest) Validate() []FieldError {
+	return append(validateClubTags(r.Tags), validateMaxMembers(r.MaxMembers)...)
+}
+
+// Validate checks the club tags and capacity. A capacity of 0 removes the
+// limit.
+func (r UpdateClubRequest) Validate() []FieldError {
+	if r.MaxMembers != nil && *r.MaxMembers == 0 {
+		return validateClubTags(r.Tags)
+	}
+	return append(validateClubTags(r.Tags), validateMaxMembers(r.MaxMembers)...)
+}
+
+func validateMaxMembers(maxMembers *int) []FieldError {
+	if maxMembers != nil && (*maxMembers < 1 || *maxMembers > ClubMaxMembersLimit) {
+		return []FieldError{{Field: "max_members", Message: fmt.Sprintf("must be between 1 and %d", ClubMaxMembersLimit)}}
+	}
+	return nil
+}
+
+const (
+	ActionNameMaxLength  = 40
+	ActionUnitMaxLength  = 16
+	ActionMaxPoints      = 1000
+	ActionMaxCooldownMin = 7 * 24 * 60
+	CheckInMaxAmount     = 1000
+)
+
+// Validate checks the action name, unit, weight and cooldown.
+func (r ClubActionRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	if name := strings.TrimSpace(r.Name); name == "" || utf8.RuneCountInString(name) > ActionNameMaxLength {
+		errs = append(errs, FieldError{Field: "name", Message: fmt.Sprintf("must be between 1 and %d characters", ActionNameMaxLength)})
+	}
+	if utf8.RuneCountInString(strings.TrimSpace(r.Unit)) > ActionUnitMaxLength {
+		errs = append(errs, FieldError{Field: "unit", Message: fmt.Sprintf("must be at most %d characters", ActionUnitMaxLength)})
+	}
+	if r.Points != nil && (*r.Points < 1 || *r.Points > ActionMaxPoints) {
+		errs = append(errs, FieldError{Field: "points", Message: fmt.Sprintf("must be between 1 and %d", ActionMaxPoints)})
+	}
+	if r.CooldownMinutes < 0 || r.CooldownMinutes > ActionMaxCooldownMin {
+		errs = append(errs, FieldError{Field: "cooldown_minutes", Message: fmt.Sprintf("must be between 0 and %d", ActionMaxCooldownMin)})
+	}
+
+	return errs
+}
+
+const (
+	ScoreAdjustmentMax         = 10000
+	ScoreAdjustReasonMaxLength = 200
+)
+
+// Validate checks the adjustment is non-zero and within bounds.
+func (r AdjustScoreRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	if r.Points == 0 || r.Points < -ScoreAdjustmentMax || r.Points > ScoreAdjustmentMax {
+		errs = append(errs, FieldError{Field: "points", Message: fmt.Sprintf("must be non-zero and between -%d and %d", ScoreAdjustmentMax, ScoreAdjustmentMax)})
+	}
+	if r.Reason != nil && utf8.RuneCountInString(strings.TrimSpace(*r.Reason)) > ScoreAdjustReasonMaxLength {
+		errs = append(errs, FieldError{Field: "reason", Message: fmt.Sprintf("must be at most %d characters", ScoreAdjustReasonMaxLength)})
+	}
+
+	return errs
+}
+
+// Validate checks the check-in amount.
+func (r CheckInRequest) Validate() []FieldError {
+	if r.Amount != nil && (*r.Amount < 1 || *r.Amount > CheckInMaxAmount) {
+		return []FieldError{{Field: "amount", Message: fmt.Sprintf("must be between 1 and %d", CheckInMaxAmount)}}
+	}
+	return nil
+}
+
+const (
+	TeamNameMaxLength = 40
+	TeamMaxTopN       = 100
+)
+
+// Validate checks the team name.
+func (r TeamRequest) Validate() []FieldError {
+	if name := strings.TrimSpace(r.Name); name == "" || utf8.RuneCountInString(name) > TeamNameMaxLength {
+		return []FieldError{{Field: "name", Message: fmt.Sprintf("must be between 1 and %d characters", TeamNameMaxLength)}}
+	}
+	return nil
+}
+
+// Validate checks the scoring mode and that top scoring says how many
+// scores count.
+func (r TeamSettingsRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	switch r.Scoring {
+	case "sum", "average":
+	case "top":
+		if r.TopN == nil || *r.TopN < 1 || *r.TopN > TeamMaxTopN {
+			errs = append(errs, FieldError{Field: "top_n", Message: fmt.Sprintf("must be between 1 and %d with top scoring", TeamMaxTopN)})
+		}
+	default:
+		errs = append(errs, FieldError{Field: "scoring", Message: "must be one of sum, average or top"})
+	}
+
+	return errs
+}
+
+const (
+	ChallengeMaxDays = 90
+	// How far in the past starts_at may be, to allow for clock skew and
+	// clients that send the current time.
+	ChallengeStartLeeway = 5 * time.Minute
+)
+
+// Validate checks the metric and that the period starts now or later and
+// lasts at most ChallengeMaxDays.
+func (r CreateChallengeRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	if r.Metric != "total_checkins" && r.Metric != "average_per_member" {
+		errs = append(errs, FieldError{Field: "metric", Message: "must be one of total_checkins or average_per_member"})
+	}
+	if r.StartsAt.Before(time.Now().Add(-ChallengeStartLeeway)) {
+		errs = append(errs, FieldError{Field: "starts_at", Message: "must not be in the past"})
+	}
+	switch {
+	case !r.EndsAt.After(r.StartsAt):
+		errs = append(errs, FieldError{Field: "ends_at", Message: "must be after starts_at"})
+	case !r.EndsAt.After(time.Now()):
+		errs = append(errs, FieldError{Field: "ends_at", Message: "must be in the future"})
+	case r.EndsAt.Sub(r.StartsAt) > ChallengeMaxDays*24*time.Hour:
+		errs = append(errs, FieldError{Field: "ends_at", Message: fmt.Sprintf("must be at most %d days after starts_at", ChallengeMaxDays)})
+	}
+
+	return errs
+}
+
+const DuelMaxDays = 30
+
+// Validate checks the duel length.
+func (r CreateDuelRequest) Validate() []FieldError {
+	if r.Days != nil && (*r.Days < 1 || *r.Days > DuelMaxDays) {
+		return []FieldError{{Field: "days", Message: fmt.Sprintf("must be between 1 and %d", DuelMaxDays)}}
+	}
+	return nil
+}
+
+const GoalMaxTarget = 1000
+
+// Validate checks the period and that the target is between 1 and
+// GoalMaxTarget.
+func (r GoalRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	if r.Period != "day" && r.Period != "week" && r.Period != "month" {
+		errs = append(errs, FieldError{Field: "period", Message: "must be one of day, week or month"})
+	}
+	if r.Target < 1 || r.Target > GoalMaxTarget {
+		errs = append(errs, FieldError{Field: "target", Message: fmt.Sprintf("must be between 1 and %d", GoalMaxTarget)})
+	}
+
+	return errs
+}
+
+// NormalizeTags lowercases, trims and deduplicates tags, keeping their order.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+func validateClubTags(tags []string) []FieldError {
+	var errs []FieldError
+
+	tags = NormalizeTags(tags)
+	if len(tags) > ClubMaxTags {
+		errs = append(errs, FieldError{Field: "tags", Message: fmt.Sprintf("must contain at most %d tags", ClubMaxTags)})
+	}
+	for _, tag := range tags {
+		if !isValidTag(tag) {
+			errs = append(errs, FieldError{Field: "tags", Message: fmt.Sprintf("tag %q must be 1 to %d letters, digits or dashes", tag, ClubTagMaxLength)})
+		}
+	}
+
+	return errs
+}
+
+func isValidTag(tag string) bool {
+	if tag == "" || len(tag) > ClubTagMaxLength {
+		return false
+	}
+	for _, r := range tag {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"time"
+
+	"klubRanks/logger"
+	"klubRanks/models"
+)
+
+const competitionCheckInterval = time.Minute
+
+// runCompetitionResolver settles challenges and duels shortly after they
+// end and announces the results.
+func runCompetitionResolver() {
+	ticker := time.NewTicker(competitionCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		if err := models.FinishEndedChallenges(now); err != nil {
+			logger.LogError("Failed to finish ended challenges:", err)
+		}
+		if err := models.FinishEndedDuels(now); err != nil {
+			logger.LogError("Failed to finish ended duels:", err)
+		}
+	}
+}
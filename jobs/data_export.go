@@ -0,0 +1,260 @@
+package jobs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"klubRanks/config"
+	"klubRanks/logger"
+	"klubRanks/models"
+)
+
+// Pending exports live in the database, which is the queue. The worker
+// polls it, and is woken up early when an export is requested.
+const exportPollInterval = 30 * time.Second
+
+var exportWakeup = make(chan struct{}, 1)
+
+// NotifyExportWorker tells the worker that an export is pending.
+func NotifyExportWorker() {
+	select {
+	case exportWakeup <- struct{}{}:
+	default:
+		// The worker is already due to look.
+	}
+}
+
+func runExportWorker() {
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+
+	for {
+		processPendingExports()
+
+		select {
+		case <-exportWakeup:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processPendingExports builds pending exports, oldest first, until none
+// are left.
+func processPendingExports() {
+	for {
+		export, err := models.ClaimPendingDataExport()
+		if err != nil {
+			logger.LogError("Failed to claim a pending export:", err)
+			return
+		}
+		if export == nil {
+			return
+		}
+
+		if err := buildDataExport(export); err != nil {
+			logger.LogError("Data export", export.ID, "failed:", err)
+			if err := export.MarkFailed(err, config.AppConfig.Export.LinkExpiry); err != nil {
+				logger.LogError("Failed to mark export as failed:", err)
+			}
+			continue
+		}
+		logger.LogInfo("Data export", export.ID, "ready for user", export.UserID)
+	}
+}
+
+func removeExpiredExports() error {
+	exports, err := models.GetExpiredDataExports(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, e := range exports {
+		// Failed exports have no archive to remove.
+		if e.FilePath != "" {
+			if err := os.Remove(e.FilePath); err != nil && !os.IsNotExist(err) {
+				logger.LogError("Failed to remove export file", e.FilePath, ":", err)
+				continue
+			}
+		}
+		if err := models.DeleteDataExport(e.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func buildDataExport(export *models.DataExport) error {
+	dir := config.AppConfig.Export.Dir
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("export-%d-%s.zip", export.UserID, export.Token[:12]))
+	if err := writeExportArchive(path, export.UserID); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return export.MarkReady(path, config.AppConfig.Export.LinkExpiry)
+}
+
+// writeExportArchive writes every dataset both as JSON and as CSV.
+func writeExportArchive(path string, userID uint) error {
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	memberships, err := models.GetMembershipsForUser(userID)
+	if err != nil {
+		return err
+	}
+	entries, err := models.GetLeaderboardEntriesForUser(userID)
+	if err != nil {
+		return err
+	}
+	activity, err := models.GetActivityLogsForUser(userID)
+	if err != nil {
+		return err
+	}
+	messages, err := models.GetMessagesByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+
+	datasets := []struct {
+		name   string
+		data   any
+		header []string
+		rows   [][]string
+	}{
+		{
+			name:   "profile",
+			data:   user,
+			header: []string{"id", "username", "display_name", "bio", "timezone", "avatar_id", "created_at"},
+			rows: [][]string{{
+				formatUint(user.ID), user.Username, user.DisplayName, user.Bio, user.Timezone, user.AvatarID, formatTime(user.CreatedAt),
+			}},
+		},
+		{
+			name:   "memberships",
+			data:   memberships,
+			header: []string{"club_id", "role", "joined_at"},
+			rows:   membershipRows(memberships),
+		},
+		{
+			name:   "leaderboard",
+			data:   entries,
+			header: []string{"club_id", "score", "current_streak", "longest_streak", "last_checkedin"},
+			rows:   leaderboardRows(entries),
+		},
+		{
+			name:   "activity_logs",
+			data:   activity,
+			header: []string{"id", "club_id", "action", "action_id", "amount", "updated_score", "created_at"},
+			rows:   activityRows(activity),
+		},
+		{
+			name:   "messages",
+			data:   messages,
+			header: []string{"message_id", "club_id", "timestamp", "message", "reply_to_id"},
+			rows:   messageRows(messages),
+		},
+	}
+
+	for _, ds := range datasets {
+		w, err := archive.Create(ds.name + ".json")
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(ds.data); err != nil {
+			return err
+		}
+
+		w, err = archive.Create(ds.name + ".csv")
+		if err != nil {
+			return err
+		}
+		cw := csv.NewWriter(w)
+		if err := cw.Write(ds.header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(ds.rows); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func membershipRows(members []models.Member) [][]string {
+	rows := make([][]string, 0, len(members))
+	for _, m := range members {
+		rows = append(rows, []string{formatUint(m.ClubID), m.Role, formatTime(m.JoinedAt)})
+	}
+	return rows
+}
+
+func leaderboardRows(entries []models.LeaderboardEntry) [][]string {
+	rows := make([][]string, 0, len(entries))
+	for _, e := range entries {
+		lastCheckedIn := ""
+		if e.LastCheckedIn != nil {
+			lastCheckedIn = formatTime(*e.LastCheckedIn)
+		}
+		rows = append(rows, []string{
+			formatUint(e.ClubID), strconv.Itoa(e.Score), strconv.Itoa(e.CurrentStreak), strconv.Itoa(e.LongestStreak), lastCheckedIn,
+		})
+	}
+	return rows
+}
+
+func activityRows(logs []models.ActivityLog) [][]string {
+	rows := make([][]string, 0, len(logs))
+	for _, l := range logs {
+		actionID := ""
+		if l.ActionID != nil {
+			actionID = formatUint(*l.ActionID)
+		}
+		rows = append(rows, []string{
+			formatUint(l.ID), formatUint(l.ClubID), l.Action, actionID, strconv.Itoa(l.Amount), strconv.Itoa(l.UpdatedScore), formatTime(l.CreatedAt),
+		})
+	}
+	return rows
+}
+
+func messageRows(messages []models.Message) [][]string {
+	rows := make([][]string, 0, len(messages))
+	for _, m := range messages {
+		replyTo := ""
+		if m.ReplyToID != nil {
+			replyTo = formatUint(*m.ReplyToID)
+		}
+		rows = append(rows, []string{
+			formatUint(m.ID), formatUint(m.ClubID), formatTime(m.Timestamp), m.Message, replyTo,
+		})
+	}
+	return rows
+}
+
+func formatUint(v uint) string {
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"klubRanks/logger"
+	"klubRanks/models"
+)
+
+const cleanupInterval = time.Hour
+
+// Start launches the background workers. It must be called after the
+// database has been initialised and before the server accepts requests,
+// since it loads the JWT signing keys.
+func Start() {
+	if err := rotateSigningKeys(); err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
+
+	// Exports that were being built when the server stopped start over.
+	if err := models.ResetProcessingDataExports(); err != nil {
+		log.Fatalf("failed to requeue unfinished exports: %v", err)
+	}
+
+	go runSigningKeyRotation()
+	go runExportWorker()
+	go runCleanup()
+	go runCompetitionResolver()
+}
+
+func runCleanup() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := removeExpiredExports(); err != nil {
+			logger.LogError("Failed to remove expired exports:", err)
+		}
+		if err := models.DeleteExpiredTwoFactorChallenges(time.Now()); err != nil {
+			logger.LogError("Failed to remove expired login challenges:", err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package jobs
+
+import (
+	"time"
+
+	"klubRanks/config"
+	"klubRanks/logger"
+	"klubRanks/models"
+	"klubRanks/utils"
+)
+
+// Instances reload keys this often so a key created by another instance is
+// picked up well before it activates.
+const signingKeyRefreshInterval = 5 * time.Minute
+
+func runSigningKeyRotation() {
+	ticker := time.NewTicker(signingKeyRefreshInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := rotateSigningKeys(); err != nil {
+			logger.LogError("Failed to rotate signing keys:", err)
+		}
+	}
+}
+
+// rotateSigningKeys makes sure there is an active key, pre-publishes the next
+// key ahead of its activation, schedules superseded keys to expire once the
+// tokens they signed have expired, and loads the result into the keyring.
+func rotateSigningKeys() error {
+	cfg := config.AppConfig.JWT
+	if cfg.Algorithm == utils.AlgorithmHS256 {
+		return nil
+	}
+
+	now := time.Now()
+	if err := models.DeleteExpiredSigningKeys(now); err != nil {
+		return err
+	}
+
+	keys, err := models.GetSigningKeys(now)
+	if err != nil {
+		return err
+	}
+
+	var active, next *models.SigningKey
+	for i := range keys {
+		k := &keys[i]
+		if k.Algorithm != cfg.Algorithm {
+			continue
+		}
+		if !k.ActivatesAt.After(now) {
+			active = k
+		} else if next == nil {
+			next = k
+		}
+	}
+
+	if active == nil {
+		key, err := createSigningKey(cfg.Algorithm, now)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, *key)
+		active = &keys[len(keys)-1]
+		logger.LogInfo("Created signing key " + key.Kid)
+	}
+
+	if next == nil && !now.Before(active.ActivatesAt.Add(cfg.RotationInterval-cfg.PrepublishLead)) {
+		activatesAt := active.ActivatesAt.Add(cfg.RotationInterval)
+		if activatesAt.Before(now) {
+			activatesAt = now.Add(cfg.PrepublishLead)
+		}
+		key, err := createSigningKey(cfg.Algorithm, activatesAt)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, *key)
+		logger.LogInfo("Pre-published signing key "+key.Kid+" activating at", activatesAt)
+	}
+
+	// Every key activated before the current one is superseded.
+	for _, k := range keys {
+		if k.ExpiresAt == nil && k.ActivatesAt.Before(active.ActivatesAt) {
+			if err := models.SetSigningKeyExpiry(k.ID, active.ActivatesAt.Add(cfg.Expiry)); err != nil {
+				return err
+			}
+		}
+	}
+
+	ring := make([]utils.SigningKey, 0, len(keys))
+	for _, k := range keys {
+		privatePEM, err := utils.DecryptSecret(cfg.KeyEncryptionKey, k.PrivateKey)
+		if err != nil {
+			logger.LogError("Skipping unreadable signing key "+k.Kid+":", err)
+			continue
+		}
+		if err := encryptStoredSigningKey(&k, privatePEM); err != nil {
+			logger.LogError("Failed to encrypt signing key "+k.Kid+":", err)
+		}
+
+		key, err := utils.ParseSigningKey(k.Kid, k.Algorithm, privatePEM, k.ActivatesAt)
+		if err != nil {
+			logger.LogError("Skipping unreadable signing key "+k.Kid+":", err)
+			continue
+		}
+		ring = append(ring, key)
+	}
+	utils.SetSigningKeys(ring)
+
+	return nil
+}
+
+func createSigningKey(algorithm string, activatesAt time.Time) (*models.SigningKey, error) {
+	kid, privatePEM, err := utils.GenerateSigningKey(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := utils.EncryptSecret(config.AppConfig.JWT.KeyEncryptionKey, privatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	key := models.SigningKey{
+		Kid:         kid,
+		Algorithm:   algorithm,
+		PrivateKey:  encrypted,
+		ActivatesAt: activatesAt,
+	}
+	if err := models.CreateSigningKey(&key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// encryptStoredSigningKey encrypts a key stored in plaintext before a key
+// encryption key was configured.
+func encryptStoredSigningKey(key *models.SigningKey, privatePEM string) error {
+	encryptionKey := config.AppConfig.JWT.KeyEncryptionKey
+	if encryptionKey == nil || utils.IsEncryptedSecret(key.PrivateKey) {
+		return nil
+	}
+
+	encrypted, err := utils.EncryptSecret(encryptionKey, privatePEM)
+	if err != nil {
+		return err
+	}
+	if err := models.SetSigningKeyPrivateKey(key.ID, encrypted); err != nil {
+		return err
+	}
+	logger.LogInfo("Encrypted stored signing key " + key.Kid)
+	return nil
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"klubRanks/config"
 	"klubRanks/db"
+	"klubRanks/jobs"
 	"klubRanks/logger"
 	"klubRanks/models"
+	"klubRanks/oauth"
 	"klubRanks/routes"
+	"log"
 	"net"
 	"net/http"
 	"time"
@@ -28,12 +31,15 @@ import (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
-// @description Type "Bearer {your JWT token}"
+// @description Type "Bearer {your JWT or personal API token}"
 func main() {
 	logger.LogInfo("Starting KlubRanks Service...")
 
 	godotenv.Load()
 	config.Load()
+	if err := config.Validate(); err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
 
 	logger.LogDebug("Loaded configuration:", config.AppConfig)
 
@@ -41,6 +47,8 @@ func main() {
 
 	db.InitDB()
 	createTables()
+	jobs.Start()
+	oauth.Init()
 
 	server := gin.Default()
 	enableCORS(server)
@@ -83,12 +91,62 @@ func enableCORS(server *gin.Engine) {
 }
 
 func createTables() {
-	db.DB.AutoMigrate(
+	if err := models.DedupeClubCodes(); err != nil {
+		log.Fatalf("failed to dedupe club codes: %v", err)
+	}
+
+	err := db.DB.AutoMigrate(
 		&models.User{},
 		&models.Club{},
 		&models.Member{},
 		&models.LeaderboardEntry{},
 		&models.Message{},
 		&models.ActivityLog{},
+		&models.UsernameChange{},
+		&models.DataExport{},
+		&models.RecoveryCode{},
+		&models.TwoFactorChallenge{},
+		&models.ExternalIdentity{},
+		&models.OAuthState{},
+		&models.APIToken{},
+		&models.SigningKey{},
+		&models.ClubBan{},
+		&models.ClubInvite{},
+		&models.ClubJoinRequest{},
+		&models.ClubInvitation{},
+		&models.ClubWaitlistEntry{},
+		&models.ClubAction{},
+		&models.ActionScore{},
+		&models.ClubTeam{},
+		&models.ClubChallenge{},
+		&models.Duel{},
+		&models.UserBadge{},
+		&models.Goal{},
+		&models.ClubTag{},
 	)
+	if err != nil {
+		log.Fatalf("failed to migrate tables: %v", err)
+	}
+
+	if err := models.CreateUsernameIndex(); err != nil {
+		log.Fatalf("failed to create username index: %v", err)
+	}
+	if err := models.CreateActiveDataExportIndex(); err != nil {
+		log.Fatalf("failed to create data export index: %v", err)
+	}
+	if err := models.BackfillClubOwners(); err != nil {
+		log.Fatalf("failed to backfill club owners: %v", err)
+	}
+	if err := models.BackfillClubInvites(); err != nil {
+		log.Fatalf("failed to backfill club invites: %v", err)
+	}
+	if err := models.BackfillClubActions(config.AppConfig.Server.Counter); err != nil {
+		log.Fatalf("failed to backfill club actions: %v", err)
+	}
+	if err := models.BackfillCheckInActions(); err != nil {
+		log.Fatalf("failed to backfill check-in actions: %v", err)
+	}
+	if err := models.BackfillClubTags(); err != nil {
+		log.Fatalf("failed to backfill club tags: %v", err)
+	}
 }
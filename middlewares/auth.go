@@ -1,13 +1,24 @@
 package middlewares
 
 import (
+	"klubRanks/models"
 	"klubRanks/utils"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// principalKey is the gin context key holding the *utils.Principal.
+const principalKey = "principal"
+
+// GetPrincipal returns the caller set by Aunthenticate. It panics when used
+// on a route without the middleware, which is a programming error.
+func GetPrincipal(context *gin.Context) *utils.Principal {
+	return context.MustGet(principalKey).(*utils.Principal)
+}
+
 func Aunthenticate(context *gin.Context) {
 	token := context.Request.Header.Get("Authorization")
 
@@ -23,11 +34,39 @@ func Aunthenticate(context *gin.Context) {
 	}
 
 	token = parts[1] // <-- this is your actual token without "Bearer"
-	userId, err := utils.VerifyToken(token)
+
+	if strings.HasPrefix(token, models.APITokenPrefix) {
+		apiToken, err := models.AuthenticateAPIToken(token)
+		if err != nil {
+			context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "not authorized, " + err.Error()})
+			return
+		}
+		context.Set(principalKey, &utils.Principal{
+			UserID:    apiToken.UserID,
+			SessionID: "pat_" + strconv.FormatUint(uint64(apiToken.ID), 10),
+			Scopes:    apiToken.ScopeList(),
+			TokenType: utils.TokenTypeAPIToken,
+			IssuedAt:  apiToken.CreatedAt,
+		})
+		context.Next()
+		return
+	}
+
+	principal, err := utils.VerifyToken(token)
 	if err != nil {
 		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "not authorized, " + err.Error()})
 		return
 	}
-	context.Set("userId", userId)
+
+	revoked, err := models.IsTokenRevoked(principal.UserID, principal.IssuedAt)
+	if err != nil {
+		context.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if revoked {
+		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "not authorized, token has been revoked"})
+		return
+	}
+	context.Set(principalKey, principal)
 	context.Next()
 }
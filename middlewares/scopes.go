@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"klubRanks/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope lets login sessions through and requires API tokens to have
+// been granted the scope. It must run after Aunthenticate.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		principal := GetPrincipal(context)
+		if !principal.IsSession() && !models.HasScope(principal.Scopes, scope) {
+			context.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "API token is missing the " + scope + " scope"})
+			return
+		}
+		context.Next()
+	}
+}
+
+// RequireSession rejects API tokens on account level endpoints such as
+// password, two-factor and token management.
+func RequireSession(context *gin.Context) {
+	if !GetPrincipal(context).IsSession() {
+		context.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "this endpoint cannot be used with an API token"})
+		return
+	}
+	context.Next()
+}
@@ -5,13 +5,19 @@ import (
 	"time"
 
 	"klubRanks/db"
+
+	"gorm.io/gorm"
 )
 
 type ActivityLog struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	UserID       uint      `gorm:"not null;index" json:"user_id"`
-	ClubID       uint      `gorm:"not null;index" json:"club_id"`
-	Action       string    `gorm:"not null" json:"action"`
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"not null;index" json:"user_id"`
+	ClubID uint   `gorm:"not null;index" json:"club_id"`
+	Action string `gorm:"not null" json:"action"`
+	// Set for check-ins. Amount is in the action's unit, or points for
+	// ActionScoreAdjusted.
+	ActionID     *uint     `gorm:"index" json:"action_id,omitempty"`
+	Amount       int       `gorm:"not null;default:0" json:"amount"`
 	UpdatedScore int       `gorm:"not null;default:0" json:"updated_score"`
 	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
@@ -29,6 +35,14 @@ const (
 	ActionJoin   = "joined"
 	ActionLeave  = "left"
 	ActionUpdate = "update"
+	// Check-ins record which club action they were for in ActivityLog.ActionID,
+	// so member-chosen action names can't pass for system events.
+	ActionCheckIn = "checked_in"
+
+	ActionRoleChange        = "role_changed"
+	ActionOwnershipTransfer = "ownership_transferred"
+	ActionArchive           = "archived"
+	ActionUnarchive         = "unarchived"
 )
 
 func AddActivityLog(userID, clubID uint, updatedScore int, action string) error {
@@ -36,13 +50,12 @@ func AddActivityLog(userID, clubID uint, updatedScore int, action string) error
 	if err != nil {
 		return err
 	}
-	user, _ := GetUserByID(userID)
 
 	if action == ActionJoin || action == ActionLeave {
 		message := Message{
 			UserID:    userID,
 			ClubID:    clubID,
-			Message:   fmt.Sprintf("%s has %s %s.", user.Username, action, club.Name),
+			Message:   fmt.Sprintf("%s has %s %s.", mention(userID), action, club.Name),
 			Timestamp: time.Now(),
 			Type:      MessageTypeSystem,
 		}
@@ -62,7 +75,7 @@ func AddActivityLog(userID, clubID uint, updatedScore int, action string) error
 		message := Message{
 			UserID:    userID,
 			ClubID:    clubID,
-			Message:   user.Username + " increased their count by " + fmt.Sprint(updatedScore) + " " + club.Action,
+			Message:   mention(userID) + " increased their count by " + fmt.Sprint(updatedScore) + " " + club.Action,
 			Timestamp: time.Now(),
 			Type:      MessageTypeSystem,
 		}
@@ -71,7 +84,7 @@ func AddActivityLog(userID, clubID uint, updatedScore int, action string) error
 		log := ActivityLog{
 			UserID:       userID,
 			ClubID:       clubID,
-			Action:       club.Action,
+			Action:       ActionCheckIn,
 			UpdatedScore: updatedScore,
 			CreatedAt:    time.Now(),
 		}
@@ -80,6 +93,31 @@ func AddActivityLog(userID, clubID uint, updatedScore int, action string) error
 	}
 }
 
+// logClubEventTx records an activity log entry and posts the matching system
+// message to the club chat inside tx.
+func logClubEventTx(tx *gorm.DB, userID, clubID uint, action, text string) error {
+	now := time.Now()
+
+	log := ActivityLog{UserID: userID, ClubID: clubID, Action: action, CreatedAt: now}
+	if err := tx.Create(&log).Error; err != nil {
+		return err
+	}
+	return postSystemMessageTx(tx, userID, clubID, text, now)
+}
+
+// postSystemMessageTx posts a system message to the club chat without an
+// activity log entry, for events caused by someone outside the club.
+func postSystemMessageTx(tx *gorm.DB, userID, clubID uint, text string, now time.Time) error {
+	message := Message{
+		UserID:    userID,
+		ClubID:    clubID,
+		Message:   text,
+		Timestamp: now,
+		Type:      MessageTypeSystem,
+	}
+	return tx.Create(&message).Error
+}
+
 func GetDailyScoresForClub(
 	clubID uint,
 	day time.Time,
@@ -129,3 +167,14 @@ func GetDailyScoresForClub(
 
 	return result, nil
 }
+
+func GetActivityLogsForUser(userID uint) ([]ActivityLog, error) {
+	var logs []ActivityLog
+
+	err := db.DB.
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&logs).Error
+
+	return logs, err
+}
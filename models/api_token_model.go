@@ -0,0 +1,148 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"klubRanks/db"
+	"klubRanks/utils"
+)
+
+// Prefix of personal access tokens, used to tell them apart from JWTs.
+const APITokenPrefix = "kr_pat_"
+
+const (
+	ScopeRead    = "read"
+	ScopeCheckin = "checkin"
+	ScopeChat    = "chat"
+	// ScopeMember covers what members do for themselves: joining and leaving
+	// clubs, teams and waitlists, answering invitations, duels and goals.
+	ScopeMember = "member"
+	// ScopeAdmin grants club management and implies every other scope.
+	ScopeAdmin = "admin"
+)
+
+var APITokenScopes = []string{ScopeRead, ScopeCheckin, ScopeChat, ScopeMember, ScopeAdmin}
+
+const maxAPITokensPerUser = 20
+
+// Only update last_used_at this often to avoid a write on every request.
+const apiTokenLastUsedResolution = time.Minute
+
+var (
+	ErrInvalidAPIToken  = errors.New("invalid or expired API token")
+	ErrTooManyAPITokens = errors.New("too many API tokens, revoke one first")
+	ErrAPITokenNotFound = errors.New("API token not found")
+)
+
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	TokenHash  string     `gorm:"not null;uniqueIndex" json:"-"`
+	Prefix     string     `gorm:"not null" json:"prefix"`
+	Scopes     string     `gorm:"not null" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+func (t *APIToken) ScopeList() []string {
+	if t.Scopes == "" {
+		return nil
+	}
+	return strings.Split(t.Scopes, ",")
+}
+
+// HasScope reports whether the granted scopes allow the requested one.
+func HasScope(granted []string, scope string) bool {
+	return slices.Contains(granted, scope) || slices.Contains(granted, ScopeAdmin)
+}
+
+// CreateAPIToken stores a new token and returns it together with the plain
+// token value, which is never stored and cannot be shown again.
+func CreateAPIToken(userID uint, name string, scopes []string, expiresAt *time.Time) (*APIToken, string, error) {
+	var count int64
+	if err := db.DB.Model(&APIToken{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count >= maxAPITokensPerUser {
+		return nil, "", ErrTooManyAPITokens
+	}
+
+	random, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	plain := APITokenPrefix + random
+
+	token := APIToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: utils.HashToken(plain),
+		Prefix:    plain[:len(APITokenPrefix)+6],
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	if err := db.DB.Create(&token).Error; err != nil {
+		return nil, "", err
+	}
+	return &token, plain, nil
+}
+
+// AuthenticateAPIToken resolves a plain token to its stored record and
+// records that it was used.
+func AuthenticateAPIToken(plain string) (*APIToken, error) {
+	var token APIToken
+
+	err := db.DB.
+		Where("token_hash = ?", utils.HashToken(plain)).
+		First(&token).Error
+	if err != nil {
+		return nil, ErrInvalidAPIToken
+	}
+
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenLastUsedResolution {
+		db.DB.Model(&token).Update("last_used_at", now)
+		token.LastUsedAt = &now
+	}
+
+	return &token, nil
+}
+
+func GetAPITokensForUser(userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+
+	err := db.DB.
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&tokens).Error
+
+	return tokens, err
+}
+
+func DeleteAPIToken(userID, tokenID uint) error {
+	result := db.DB.
+		Where("id = ? AND user_id = ?", tokenID, userID).
+		Delete(&APIToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
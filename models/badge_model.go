@@ -0,0 +1,190 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"klubRanks/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Badge is an achievement definition. Definitions come from the config, so
+// they are passed in rather than stored.
+type Badge struct {
+	Key         string
+	Name        string
+	Description string
+	Rule        string
+	Threshold   int
+}
+
+// How a badge's threshold is compared.
+const (
+	BadgeRuleCheckIns = "checkins"
+	BadgeRuleStreak   = "streak"
+	BadgeRuleScore    = "score"
+	BadgeRuleRank     = "rank"
+)
+
+const ActionBadgeAwarded = "badge_awarded"
+
+// UserBadge is a badge a member earned in a club. The name and description
+// are copied so the badge reads the same if the definition changes later.
+type UserBadge struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;uniqueIndex:idx_user_club_badge" json:"user_id"`
+	ClubID      uint      `gorm:"not null;uniqueIndex:idx_user_club_badge;index" json:"club_id"`
+	BadgeKey    string    `gorm:"not null;uniqueIndex:idx_user_club_badge" json:"badge_key"`
+	Name        string    `gorm:"not null" json:"name"`
+	Description string    `json:"description"`
+	AwardedAt   time.Time `json:"awarded_at"`
+}
+
+// AwardBadges checks the member's progress in the club against the badges
+// they don't have yet, stores the ones they reached and announces each in
+// the club chat. It returns the newly awarded badges.
+func AwardBadges(userID, clubID uint, badges []Badge) ([]UserBadge, error) {
+	var awarded []UserBadge
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var owned []string
+		err := tx.Model(&UserBadge{}).
+			Where("user_id = ? AND club_id = ?", userID, clubID).
+			Pluck("badge_key", &owned).Error
+		if err != nil {
+			return err
+		}
+		has := make(map[string]bool, len(owned))
+		for _, key := range owned {
+			has[key] = true
+		}
+
+		var entry LeaderboardEntry
+		if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).First(&entry).Error; err != nil {
+			return err
+		}
+		progress := badgeProgress{tx: tx, entry: &entry}
+
+		now := time.Now()
+		for _, badge := range badges {
+			if has[badge.Key] {
+				continue
+			}
+			reached, err := progress.reached(badge)
+			if err != nil {
+				return err
+			}
+			if !reached {
+				continue
+			}
+
+			userBadge := UserBadge{
+				UserID:      userID,
+				ClubID:      clubID,
+				BadgeKey:    badge.Key,
+				Name:        badge.Name,
+				Description: badge.Description,
+				AwardedAt:   now,
+			}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&userBadge)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				// Awarded by a concurrent check-in.
+				continue
+			}
+
+			err = logClubEventTx(tx, userID, clubID, ActionBadgeAwarded,
+				fmt.Sprintf("%s earned the %s badge: %s.", mention(userID), badge.Name, badge.Description))
+			if err != nil {
+				return err
+			}
+			awarded = append(awarded, userBadge)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return awarded, nil
+}
+
+// badgeProgress looks up a member's numbers once, on first use.
+type badgeProgress struct {
+	tx       *gorm.DB
+	entry    *LeaderboardEntry
+	checkIns *int
+	rank     *int
+}
+
+func (p *badgeProgress) reached(badge Badge) (bool, error) {
+	switch badge.Rule {
+	case BadgeRuleCheckIns:
+		if p.checkIns == nil {
+			var n int64
+			err := p.tx.Model(&ActivityLog{}).
+				Where("user_id = ? AND club_id = ? AND updated_score > 0", p.entry.UserID, p.entry.ClubID).
+				Count(&n).Error
+			if err != nil {
+				return false, err
+			}
+			count := int(n)
+			p.checkIns = &count
+		}
+		return *p.checkIns >= badge.Threshold, nil
+
+	case BadgeRuleStreak:
+		return p.entry.LongestStreak >= badge.Threshold, nil
+
+	case BadgeRuleScore:
+		return p.entry.Score >= badge.Threshold, nil
+
+	case BadgeRuleRank:
+		if p.rank == nil {
+			var n int64
+			err := p.tx.Model(&LeaderboardEntry{}).
+				Where("club_id = ? AND (score > ? OR (score = ? AND last_checkedin > ?))",
+					p.entry.ClubID, p.entry.Score, p.entry.Score, p.entry.LastCheckedIn).
+				Count(&n).Error
+			if err != nil {
+				return false, err
+			}
+			rank := int(n) + 1
+			p.rank = &rank
+		}
+		return *p.rank <= badge.Threshold, nil
+	}
+	return false, nil
+}
+
+// GetBadgesForUser returns the user's badges in one club, or in all clubs
+// when clubID is 0, oldest first.
+func GetBadgesForUser(userID, clubID uint) ([]UserBadge, error) {
+	var badges []UserBadge
+
+	query := db.DB.Where("user_id = ?", userID)
+	if clubID != 0 {
+		query = query.Where("club_id = ?", clubID)
+	}
+	err := query.Order("awarded_at ASC, id ASC").Find(&badges).Error
+
+	return badges, err
+}
+
+// GetBadgesVisibleTo returns the user's badges from the clubs viewerID may
+// see: public clubs and the clubs viewerID is a member of, oldest first.
+func GetBadgesVisibleTo(userID, viewerID uint) ([]UserBadge, error) {
+	var badges []UserBadge
+
+	err := db.DB.
+		Joins("JOIN clubs ON clubs.id = user_badges.club_id").
+		Where("user_badges.user_id = ?", userID).
+		Where("clubs.is_private = ? OR EXISTS (SELECT 1 FROM members WHERE members.club_id = clubs.id AND members.user_id = ?)", false, viewerID).
+		Order("user_badges.awarded_at ASC, user_badges.id ASC").
+		Find(&badges).Error
+
+	return badges, err
+}
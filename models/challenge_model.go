@@ -0,0 +1,426 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"klubRanks/db"
+	"klubRanks/logger"
+
+	"gorm.io/gorm"
+)
+
+// ClubChallenge is two clubs competing over a fixed period. The challenger
+// club's admins propose it and the opponent club's admins accept it.
+type ClubChallenge struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	ChallengerClubID uint      `gorm:"not null;index" json:"challenger_club_id"`
+	OpponentClubID   uint      `gorm:"not null;index" json:"opponent_club_id"`
+	Metric           string    `gorm:"not null" json:"metric"`
+	Status           string    `gorm:"not null;index" json:"status"`
+	StartsAt         time.Time `gorm:"not null" json:"starts_at"`
+	EndsAt           time.Time `gorm:"not null;index" json:"ends_at"`
+	CreatedBy        uint      `gorm:"not null" json:"created_by"`
+	RespondedBy      *uint     `json:"responded_by,omitempty"`
+	// Nil for a draw or while the challenge is running.
+	WinnerClubID *uint     `json:"winner_club_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+const (
+	ChallengeMetricCheckIns       = "total_checkins"
+	ChallengeMetricAverageCheckIn = "average_per_member"
+)
+
+const (
+	ChallengePending   = "pending"
+	ChallengeAccepted  = "accepted"
+	ChallengeDeclined  = "declined"
+	ChallengeCancelled = "cancelled"
+	ChallengeFinished  = "finished"
+)
+
+const ActionChallenge = "challenge"
+
+var (
+	ErrChallengeNotFound      = errors.New("challenge not found")
+	ErrChallengeSelf          = errors.New("a club cannot challenge itself")
+	ErrChallengeEnded         = errors.New("challenge has already ended")
+	ErrInvalidChallengeMetric = errors.New("metric must be one of total_checkins or average_per_member")
+	ErrChallengeExists        = errors.New("these clubs already have a pending or running challenge")
+	ErrChallengePrivateClub   = errors.New("a private club can only be challenged by its members or people invited to it")
+)
+
+// ChallengeStanding is one club's live result in a challenge.
+type ChallengeStanding struct {
+	ClubID   uint
+	ClubName string
+	CheckIns int
+	Members  int
+	Score    float64
+}
+
+func IsValidChallengeMetric(metric string) bool {
+	return metric == ChallengeMetricCheckIns || metric == ChallengeMetricAverageCheckIn
+}
+
+// CreateChallenge proposes a challenge to another club on behalf of an admin
+// of the challenging club and lets the opponent know in their chat. Private
+// clubs can only be challenged by someone who is in them or has a pending
+// invitation to them, and two clubs have at most one pending or running
+// challenge at a time.
+func CreateChallenge(actorID, clubID, opponentClubID uint, metric string, startsAt, endsAt time.Time) (*ClubChallenge, error) {
+	if !IsValidChallengeMetric(metric) {
+		return nil, ErrInvalidChallengeMetric
+	}
+	if clubID == opponentClubID {
+		return nil, ErrChallengeSelf
+	}
+
+	challenge := ClubChallenge{
+		ChallengerClubID: clubID,
+		OpponentClubID:   opponentClubID,
+		Metric:           metric,
+		Status:           ChallengePending,
+		StartsAt:         startsAt,
+		EndsAt:           endsAt,
+		CreatedBy:        actorID,
+		CreatedAt:        time.Now(),
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionEditClub); err != nil {
+			return err
+		}
+		challenger, err := activeClubTx(tx, clubID)
+		if err != nil {
+			return err
+		}
+		opponent, err := activeClubTx(tx, opponentClubID)
+		if err != nil {
+			return err
+		}
+		if opponent.IsPrivate {
+			if err := requireInvitedToClubTx(tx, actorID, opponent.ID); err != nil {
+				return err
+			}
+		}
+
+		// Lock the pair, through the lower club ID, so concurrent proposals
+		// between the same clubs can't both pass the check below.
+		lockID := min(clubID, opponentClubID)
+		if err := tx.Model(&Club{}).Where("id = ?", lockID).Update("name", gorm.Expr("name")).Error; err != nil {
+			return err
+		}
+		var count int64
+		err = tx.Model(&ClubChallenge{}).
+			Where("((challenger_club_id = ? AND opponent_club_id = ?) OR (challenger_club_id = ? AND opponent_club_id = ?)) AND status IN ?",
+				clubID, opponentClubID, opponentClubID, clubID, []string{ChallengePending, ChallengeAccepted}).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrChallengeExists
+		}
+
+		if err := tx.Create(&challenge).Error; err != nil {
+			return err
+		}
+		return postSystemMessageTx(tx, actorID, opponent.ID,
+			fmt.Sprintf("%s challenged this club to %s from %s to %s.", challenger.Name, challengeMetricLabel(metric),
+				startsAt.UTC().Format(time.RFC1123), endsAt.UTC().Format(time.RFC1123)), challenge.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// GetChallengesForClub returns the challenges the club takes part in,
+// newest first.
+func GetChallengesForClub(clubID uint) ([]ClubChallenge, error) {
+	var challenges []ClubChallenge
+
+	err := db.DB.
+		Where("challenger_club_id = ? OR opponent_club_id = ?", clubID, clubID).
+		Order("created_at DESC").
+		Find(&challenges).Error
+
+	return challenges, err
+}
+
+// GetChallenge returns a challenge the club takes part in.
+func GetChallenge(clubID, challengeID uint) (*ClubChallenge, error) {
+	return getChallengeTx(db.DB, clubID, challengeID)
+}
+
+func getChallengeTx(tx *gorm.DB, clubID, challengeID uint) (*ClubChallenge, error) {
+	var challenge ClubChallenge
+
+	err := tx.
+		Where("id = ? AND (challenger_club_id = ? OR opponent_club_id = ?)", challengeID, clubID, clubID).
+		First(&challenge).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// AcceptChallenge starts a pending challenge on behalf of an admin of the
+// opponent club and announces it in both clubs.
+func AcceptChallenge(actorID, clubID, challengeID uint) (*ClubChallenge, error) {
+	return respondToChallenge(actorID, clubID, challengeID, ChallengeAccepted)
+}
+
+func DeclineChallenge(actorID, clubID, challengeID uint) (*ClubChallenge, error) {
+	return respondToChallenge(actorID, clubID, challengeID, ChallengeDeclined)
+}
+
+func respondToChallenge(actorID, clubID, challengeID uint, status string) (*ClubChallenge, error) {
+	var challenge *ClubChallenge
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionEditClub); err != nil {
+			return err
+		}
+		var err error
+		if challenge, err = getChallengeTx(tx, clubID, challengeID); err != nil {
+			return err
+		}
+		if challenge.OpponentClubID != clubID || challenge.Status != ChallengePending {
+			return ErrChallengeNotFound
+		}
+
+		opponent, err := activeClubTx(tx, clubID)
+		if err != nil {
+			return err
+		}
+		if status == ChallengeAccepted && !challenge.EndsAt.After(time.Now()) {
+			return ErrChallengeEnded
+		}
+
+		if err := setChallengeStatusTx(tx, challenge, ChallengePending, status, &actorID); err != nil {
+			return err
+		}
+
+		text := fmt.Sprintf("%s declined the challenge.", opponent.Name)
+		if status == ChallengeAccepted {
+			text = fmt.Sprintf("%s accepted the challenge. It runs until %s.", opponent.Name, challenge.EndsAt.UTC().Format(time.RFC1123))
+		}
+		return announceChallengeTx(tx, actorID, clubID, challenge, text)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// CancelChallenge withdraws a pending challenge on behalf of an admin of the
+// challenging club.
+func CancelChallenge(actorID, clubID, challengeID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionEditClub); err != nil {
+			return err
+		}
+		challenge, err := getChallengeTx(tx, clubID, challengeID)
+		if err != nil {
+			return err
+		}
+		if challenge.ChallengerClubID != clubID || challenge.Status != ChallengePending {
+			return ErrChallengeNotFound
+		}
+		return setChallengeStatusTx(tx, challenge, ChallengePending, ChallengeCancelled, nil)
+	})
+}
+
+// setChallengeStatusTx moves the challenge from one status to another,
+// failing if someone else changed it in the meantime.
+func setChallengeStatusTx(tx *gorm.DB, challenge *ClubChallenge, from, to string, respondedBy *uint) error {
+	updates := map[string]interface{}{"status": to}
+	if respondedBy != nil {
+		updates["responded_by"] = *respondedBy
+	}
+
+	result := tx.Model(&ClubChallenge{}).
+		Where("id = ? AND status = ?", challenge.ID, from).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrChallengeNotFound
+	}
+
+	challenge.Status = to
+	if respondedBy != nil {
+		challenge.RespondedBy = respondedBy
+	}
+	return nil
+}
+
+// GetChallengeStandings computes both clubs' results from the check-ins
+// logged during the challenge, challenger first.
+func GetChallengeStandings(challenge *ClubChallenge) ([]ChallengeStanding, error) {
+	return challengeStandingsTx(db.DB, challenge)
+}
+
+func challengeStandingsTx(tx *gorm.DB, challenge *ClubChallenge) ([]ChallengeStanding, error) {
+	standings := make([]ChallengeStanding, 0, 2)
+
+	for _, clubID := range []uint{challenge.ChallengerClubID, challenge.OpponentClubID} {
+		var club Club
+		if err := tx.Select("id", "name").First(&club, clubID).Error; err != nil {
+			return nil, err
+		}
+		standing := ChallengeStanding{ClubID: clubID, ClubName: club.Name}
+
+		var checkIns, members int64
+		err := tx.Model(&ActivityLog{}).
+			Where("club_id = ? AND updated_score > 0 AND created_at >= ? AND created_at < ?", clubID, challenge.StartsAt, challenge.EndsAt).
+			Count(&checkIns).Error
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&Member{}).Where("club_id = ?", clubID).Count(&members).Error; err != nil {
+			return nil, err
+		}
+
+		standing.CheckIns = int(checkIns)
+		standing.Members = int(members)
+		standing.Score = float64(checkIns)
+		if challenge.Metric == ChallengeMetricAverageCheckIn {
+			standing.Score = 0
+			if members > 0 {
+				standing.Score = float64(checkIns) / float64(members)
+			}
+		}
+		standings = append(standings, standing)
+	}
+
+	return standings, nil
+}
+
+// FinishEndedChallenges settles accepted challenges whose period is over and
+// announces the result in both clubs.
+func FinishEndedChallenges(now time.Time) error {
+	var challenges []ClubChallenge
+	err := db.DB.
+		Where("status = ? AND ends_at <= ?", ChallengeAccepted, now).
+		Find(&challenges).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range challenges {
+		challenge := &challenges[i]
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			standings, err := challengeStandingsTx(tx, challenge)
+			if err != nil {
+				return err
+			}
+			if err := setChallengeStatusTx(tx, challenge, ChallengeAccepted, ChallengeFinished, nil); err != nil {
+				return err
+			}
+
+			challenger, opponent := standings[0], standings[1]
+			var text string
+			switch {
+			case challenger.Score > opponent.Score:
+				challenge.WinnerClubID = &challenger.ClubID
+				text = fmt.Sprintf("%s won the challenge against %s, %s to %s.", challenger.ClubName, opponent.ClubName,
+					formatChallengeScore(challenge, challenger.Score), formatChallengeScore(challenge, opponent.Score))
+			case opponent.Score > challenger.Score:
+				challenge.WinnerClubID = &opponent.ClubID
+				text = fmt.Sprintf("%s won the challenge against %s, %s to %s.", opponent.ClubName, challenger.ClubName,
+					formatChallengeScore(challenge, opponent.Score), formatChallengeScore(challenge, challenger.Score))
+			default:
+				text = fmt.Sprintf("The challenge between %s and %s ended in a draw at %s.", challenger.ClubName, opponent.ClubName,
+					formatChallengeScore(challenge, challenger.Score))
+			}
+
+			if err := tx.Model(challenge).Update("winner_club_id", challenge.WinnerClubID).Error; err != nil {
+				return err
+			}
+			return announceChallengeTx(tx, challenge.CreatedBy, challenge.ChallengerClubID, challenge, text)
+		})
+		if errors.Is(err, ErrChallengeNotFound) {
+			// Finished by another instance.
+			continue
+		}
+		if err != nil {
+			logger.LogError("Failed to finish challenge", challenge.ID, ":", err)
+		}
+	}
+	return nil
+}
+
+// announceChallengeTx posts text in the chat of both clubs. Only the club
+// userID acted for gets an activity log entry, since they are not a member
+// of the other one.
+func announceChallengeTx(tx *gorm.DB, userID, userClubID uint, challenge *ClubChallenge, text string) error {
+	for _, clubID := range []uint{challenge.ChallengerClubID, challenge.OpponentClubID} {
+		var err error
+		if clubID == userClubID {
+			err = logClubEventTx(tx, userID, clubID, ActionChallenge, text)
+		} else {
+			err = postSystemMessageTx(tx, userID, clubID, text, time.Now())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requireInvitedToClubTx returns ErrChallengePrivateClub unless the user is
+// a member of the club or has a pending invitation to it.
+func requireInvitedToClubTx(tx *gorm.DB, userID, clubID uint) error {
+	var count int64
+	if err := tx.Model(&Member{}).Where("user_id = ? AND club_id = ?", userID, clubID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	err := tx.Model(&ClubInvitation{}).
+		Where("invitee_id = ? AND club_id = ? AND status = ?", userID, clubID, InvitationPending).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrChallengePrivateClub
+	}
+	return nil
+}
+
+func activeClubTx(tx *gorm.DB, clubID uint) (*Club, error) {
+	var club Club
+	if err := tx.First(&club, clubID).Error; err != nil {
+		return nil, err
+	}
+	if club.ArchivedAt != nil {
+		return nil, ErrClubArchived
+	}
+	return &club, nil
+}
+
+func challengeMetricLabel(metric string) string {
+	if metric == ChallengeMetricAverageCheckIn {
+		return "the most check-ins per member"
+	}
+	return "the most check-ins"
+}
+
+func formatChallengeScore(challenge *ClubChallenge, score float64) string {
+	if challenge.Metric == ChallengeMetricAverageCheckIn {
+		return fmt.Sprintf("%.1f check-ins per member", score)
+	}
+	return fmt.Sprintf("%.0f check-ins", score)
+}
@@ -0,0 +1,406 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"klubRanks/db"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ClubAction is something a club tracks, like runs or gym sessions. Every
+// check-in is for one action and earns Points per unit towards the club
+// leaderboard. Points are credited when the check-in happens, so changing
+// them later does not re-weight earlier check-ins.
+type ClubAction struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	ClubID uint   `gorm:"not null;index" json:"club_id"`
+	Name   string `gorm:"not null" json:"name"`
+	// Shown next to amounts, e.g. "km". Empty for plain counts.
+	Unit            string    `gorm:"not null;default:''" json:"unit"`
+	Points          int       `gorm:"not null;default:1" json:"points"`
+	CooldownMinutes int       `gorm:"not null;default:0" json:"cooldown_minutes"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ActionScore is a member's running total for one action. It backs the
+// per-action leaderboards and cooldowns.
+type ActionScore struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"not null;uniqueIndex:idx_action_scores_user_action" json:"user_id"`
+	ClubID        uint       `gorm:"not null;index" json:"club_id"`
+	ActionID      uint       `gorm:"not null;uniqueIndex:idx_action_scores_user_action;index" json:"action_id"`
+	Amount        int        `gorm:"not null;default:0" json:"amount"`
+	Points        int        `gorm:"not null;default:0" json:"points"`
+	LastCheckedIn *time.Time `gorm:"column:last_checkedin" json:"last_checkedin,omitempty"`
+}
+
+var (
+	ErrClubActionNotFound = errors.New("action not found")
+	ErrClubActionExists   = errors.New("club already has an action with this name")
+	ErrLastClubAction     = errors.New("a club needs at least one action")
+	ErrActionCooldown     = errors.New("this action is still cooling down")
+)
+
+// CheckInResult is what a check-in earned.
+type CheckInResult struct {
+	Action      ClubAction
+	Amount      int
+	Points      int
+	NextCheckIn *time.Time
+	XP          XPResult
+	// Goals the check-in completed for their current period.
+	CompletedGoals []GoalProgress
+}
+
+// NextCheckIn returns when the action can be checked in again after last,
+// or nil if it has no cooldown or was never checked in.
+func (a *ClubAction) NextCheckIn(last *time.Time) *time.Time {
+	if last == nil || a.CooldownMinutes == 0 {
+		return nil
+	}
+	next := last.Add(time.Duration(a.CooldownMinutes) * time.Minute)
+	return &next
+}
+
+func GetClubActions(clubID uint) ([]ClubAction, error) {
+	var actions []ClubAction
+
+	err := db.DB.
+		Where("club_id = ?", clubID).
+		Order("id ASC").
+		Find(&actions).Error
+
+	return actions, err
+}
+
+func GetClubAction(clubID, actionID uint) (*ClubAction, error) {
+	return getClubActionTx(db.DB, clubID, actionID)
+}
+
+func getClubActionTx(tx *gorm.DB, clubID, actionID uint) (*ClubAction, error) {
+	var action ClubAction
+
+	err := tx.Where("id = ? AND club_id = ?", actionID, clubID).First(&action).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrClubActionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &action, nil
+}
+
+// defaultClubActionTx is the club's oldest action, used by check-ins that
+// do not name one.
+func defaultClubActionTx(tx *gorm.DB, clubID uint) (*ClubAction, error) {
+	var action ClubAction
+
+	err := tx.Where("club_id = ?", clubID).Order("id ASC").First(&action).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrClubActionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &action, nil
+}
+
+// CreateClubAction adds an action on behalf of someone who can edit the club.
+func CreateClubAction(actorID uint, action *ClubAction) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, action.ClubID, PermissionEditClub); err != nil {
+			return err
+		}
+		if err := checkActionNameTx(tx, action.ClubID, 0, action.Name); err != nil {
+			return err
+		}
+
+		action.CreatedAt = time.Now()
+		return tx.Create(action).Error
+	})
+}
+
+// UpdateClubAction changes an action's name, unit, weight and cooldown. New
+// weights only apply to future check-ins.
+func UpdateClubAction(actorID uint, action *ClubAction) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, action.ClubID, PermissionEditClub); err != nil {
+			return err
+		}
+		existing, err := getClubActionTx(tx, action.ClubID, action.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkActionNameTx(tx, action.ClubID, action.ID, action.Name); err != nil {
+			return err
+		}
+
+		action.CreatedAt = existing.CreatedAt
+		return tx.Model(existing).Updates(map[string]interface{}{
+			"name":             action.Name,
+			"unit":             action.Unit,
+			"points":           action.Points,
+			"cooldown_minutes": action.CooldownMinutes,
+		}).Error
+	})
+}
+
+// DeleteClubAction removes an action and its per-action leaderboard. Points
+// already earned stay on the combined leaderboard.
+func DeleteClubAction(actorID, clubID, actionID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionEditClub); err != nil {
+			return err
+		}
+		if _, err := getClubActionTx(tx, clubID, actionID); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&ClubAction{}).Where("club_id = ?", clubID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count <= 1 {
+			return ErrLastClubAction
+		}
+
+		if err := tx.Where("action_id = ?", actionID).Delete(&ActionScore{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&ClubAction{}, actionID).Error
+	})
+}
+
+func checkActionNameTx(tx *gorm.DB, clubID, actionID uint, name string) error {
+	var count int64
+	err := tx.Model(&ClubAction{}).
+		Where("club_id = ? AND id <> ? AND LOWER(name) = ?", clubID, actionID, strings.ToLower(name)).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrClubActionExists
+	}
+	return nil
+}
+
+// CheckIn records amount units of an action for a member. actionID 0 means
+// the club's default action. The member earns the action's points per unit
+// on the combined leaderboard, the amount on the action's own one and XP by
+// xpRules, and completes the goals it reaches.
+func CheckIn(userID, clubID, actionID uint, amount int, xpRules XPRules) (*CheckInResult, error) {
+	var result CheckInResult
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var action *ClubAction
+		var err error
+		if actionID == 0 {
+			action, err = defaultClubActionTx(tx, clubID)
+		} else {
+			action, err = getClubActionTx(tx, clubID, actionID)
+		}
+		if err != nil {
+			return err
+		}
+
+		var entry LeaderboardEntry
+		if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).First(&entry).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotClubMember
+			}
+			return err
+		}
+
+		score := ActionScore{UserID: userID, ClubID: clubID, ActionID: action.ID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&score).Error; err != nil {
+			return err
+		}
+
+		// The cooldown is checked by the update itself so concurrent
+		// check-ins can't both get through.
+		now := time.Now()
+		points := amount * action.Points
+		update := tx.Model(&ActionScore{}).
+			Where("user_id = ? AND action_id = ?", userID, action.ID)
+		if action.CooldownMinutes > 0 {
+			cutoff := now.Add(-time.Duration(action.CooldownMinutes) * time.Minute)
+			update = update.Where("last_checkedin IS NULL OR last_checkedin <= ?", cutoff)
+		}
+		updated := update.UpdateColumns(map[string]interface{}{
+			"amount":         gorm.Expr("amount + ?", amount),
+			"points":         gorm.Expr("points + ?", points),
+			"last_checkedin": now,
+		})
+		if updated.Error != nil {
+			return updated.Error
+		}
+		if updated.RowsAffected == 0 {
+			return ErrActionCooldown
+		}
+
+		advanceStreak(&entry, now)
+		err = tx.Model(&entry).UpdateColumns(map[string]interface{}{
+			"score":          gorm.Expr("score + ?", points),
+			"current_streak": entry.CurrentStreak,
+			"longest_streak": entry.LongestStreak,
+			"last_checkedin": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		log := ActivityLog{
+			UserID:       userID,
+			ClubID:       clubID,
+			ActionID:     &action.ID,
+			Action:       ActionCheckIn,
+			Amount:       amount,
+			UpdatedScore: points,
+			CreatedAt:    now,
+		}
+		if err := tx.Create(&log).Error; err != nil {
+			return err
+		}
+
+		message := Message{
+			UserID:    userID,
+			ClubID:    clubID,
+			Message:   fmt.Sprintf("%s logged %s (+%d points).", mention(userID), formatActionAmount(action, amount), points),
+			Timestamp: now,
+			Type:      MessageTypeSystem,
+		}
+		if err := tx.Create(&message).Error; err != nil {
+			return err
+		}
+
+		xp, err := awardXPTx(tx, userID, clubID, xpRules, now)
+		if err != nil {
+			return err
+		}
+		goals, err := completeGoalsTx(tx, userID, clubID, now)
+		if err != nil {
+			return err
+		}
+
+		result = CheckInResult{
+			Action:         *action,
+			Amount:         amount,
+			Points:         points,
+			NextCheckIn:    action.NextCheckIn(&now),
+			XP:             *xp,
+			CompletedGoals: goals,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func formatActionAmount(action *ClubAction, amount int) string {
+	if action.Unit == "" {
+		return fmt.Sprintf("%d %s", amount, action.Name)
+	}
+	return fmt.Sprintf("%d %s of %s", amount, action.Unit, action.Name)
+}
+
+// GetActionLeaderboard ranks the club's members by their total amount for
+// one action.
+func GetActionLeaderboard(clubID, actionID uint, limit int) ([]ActionScore, error) {
+	var scores []ActionScore
+
+	err := db.DB.
+		Where("club_id = ? AND action_id = ? AND amount > 0", clubID, actionID).
+		Order("amount DESC, last_checkedin ASC").
+		Limit(limit).
+		Find(&scores).Error
+
+	return scores, err
+}
+
+// GetClubActionsForClubs loads the actions of several clubs, keyed by club
+// ID, in the same order as GetClubActions.
+func GetClubActionsForClubs(clubIDs []uint) (map[uint][]ClubAction, error) {
+	var actions []ClubAction
+
+	err := db.DB.
+		Where("club_id IN ?", clubIDs).
+		Order("id ASC").
+		Find(&actions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byClub := make(map[uint][]ClubAction, len(clubIDs))
+	for _, action := range actions {
+		byClub[action.ClubID] = append(byClub[action.ClubID], action)
+	}
+	return byClub, nil
+}
+
+// GetActionScoresForUser returns the member's totals in one club, or in all
+// clubs when clubID is 0, keyed by action ID.
+func GetActionScoresForUser(userID, clubID uint) (map[uint]ActionScore, error) {
+	var scores []ActionScore
+
+	query := db.DB.Where("user_id = ?", userID)
+	if clubID != 0 {
+		query = query.Where("club_id = ?", clubID)
+	}
+	if err := query.Find(&scores).Error; err != nil {
+		return nil, err
+	}
+
+	byAction := make(map[uint]ActionScore, len(scores))
+	for _, s := range scores {
+		byAction[s.ActionID] = s
+	}
+	return byAction, nil
+}
+
+// BackfillClubActions gives clubs created before actions existed a default
+// action named after Club.Action. Those clubs never enforced a cooldown, so
+// the action gets none.
+func BackfillClubActions(points int) error {
+	var clubs []Club
+	err := db.DB.
+		Where("NOT EXISTS (SELECT 1 FROM club_actions WHERE club_actions.club_id = clubs.id)").
+		Find(&clubs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, club := range clubs {
+		name := club.Action
+		if name == "" {
+			name = "check-in"
+		}
+		action := ClubAction{
+			ClubID:    club.ID,
+			Name:      name,
+			Points:    points,
+			CreatedAt: club.CreatedAt,
+		}
+		if err := db.DB.Create(&action).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillCheckInActions renames check-ins logged under their club action's
+// name to ActionCheckIn.
+func BackfillCheckInActions() error {
+	return db.DB.
+		Model(&ActivityLog{}).
+		Where("action_id IS NOT NULL AND action <> ?", ActionCheckIn).
+		Update("action", ActionCheckIn).
+		Error
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"klubRanks/db"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+var testXPRules = XPRules{PerCheckIn: 10, DailyDecay: 0.5, LevelBase: 100, LevelGrowth: 1.5}
+
+func setupModelTest(t *testing.T) {
+	t.Helper()
+
+	var err error
+	db.DB, err = gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	err = db.DB.AutoMigrate(
+		&User{},
+		&Club{},
+		&Member{},
+		&LeaderboardEntry{},
+		&Message{},
+		&ActivityLog{},
+		&ClubBan{},
+		&ClubInvite{},
+		&ClubAction{},
+		&ActionScore{},
+		&Goal{},
+		&ClubTag{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createTestUser(t *testing.T, username string) uint {
+	t.Helper()
+
+	user := User{Username: username, CreatedAt: time.Now()}
+	if err := db.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+// createTestClub creates a club owned by ownerID with the given actions, the
+// first being the default one.
+func createTestClub(t *testing.T, ownerID uint, actions ...ClubAction) (*Club, []ClubAction) {
+	t.Helper()
+
+	club := Club{
+		Name:      fmt.Sprintf("club of %d", ownerID),
+		Action:    actions[0].Name,
+		CreatedBy: ownerID,
+		Actions:   actions,
+	}
+	if err := club.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddUserToLeaderboard(ownerID, club.ID); err != nil {
+		t.Fatal(err)
+	}
+	return &club, club.Actions
+}
+
+func TestCheckInEnforcesCooldown(t *testing.T) {
+	setupModelTest(t)
+
+	userID := createTestUser(t, "alice")
+	club, actions := createTestClub(t, userID,
+		ClubAction{Name: "run", Points: 1, CooldownMinutes: 30},
+		ClubAction{Name: "stretch", Points: 1},
+	)
+	run, stretch := actions[0], actions[1]
+
+	result, err := CheckIn(userID, club.ID, run.ID, 1, testXPRules)
+	if err != nil {
+		t.Fatalf("first check-in: %v", err)
+	}
+	if result.NextCheckIn == nil || result.NextCheckIn.Before(time.Now().Add(29*time.Minute)) {
+		t.Errorf("next check-in = %v, want about 30 minutes from now", result.NextCheckIn)
+	}
+
+	if _, err := CheckIn(userID, club.ID, run.ID, 1, testXPRules); !errors.Is(err, ErrActionCooldown) {
+		t.Errorf("check-in within the cooldown: got %v, want %v", err, ErrActionCooldown)
+	}
+
+	// Actions cool down independently, and ones without a cooldown never do.
+	for i := 0; i < 2; i++ {
+		if _, err := CheckIn(userID, club.ID, stretch.ID, 1, testXPRules); err != nil {
+			t.Errorf("check-in %d for an action without cooldown: %v", i+1, err)
+		}
+	}
+
+	err = db.DB.Model(&ActionScore{}).
+		Where("user_id = ? AND action_id = ?", userID, run.ID).
+		Update("last_checkedin", time.Now().Add(-31*time.Minute)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckIn(userID, club.ID, run.ID, 1, testXPRules); err != nil {
+		t.Errorf("check-in after the cooldown: %v", err)
+	}
+
+	var logs int64
+	db.DB.Model(&ActivityLog{}).Where("user_id = ? AND action = ?", userID, ActionCheckIn).Count(&logs)
+	if logs != 4 {
+		t.Errorf("logged %d check-ins, want 4", logs)
+	}
+}
+
+func TestCheckInRequiresMembership(t *testing.T) {
+	setupModelTest(t)
+
+	ownerID := createTestUser(t, "alice")
+	outsiderID := createTestUser(t, "bob")
+	club, _ := createTestClub(t, ownerID, ClubAction{Name: "run", Points: 1})
+
+	if _, err := CheckIn(outsiderID, club.ID, 0, 1, testXPRules); !errors.Is(err, ErrNotClubMember) {
+		t.Errorf("check-in by a non-member: got %v, want %v", err, ErrNotClubMember)
+	}
+
+	var scores int64
+	db.DB.Model(&ActionScore{}).Where("user_id = ?", outsiderID).Count(&scores)
+	if scores != 0 {
+		t.Error("a non-member's check-in left an action score behind")
+	}
+}
+
+func TestCheckInEarnsPointsPerUnit(t *testing.T) {
+	setupModelTest(t)
+
+	userID := createTestUser(t, "alice")
+	club, actions := createTestClub(t, userID,
+		ClubAction{Name: "run", Points: 1},
+		ClubAction{Name: "swim", Unit: "km", Points: 3},
+	)
+	swim := actions[1]
+
+	result, err := CheckIn(userID, club.ID, swim.ID, 4, testXPRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Points != 12 || result.Amount != 4 {
+		t.Errorf("check-in earned %d points for %d units, want 12 for 4", result.Points, result.Amount)
+	}
+
+	entry, err := GetLeaderboardEntryForUser(userID, club.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Score != 12 {
+		t.Errorf("leaderboard score = %d, want 12", entry.Score)
+	}
+
+	scores, err := GetActionScoresForUser(userID, club.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := scores[swim.ID]; s.Amount != 4 || s.Points != 12 {
+		t.Errorf("action score = %d units and %d points, want 4 and 12", s.Amount, s.Points)
+	}
+}
+
+func TestCheckInDefaultsToOldestAction(t *testing.T) {
+	setupModelTest(t)
+
+	userID := createTestUser(t, "alice")
+	club, actions := createTestClub(t, userID,
+		ClubAction{Name: "run", Points: 2},
+		ClubAction{Name: "swim", Points: 5},
+	)
+
+	result, err := CheckIn(userID, club.ID, 0, 1, testXPRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Action.ID != actions[0].ID || result.Points != 2 {
+		t.Errorf("check-in without an action used %q for %d points, want run for 2", result.Action.Name, result.Points)
+	}
+}
+
+func TestDeleteClubActionKeepsLastAction(t *testing.T) {
+	setupModelTest(t)
+
+	ownerID := createTestUser(t, "alice")
+	club, actions := createTestClub(t, ownerID,
+		ClubAction{Name: "run", Points: 1},
+		ClubAction{Name: "swim", Points: 1},
+	)
+
+	if err := DeleteClubAction(ownerID, club.ID, actions[1].ID); err != nil {
+		t.Fatalf("deleting one of two actions: %v", err)
+	}
+	if err := DeleteClubAction(ownerID, club.ID, actions[0].ID); !errors.Is(err, ErrLastClubAction) {
+		t.Errorf("deleting the last action: got %v, want %v", err, ErrLastClubAction)
+	}
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"klubRanks/db"
+
+	"gorm.io/gorm"
+)
+
+type ClubBan struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	ClubID    uint       `gorm:"not null;uniqueIndex:idx_club_bans_club_user" json:"club_id"`
+	UserID    uint       `gorm:"not null;uniqueIndex:idx_club_bans_club_user" json:"user_id"`
+	BannedBy  uint       `gorm:"not null" json:"banned_by"`
+	Reason    *string    `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+const (
+	ActionKicked   = "kicked"
+	ActionBanned   = "banned"
+	ActionUnbanned = "unbanned"
+)
+
+var (
+	ErrBannedFromClub         = errors.New("you are banned from this club")
+	ErrNotBanned              = errors.New("user is not banned from the club")
+	ErrMemberActionForbidden  = errors.New("you can only remove members ranked below you")
+	ErrCannotModerateYourself = errors.New("you cannot kick or ban yourself")
+)
+
+// IsBannedFromClub reports whether the user has a ban that has not expired.
+func IsBannedFromClub(userID, clubID uint) (bool, error) {
+	return isBannedFromClubTx(db.DB, userID, clubID)
+}
+
+func isBannedFromClubTx(tx *gorm.DB, userID, clubID uint) (bool, error) {
+	var count int64
+	err := tx.
+		Model(&ClubBan{}).
+		Where("user_id = ? AND club_id = ? AND (expires_at IS NULL OR expires_at > ?)", userID, clubID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetClubBans returns the active bans of a club, newest first.
+func GetClubBans(clubID uint) ([]ClubBan, error) {
+	var bans []ClubBan
+
+	err := db.DB.
+		Where("club_id = ? AND (expires_at IS NULL OR expires_at > ?)", clubID, time.Now()).
+		Order("created_at DESC").
+		Find(&bans).Error
+
+	return bans, err
+}
+
+// KickMember removes a member the same way RemoveMember does, on behalf of
+// an admin. They can rejoin with the invite code.
+func KickMember(actorID, targetUserID, clubID uint) error {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		actor, target, err := moderationPartiesTx(tx, actorID, targetUserID, clubID)
+		if err != nil {
+			return err
+		}
+		if target == nil {
+			return ErrNotClubMember
+		}
+
+		if err := removeMemberTx(tx, targetUserID, clubID); err != nil {
+			return err
+		}
+		return logClubEventTx(tx, targetUserID, clubID, ActionKicked,
+			fmt.Sprintf("%s was removed from the club by %s.", mention(targetUserID), mention(actor.UserID)))
+	})
+	if err != nil {
+		return err
+	}
+
+	admitFromWaitlistAfterLeave(clubID)
+	return nil
+}
+
+// BanMember removes the user from the club if they are a member and stops
+// them from rejoining until the ban expires or is lifted. Banning an already
+// banned user replaces the reason and expiry.
+func BanMember(actorID, targetUserID, clubID uint, reason *string, expiresAt *time.Time) (*ClubBan, error) {
+	ban := ClubBan{
+		ClubID:    clubID,
+		UserID:    targetUserID,
+		BannedBy:  actorID,
+		Reason:    reason,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	freedSeat := false
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		actor, target, err := moderationPartiesTx(tx, actorID, targetUserID, clubID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Select("id").First(&User{}, targetUserID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ? AND club_id = ?", targetUserID, clubID).Delete(&ClubBan{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&ban).Error; err != nil {
+			return err
+		}
+
+		if target != nil {
+			if err := removeMemberTx(tx, targetUserID, clubID); err != nil {
+				return err
+			}
+			freedSeat = true
+		}
+		if err := tx.Where("user_id = ? AND club_id = ?", targetUserID, clubID).Delete(&ClubWaitlistEntry{}).Error; err != nil {
+			return err
+		}
+
+		text := fmt.Sprintf("%s was banned from the club by %s", mention(targetUserID), mention(actor.UserID))
+		if expiresAt != nil {
+			text += " until " + expiresAt.UTC().Format(time.RFC1123)
+		}
+		if reason != nil && *reason != "" {
+			text += ": " + *reason
+		}
+		return logClubEventTx(tx, targetUserID, clubID, ActionBanned, text+".")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if freedSeat {
+		admitFromWaitlistAfterLeave(clubID)
+	}
+	return &ban, nil
+}
+
+// UnbanMember lifts a ban so the user can rejoin with the invite code.
+func UnbanMember(actorID, targetUserID, clubID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var actor Member
+		if err := tx.Where("user_id = ? AND club_id = ?", actorID, clubID).First(&actor).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotClubMember
+			}
+			return err
+		}
+		if !RoleHasPermission(actor.Role, PermissionManageMembers) {
+			return ErrMemberActionForbidden
+		}
+
+		result := tx.Where("user_id = ? AND club_id = ?", targetUserID, clubID).Delete(&ClubBan{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotBanned
+		}
+
+		return logClubEventTx(tx, targetUserID, clubID, ActionUnbanned,
+			fmt.Sprintf("%s was unbanned by %s.", mention(targetUserID), mention(actor.UserID)))
+	})
+}
+
+// moderationPartiesTx loads the acting admin and, if they are a member, the
+// target, and checks the actor may remove the target. target is nil when the
+// user is not a member of the club.
+func moderationPartiesTx(tx *gorm.DB, actorID, targetUserID, clubID uint) (*Member, *Member, error) {
+	if actorID == targetUserID {
+		return nil, nil, ErrCannotModerateYourself
+	}
+
+	var actor Member
+	if err := tx.Where("user_id = ? AND club_id = ?", actorID, clubID).First(&actor).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrNotClubMember
+		}
+		return nil, nil, err
+	}
+	if !RoleHasPermission(actor.Role, PermissionManageMembers) {
+		return nil, nil, ErrMemberActionForbidden
+	}
+
+	var target Member
+	err := tx.Where("user_id = ? AND club_id = ?", targetUserID, clubID).First(&target).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &actor, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if roleRanks[target.Role] >= roleRanks[actor.Role] {
+		return nil, nil, ErrMemberActionForbidden
+	}
+	return &actor, &target, nil
+}
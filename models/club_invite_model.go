@@ -0,0 +1,335 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"klubRanks/db"
+
+	"gorm.io/gorm"
+)
+
+// ClubInvite is a join code for a club. Every club has a default invite
+// whose code is mirrored in Club.Code; admins can add more with an expiry,
+// a usage limit or a different role on join.
+type ClubInvite struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	ClubID    uint       `gorm:"not null;index" json:"club_id"`
+	Code      string     `gorm:"not null;uniqueIndex" json:"code"`
+	Role      string     `gorm:"not null;default:member" json:"role"`
+	CreatedBy uint       `gorm:"not null" json:"created_by"`
+	MaxUses   *int       `json:"max_uses,omitempty"`
+	Uses      int        `gorm:"not null;default:0" json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+const (
+	inviteCodeBytes    = 5 // 8 base32 characters
+	inviteCodeAttempts = 5
+)
+
+var (
+	ErrInviteInvalid  = errors.New("invite code is invalid, expired or used up")
+	ErrInviteNotFound = errors.New("invite not found")
+	ErrInviteRevoked  = errors.New("invite has already been revoked")
+	ErrInviteRole     = errors.New("invites can only grant a role below yours")
+)
+
+// IsUsable reports whether the invite can still be used to join.
+func (i *ClubInvite) IsUsable(now time.Time) bool {
+	return i.RevokedAt == nil &&
+		(i.ExpiresAt == nil || i.ExpiresAt.After(now)) &&
+		(i.MaxUses == nil || i.Uses < *i.MaxUses)
+}
+
+func generateInviteCode() (string, error) {
+	b := make([]byte, inviteCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+// withUniqueInviteCodeTx calls create with fresh codes until it stores one
+// without hitting the unique index on club or invite codes. Each attempt
+// runs in a savepoint so a clash doesn't abort tx.
+func withUniqueInviteCodeTx(tx *gorm.DB, create func(tx *gorm.DB, code string) error) error {
+	for i := 0; i < inviteCodeAttempts; i++ {
+		code, err := generateInviteCode()
+		if err != nil {
+			return err
+		}
+
+		err = tx.Transaction(func(tx *gorm.DB) error {
+			return create(tx, code)
+		})
+		if !db.IsUniqueViolation(err) {
+			return err
+		}
+	}
+	return errors.New("could not generate a unique invite code")
+}
+
+func getUsableInvite(code string) (*ClubInvite, error) {
+	var invite ClubInvite
+
+	err := db.DB.Where("code = ?", code).First(&invite).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInviteInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !invite.IsUsable(time.Now()) {
+		return nil, ErrInviteInvalid
+	}
+	return &invite, nil
+}
+
+// useInviteTx counts a use of the invite, failing if it ran out in the
+// meantime.
+func useInviteTx(tx *gorm.DB, invite *ClubInvite) error {
+	result := tx.Model(&ClubInvite{}).
+		Where("id = ? AND revoked_at IS NULL AND (max_uses IS NULL OR uses < max_uses)", invite.ID).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteInvalid
+	}
+	return nil
+}
+
+// GetClubInvites returns all invites of a club, newest first, including
+// revoked and expired ones so admins can see their usage.
+func GetClubInvites(clubID uint) ([]ClubInvite, error) {
+	var invites []ClubInvite
+
+	err := db.DB.
+		Where("club_id = ?", clubID).
+		Order("created_at DESC").
+		Find(&invites).Error
+
+	return invites, err
+}
+
+// CreateClubInvite adds an invite on behalf of an admin. role must be below
+// the admin's own role.
+func CreateClubInvite(actorID, clubID uint, role string, maxUses *int, expiresAt *time.Time) (*ClubInvite, error) {
+	if !IsValidRole(role) || role == RoleOwner {
+		return nil, ErrInvalidRole
+	}
+
+	invite := ClubInvite{
+		ClubID:    clubID,
+		Role:      role,
+		CreatedBy: actorID,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireInviteManagerTx(tx, actorID, clubID, role); err != nil {
+			return err
+		}
+
+		return withUniqueInviteCodeTx(tx, func(tx *gorm.DB, code string) error {
+			invite.ID = 0
+			invite.Code = code
+			return tx.Create(&invite).Error
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// RevokeClubInvite stops an invite from being used. Revoking the default
+// invite leaves the club without a permanent code until it is regenerated.
+func RevokeClubInvite(actorID, clubID, inviteID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		invite, err := getClubInviteTx(tx, clubID, inviteID)
+		if err != nil {
+			return err
+		}
+		if err := requireInviteManagerTx(tx, actorID, clubID, invite.Role); err != nil {
+			return err
+		}
+		if invite.RevokedAt != nil {
+			return ErrInviteRevoked
+		}
+		return tx.Model(invite).Update("revoked_at", time.Now()).Error
+	})
+}
+
+// RegenerateClubInvite revokes an invite and replaces it with a fresh code
+// with the same role, limit and remaining lifetime. Regenerating the default
+// invite also updates Club.Code.
+func RegenerateClubInvite(actorID, clubID, inviteID uint) (*ClubInvite, error) {
+	var replacement ClubInvite
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		invite, err := getClubInviteTx(tx, clubID, inviteID)
+		if err != nil {
+			return err
+		}
+		if err := requireInviteManagerTx(tx, actorID, clubID, invite.Role); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if invite.RevokedAt == nil {
+			if err := tx.Model(invite).Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+		}
+
+		return withUniqueInviteCodeTx(tx, func(tx *gorm.DB, code string) error {
+			replacement = ClubInvite{
+				ClubID:    clubID,
+				Code:      code,
+				Role:      invite.Role,
+				CreatedBy: actorID,
+				MaxUses:   invite.MaxUses,
+				ExpiresAt: invite.ExpiresAt,
+				CreatedAt: now,
+			}
+			if err := tx.Create(&replacement).Error; err != nil {
+				return err
+			}
+
+			return tx.Model(&Club{}).
+				Where("id = ? AND code = ?", clubID, invite.Code).
+				Update("code", replacement.Code).Error
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &replacement, nil
+}
+
+func getClubInviteTx(tx *gorm.DB, clubID, inviteID uint) (*ClubInvite, error) {
+	var invite ClubInvite
+
+	err := tx.Where("id = ? AND club_id = ?", inviteID, clubID).First(&invite).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInviteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// requireInviteManagerTx checks the actor can manage members and outranks
+// the role the invite grants.
+func requireInviteManagerTx(tx *gorm.DB, actorID, clubID uint, role string) error {
+	var actor Member
+	if err := tx.Where("user_id = ? AND club_id = ?", actorID, clubID).First(&actor).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotClubMember
+		}
+		return err
+	}
+	if !RoleHasPermission(actor.Role, PermissionManageMembers) {
+		return ErrPermissionDenied
+	}
+	if roleRanks[role] >= roleRanks[actor.Role] {
+		return ErrInviteRole
+	}
+	return nil
+}
+
+// DedupeClubCodes gives clubs that share a legacy code with an older club a
+// fresh code, so the unique index on Club.Code can be created. It has to run
+// before the migration adds the index, which is why it checks for clashes by
+// hand.
+func DedupeClubCodes() error {
+	if !db.DB.Migrator().HasTable(&Club{}) || db.DB.Migrator().HasIndex(&Club{}, "Code") {
+		return nil
+	}
+
+	var clubs []Club
+	err := db.DB.
+		Select("id", "code").
+		Where("EXISTS (SELECT 1 FROM clubs older WHERE older.code = clubs.code AND older.id < clubs.id)").
+		Order("id ASC").
+		Find(&clubs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, club := range clubs {
+		for {
+			code, err := generateInviteCode()
+			if err != nil {
+				return err
+			}
+			var count int64
+			if err := db.DB.Model(&Club{}).Where("code = ?", code).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			if err := db.DB.Model(&club).Update("code", code).Error; err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// BackfillClubInvites creates the default invite for clubs created before
+// invites existed. Clubs whose legacy code collides with another club's
+// invite get a fresh code.
+func BackfillClubInvites() error {
+	var clubs []Club
+	err := db.DB.
+		Where("NOT EXISTS (SELECT 1 FROM club_invites WHERE club_invites.club_id = clubs.id)").
+		Order("id ASC").
+		Find(&clubs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, club := range clubs {
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			invite := ClubInvite{
+				ClubID:    club.ID,
+				Code:      club.Code,
+				Role:      RoleMember,
+				CreatedBy: club.CreatedBy,
+				CreatedAt: club.CreatedAt,
+			}
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				return tx.Create(&invite).Error
+			})
+			if !db.IsUniqueViolation(err) {
+				return err
+			}
+
+			return withUniqueInviteCodeTx(tx, func(tx *gorm.DB, code string) error {
+				if err := tx.Model(&club).Update("code", code).Error; err != nil {
+					return err
+				}
+				invite.ID = 0
+				invite.Code = code
+				return tx.Create(&invite).Error
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
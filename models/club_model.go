@@ -1,8 +1,6 @@
 package models
 
 import (
-	"crypto/sha256"
-	"encoding/base32"
 	"errors"
 	"fmt"
 	"strings"
@@ -15,16 +13,28 @@ import (
 )
 
 type Club struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	CreatedBy   uint      `gorm:"not null" json:"created_by"`
-	IsPrivate   bool      `json:"is_private"`
-	Code        string    `gorm:"not null" json:"code"`
-	Name        string    `gorm:"not null" json:"name"`
-	Description *string   `json:"description,omitempty"`
-	Action      string    `gorm:"not null" json:"action"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	CreatedBy   uint    `gorm:"not null" json:"created_by"`
+	IsPrivate   bool    `json:"is_private"`
+	Code        string  `gorm:"not null;uniqueIndex" json:"code"`
+	Name        string  `gorm:"not null" json:"name"`
+	Description *string `json:"description,omitempty"`
+	Action      string  `gorm:"not null" json:"action"`
+	// Comma separated, lowercase. Used for discovery of public clubs.
+	Tags string `gorm:"not null;default:''" json:"tags"`
+	// Nil means unlimited. Joins beyond it go to the waitlist.
+	MaxMembers *int `json:"max_members,omitempty"`
+	// Whether members pick their own team, and how team scores add up.
+	TeamSelfSelect bool      `gorm:"not null;default:false" json:"team_self_select"`
+	TeamScoring    string    `gorm:"not null;default:sum" json:"team_scoring"`
+	TeamTopN       *int      `json:"team_top_n,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	// Archived clubs are read-only: no check-ins, chat or new members.
+	ArchivedAt *time.Time `gorm:"index" json:"archived_at,omitempty"`
 
 	Members []Member `gorm:"foreignKey:ClubID"`
+	// Created along with the club by Save.
+	Actions []ClubAction `gorm:"foreignKey:ClubID"`
 }
 
 type Member struct {
@@ -32,69 +42,80 @@ type Member struct {
 	UserID   uint      `gorm:"not null" json:"user_id"`
 	ClubID   uint      `gorm:"not null;index" json:"club_id"`
 	Role     string    `gorm:"not null" json:"role"`
+	TeamID   *uint     `gorm:"index" json:"team_id,omitempty"`
 	JoinedAt time.Time `json:"joined_at"`
 }
 
 func (c *Club) Save() error {
 	return db.DB.Transaction(func(tx *gorm.DB) error {
 		c.CreatedAt = time.Now()
-		c.GenerateCode()
 
-		if err := tx.Create(c).Error; err != nil {
+		err := withUniqueInviteCodeTx(tx, func(tx *gorm.DB, code string) error {
+			// A clash rolls the attempt back, so start it over from scratch.
+			c.ID = 0
+			for i := range c.Actions {
+				c.Actions[i].ID = 0
+			}
+			c.Code = code
+			if err := tx.Create(c).Error; err != nil {
+				return err
+			}
+
+			// The club code is the default invite: no expiry or usage limit.
+			invite := ClubInvite{
+				ClubID:    c.ID,
+				Code:      c.Code,
+				Role:      RoleMember,
+				CreatedBy: c.CreatedBy,
+				CreatedAt: c.CreatedAt,
+			}
+			return tx.Create(&invite).Error
+		})
+		if err != nil {
 			return err
 		}
+		logger.LogDebug("Generated code", c.Code, "at", c.CreatedAt)
 
 		member := Member{
 			UserID:   c.CreatedBy,
 			ClubID:   c.ID,
-			Role:     "admin",
+			Role:     RoleOwner,
 			JoinedAt: time.Now(),
 		}
-
 		if err := tx.Create(&member).Error; err != nil {
 			return err
 		}
 
-		return nil
+		return setClubTagsTx(tx, c)
 	})
 }
 
-func (c *Club) GenerateCode() {
-	// Use nanosecond timestamp for uniqueness
-	payload := fmt.Sprintf("%d", c.CreatedAt.UnixNano())
-
-	hash := sha256.Sum256([]byte(payload))
-
-	c.Code = strings.ToUpper(
-		base32.StdEncoding.WithPadding(base32.NoPadding).
-			EncodeToString(hash[:5]),
-	)
+func (c *Club) Update() error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Model(&Club{}).
+			Where("id = ?", c.ID).
+			Updates(map[string]interface{}{
+				"name":        c.Name,
+				"description": c.Description,
+				"is_private":  c.IsPrivate,
+				"action":      c.Action,
+				"tags":        c.Tags,
+				"max_members": c.MaxMembers,
+			}).Error
+		if err != nil {
+			return err
+		}
 
-	logger.LogDebug("Generated code", c.Code, "at", c.CreatedAt)
+		return setClubTagsTx(tx, c)
+	})
 }
 
-func getClubByCode(clubCode string) (*Club, error) {
-	var club Club
-
-	err := db.DB.
-		Where("code = ?", clubCode).
-		First(&club).Error
-	if err != nil {
-		return nil, err
+func (c *Club) TagList() []string {
+	if c.Tags == "" {
+		return []string{}
 	}
-	return &club, nil
-}
-
-func (c *Club) Update() error {
-	return db.DB.
-		Model(&Club{}).
-		Where("id = ?", c.ID).
-		Updates(map[string]interface{}{
-			"name":        c.Name,
-			"description": c.Description,
-			"is_private":  c.IsPrivate,
-			"action":      c.Action,
-		}).Error
+	return strings.Split(c.Tags, ",")
 }
 
 func getClubByID(clubID uint) (*Club, error) {
@@ -113,40 +134,126 @@ func GetClub(clubID uint) (*Club, error) {
 	return getClubByID(clubID)
 }
 
-func AddMember(userID uint, clubCode string, role string) error {
-	club, err := getClubByCode(clubCode)
-	//if club doesnt exist
+// GetClubsByIDs loads the clubs with the given IDs, keyed by ID.
+func GetClubsByIDs(ids []uint) (map[uint]*Club, error) {
+	var clubs []Club
+
+	if err := db.DB.Where("id IN ?", ids).Find(&clubs).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*Club, len(clubs))
+	for i := range clubs {
+		byID[clubs[i].ID] = &clubs[i]
+	}
+	return byID, nil
+}
+
+var ErrAlreadyMember = errors.New("user is already a member of the club")
+
+// JoinResult tells how a join attempt ended when the user did not become a
+// member right away.
+type JoinResult struct {
+	// Set when the club is private and an admin has to approve.
+	Request *ClubJoinRequest
+	// Set when the club is full.
+	Waitlist *ClubWaitlistEntry
+}
+
+// AddMember joins the user to the club the invite code belongs to, with the
+// role the invite grants. Private clubs get a pending join request and full
+// clubs a waitlist entry instead. The result is nil when the user joined.
+func AddMember(userID uint, code string) (*JoinResult, error) {
+	invite, err := getUsableInvite(code)
 	if err != nil {
-		return errors.New("club not found")
+		return nil, err
+	}
+	club, err := getClubByID(invite.ClubID)
+	if err != nil {
+		return nil, errors.New("club not found")
+	}
+	if err := checkCanJoin(userID, club); err != nil {
+		return nil, err
+	}
+
+	if club.IsPrivate {
+		request, err := createJoinRequest(userID, club.ID, invite)
+		if err != nil {
+			return nil, err
+		}
+		return &JoinResult{Request: request}, nil
+	}
+
+	entry, err := joinOrWaitlist(userID, club.ID, invite.Role, func(tx *gorm.DB) error {
+		return useInviteTx(tx, invite)
+	})
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return &JoinResult{Waitlist: entry}, nil
+}
+
+func checkCanJoin(userID uint, club *Club) error {
+	banned, err := IsBannedFromClub(userID, club.ID)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return ErrBannedFromClub
+	}
+	if club.ArchivedAt != nil {
+		return ErrClubArchived
 	}
 	// Check if already a member to provide a clear error message
 	var count int64
 	db.DB.Model(&Member{}).Where("user_id = ? AND club_id = ?", userID, club.ID).Count(&count)
 	if count > 0 {
-		return errors.New("user is already a member of the club")
+		return ErrAlreadyMember
 	}
+	return nil
+}
+
+// addMember creates the membership, running inTx in the same transaction,
+// then announces the join and adds the user to the leaderboard. It fails
+// with ErrClubFull when the club is at capacity.
+func addMember(userID, clubID uint, role string, inTx func(tx *gorm.DB) error) error {
 	member := Member{
 		UserID:   userID,
-		ClubID:   club.ID,
+		ClubID:   clubID,
 		Role:     role,
 		JoinedAt: time.Now(),
 	}
 
-	if err := db.DB.Create(&member).Error; err != nil {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := reserveSeatTx(tx, clubID); err != nil {
+			return err
+		}
+		if inTx != nil {
+			if err := inTx(tx); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&member).Error
+	})
+	if err != nil {
 		return err
 	}
 
-	AddActivityLog(userID, club.ID, 0, ActionJoin)
+	AddActivityLog(userID, clubID, 0, ActionJoin)
 
-	return AddUserToLeaderboard(userID, club.ID)
+	return AddUserToLeaderboard(userID, clubID)
 }
 
-func GetClubsForUser(userID uint) ([]Club, error) {
+func GetClubsForUser(userID uint, includeArchived bool) ([]Club, error) {
 	var clubs []Club
 
-	err := db.DB.
+	query := db.DB.
 		Joins("JOIN members ON members.club_id = clubs.id").
-		Where("members.user_id = ?", userID).
+		Where("members.user_id = ?", userID)
+	if !includeArchived {
+		query = query.Where("clubs.archived_at IS NULL")
+	}
+	err := query.
 		Order("clubs.created_at ASC").
 		Find(&clubs).Error
 
@@ -164,21 +271,86 @@ func GetMemberCountForClub(clubID uint) (int64, error) {
 	return count, err
 }
 
+// GetMemberCountsForClubs counts the members of several clubs, keyed by
+// club ID.
+func GetMemberCountsForClubs(clubIDs []uint) (map[uint]int64, error) {
+	var rows []struct {
+		ClubID uint
+		Count  int64
+	}
+
+	err := db.DB.
+		Model(&Member{}).
+		Select("club_id, COUNT(*) AS count").
+		Where("club_id IN ?", clubIDs).
+		Group("club_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ClubID] = row.Count
+	}
+	return counts, nil
+}
+
 func RemoveMember(userID, clubID uint) error {
-	return db.DB.Transaction(func(tx *gorm.DB) error {
-		AddActivityLog(userID, clubID, 0, ActionLeave)
-		// 1. Delete from Members
-		if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).Delete(&Member{}).Error; err != nil {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var member Member
+		if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).First(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotClubMember
+			}
 			return err
 		}
-		// 2. Delete from Leaderboard
-		// This ensures that when they join back, they don't hit a unique constraint error
-		if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).Delete(&LeaderboardEntry{}).Error; err != nil {
+		if err := handOverOwnershipTx(tx, &member); err != nil {
 			return err
 		}
 
-		return nil
+		var club Club
+		if err := tx.Select("name").First(&club, clubID).Error; err != nil {
+			return err
+		}
+		text := fmt.Sprintf("%s has %s %s.", mention(userID), ActionLeave, club.Name)
+		if err := logClubEventTx(tx, userID, clubID, ActionLeave, text); err != nil {
+			return err
+		}
+		return removeMemberTx(tx, userID, clubID)
 	})
+	if err != nil {
+		return err
+	}
+
+	admitFromWaitlistAfterLeave(clubID)
+	return nil
+}
+
+func removeMemberTx(tx *gorm.DB, userID, clubID uint) error {
+	// 1. Delete from Members
+	if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).Delete(&Member{}).Error; err != nil {
+		return err
+	}
+	// 2. Delete from Leaderboard
+	// This ensures that when they join back, they don't hit a unique constraint error
+	if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).Delete(&LeaderboardEntry{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).Delete(&ActionScore{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).Delete(&UserBadge{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).Delete(&Goal{}).Error; err != nil {
+		return err
+	}
+	if err := cancelOpenDuelsTx(tx, userID, clubID); err != nil {
+		return err
+	}
+
+	return nil
 }
 
 func GetClubMembers(clubID uint) ([]Member, error) {
@@ -190,3 +362,106 @@ func GetClubMembers(clubID uint) ([]Member, error) {
 
 	return members, err
 }
+
+func GetMember(userID, clubID uint) (*Member, error) {
+	var member Member
+
+	err := db.DB.
+		Where("user_id = ? AND club_id = ?", userID, clubID).
+		First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// GetSharedClubs returns the clubs both users are members of.
+func GetSharedClubs(userID, otherUserID uint) ([]Club, error) {
+	var clubs []Club
+
+	err := db.DB.
+		Joins("JOIN members m1 ON m1.club_id = clubs.id AND m1.user_id = ?", userID).
+		Joins("JOIN members m2 ON m2.club_id = clubs.id AND m2.user_id = ?", otherUserID).
+		Order("clubs.created_at ASC").
+		Find(&clubs).Error
+
+	return clubs, err
+}
+
+// deleteClubTx removes a club together with everything that belongs to it.
+func deleteClubTx(tx *gorm.DB, clubID uint) error {
+	for _, model := range []interface{}{&Message{}, &ActivityLog{}, &LeaderboardEntry{}, &Member{}, &ClubBan{}, &ClubInvite{}, &ClubJoinRequest{}, &ClubInvitation{}, &ClubWaitlistEntry{}, &ActionScore{}, &ClubAction{}, &ClubTeam{}, &Duel{}, &UserBadge{}, &Goal{}, &ClubTag{}} {
+		if err := tx.Where("club_id = ?", clubID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	err := tx.Where("challenger_club_id = ? OR opponent_club_id = ?", clubID, clubID).Delete(&ClubChallenge{}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Delete(&Club{}, clubID).Error
+}
+
+func GetMembershipsForUser(userID uint) ([]Member, error) {
+	var members []Member
+
+	err := db.DB.
+		Where("user_id = ?", userID).
+		Order("joined_at ASC").
+		Find(&members).Error
+
+	return members, err
+}
+
+var (
+	ErrClubArchived    = errors.New("club is archived")
+	ErrClubNotArchived = errors.New("club is not archived")
+)
+
+// SetClubArchived archives or unarchives a club on behalf of its owner and
+// tells the members in the chat.
+func SetClubArchived(actorID, clubID uint, archived bool) (*Club, error) {
+	var club Club
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionDeleteClub); err != nil {
+			return err
+		}
+		if err := tx.First(&club, clubID).Error; err != nil {
+			return err
+		}
+
+		switch {
+		case archived && club.ArchivedAt != nil:
+			return ErrClubArchived
+		case !archived && club.ArchivedAt == nil:
+			return ErrClubNotArchived
+		}
+
+		action, text := ActionUnarchive, "The club was unarchived."
+		club.ArchivedAt = nil
+		if archived {
+			now := time.Now()
+			club.ArchivedAt = &now
+			action, text = ActionArchive, "The club was archived. It is now read-only."
+		}
+		if err := tx.Model(&club).Update("archived_at", club.ArchivedAt).Error; err != nil {
+			return err
+		}
+		return logClubEventTx(tx, actorID, clubID, action, text)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &club, nil
+}
+
+// DeleteClub permanently removes a club and everything in it on behalf of
+// its owner.
+func DeleteClub(actorID, clubID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionDeleteClub); err != nil {
+			return err
+		}
+		return deleteClubTx(tx, clubID)
+	})
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"klubRanks/db"
+
+	"gorm.io/gorm"
+)
+
+// Club roles, from most to least privileged.
+const (
+	RoleOwner     = "owner"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+type Permission string
+
+const (
+	PermissionEditClub      Permission = "edit_club"
+	PermissionManageMembers Permission = "manage_members"
+	PermissionModerateChat  Permission = "moderate_chat"
+	PermissionAdjustScores  Permission = "adjust_scores"
+	PermissionDeleteClub    Permission = "delete_club"
+)
+
+var roleRanks = map[string]int{
+	RoleOwner:     3,
+	RoleAdmin:     2,
+	RoleModerator: 1,
+	RoleMember:    0,
+}
+
+var rolePermissions = map[string][]Permission{
+	RoleOwner:     {PermissionEditClub, PermissionManageMembers, PermissionModerateChat, PermissionAdjustScores, PermissionDeleteClub},
+	RoleAdmin:     {PermissionEditClub, PermissionManageMembers, PermissionModerateChat, PermissionAdjustScores},
+	RoleModerator: {PermissionModerateChat},
+	RoleMember:    {},
+}
+
+var (
+	ErrNotClubMember       = errors.New("user is not a member of the club")
+	ErrInvalidRole         = errors.New("role must be one of admin, moderator or member")
+	ErrRoleChangeForbidden = errors.New("you can only change roles of members below you to a role below yours")
+	ErrNotClubOwner        = errors.New("only the club owner can do this")
+	ErrAlreadyClubOwner    = errors.New("you already own this club")
+	ErrOwnerMustTransfer   = errors.New("transfer ownership or delete the club before leaving")
+	ErrPermissionDenied    = errors.New("your club role does not allow this action")
+)
+
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+func RoleHasPermission(role string, permission Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireClubPermission returns ErrNotClubMember or ErrPermissionDenied
+// unless the user's role in the club grants the permission.
+func RequireClubPermission(userID, clubID uint, permission Permission) error {
+	return requireClubPermissionTx(db.DB, userID, clubID, permission)
+}
+
+func requireClubPermissionTx(tx *gorm.DB, userID, clubID uint, permission Permission) error {
+	var member Member
+	if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotClubMember
+		}
+		return err
+	}
+	if !RoleHasPermission(member.Role, permission) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// RequireClubMember returns ErrBannedFromClub or ErrNotClubMember unless
+// the user is a member of the club with no active ban.
+func RequireClubMember(userID, clubID uint) error {
+	return requireClubMemberTx(db.DB, userID, clubID)
+}
+
+func requireClubMemberTx(tx *gorm.DB, userID, clubID uint) error {
+	banned, err := isBannedFromClubTx(tx, userID, clubID)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return ErrBannedFromClub
+	}
+
+	var count int64
+	err = tx.Model(&Member{}).Where("user_id = ? AND club_id = ?", userID, clubID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotClubMember
+	}
+	return nil
+}
+
+// SetMemberRole changes the role of a club member on behalf of actorID.
+// Actors can only manage members ranked below them and only hand out roles
+// below their own, so ownership cannot be granted this way.
+func SetMemberRole(actorID, targetUserID, clubID uint, role string) (*Member, error) {
+	if !IsValidRole(role) || role == RoleOwner {
+		return nil, ErrInvalidRole
+	}
+
+	var target Member
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var actor Member
+		if err := tx.Where("user_id = ? AND club_id = ?", actorID, clubID).First(&actor).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotClubMember
+			}
+			return err
+		}
+		if err := tx.Where("user_id = ? AND club_id = ?", targetUserID, clubID).First(&target).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotClubMember
+			}
+			return err
+		}
+
+		if !RoleHasPermission(actor.Role, PermissionManageMembers) ||
+			roleRanks[target.Role] >= roleRanks[actor.Role] ||
+			roleRanks[role] >= roleRanks[actor.Role] {
+			return ErrRoleChangeForbidden
+		}
+		if target.Role == role {
+			return nil
+		}
+
+		if err := tx.Model(&target).Update("role", role).Error; err != nil {
+			return err
+		}
+
+		return logClubEventTx(tx, targetUserID, clubID, ActionRoleChange,
+			fmt.Sprintf("%s is now a club %s.", mention(targetUserID), role))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// TransferOwnership hands the club over to another member. The previous
+// owner stays in the club as an admin.
+func TransferOwnership(ownerID, newOwnerID, clubID uint) error {
+	if ownerID == newOwnerID {
+		return ErrAlreadyClubOwner
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var owner Member
+		if err := tx.Where("user_id = ? AND club_id = ?", ownerID, clubID).First(&owner).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotClubMember
+			}
+			return err
+		}
+		if owner.Role != RoleOwner {
+			return ErrNotClubOwner
+		}
+
+		var target Member
+		if err := tx.Where("user_id = ? AND club_id = ?", newOwnerID, clubID).First(&target).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotClubMember
+			}
+			return err
+		}
+
+		if err := tx.Model(&owner).Update("role", RoleAdmin).Error; err != nil {
+			return err
+		}
+		if err := setClubOwnerTx(tx, clubID, &target); err != nil {
+			return err
+		}
+		return logClubEventTx(tx, newOwnerID, clubID, ActionOwnershipTransfer,
+			fmt.Sprintf("%s transferred ownership of the club to %s.", mention(ownerID), mention(newOwnerID)))
+	})
+}
+
+// handOverOwnershipTx promotes the longest-standing admin when the owner
+// leaves. Without an admin to take over the owner has to transfer the club
+// explicitly or delete it.
+func handOverOwnershipTx(tx *gorm.DB, member *Member) error {
+	if member.Role != RoleOwner {
+		return nil
+	}
+
+	var successor Member
+	err := tx.
+		Where("club_id = ? AND role = ? AND user_id <> ?", member.ClubID, RoleAdmin, member.UserID).
+		Order("joined_at ASC").
+		First(&successor).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrOwnerMustTransfer
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := setClubOwnerTx(tx, member.ClubID, &successor); err != nil {
+		return err
+	}
+	return logClubEventTx(tx, successor.UserID, member.ClubID, ActionOwnershipTransfer,
+		fmt.Sprintf("%s is now the club owner.", mention(successor.UserID)))
+}
+
+func setClubOwnerTx(tx *gorm.DB, clubID uint, member *Member) error {
+	if err := tx.Model(member).Update("role", RoleOwner).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Club{}).Where("id = ?", clubID).Update("created_by", member.UserID).Error
+}
+
+// BackfillClubOwners gives club creators the owner role on databases created
+// before roles existed, when creators were stored as plain admins.
+func BackfillClubOwners() error {
+	return db.DB.Exec(`
+		UPDATE members SET role = ?
+		WHERE role = ?
+		  AND user_id = (SELECT created_by FROM clubs WHERE clubs.id = members.club_id)
+	`, RoleOwner, RoleAdmin).Error
+}
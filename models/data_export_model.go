@@ -0,0 +1,210 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"klubRanks/db"
+	"klubRanks/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ExportStatusPending    = "pending"
+	ExportStatusProcessing = "processing"
+	ExportStatusReady      = "ready"
+	ExportStatusFailed     = "failed"
+)
+
+var ErrDataExportInProgress = errors.New("an export is already in progress")
+
+// activeDataExportIndex allows one pending or processing export per user.
+const activeDataExportIndex = "idx_data_exports_active_user"
+
+type DataExport struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Status      string     `gorm:"not null;index" json:"status"`
+	Token       string     `gorm:"not null;uniqueIndex" json:"-"`
+	FilePath    string     `json:"-"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateDataExport queues an export for the user, or returns
+// ErrDataExportInProgress when one is already queued or being built.
+func CreateDataExport(userID uint) (*DataExport, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	export := DataExport{
+		UserID:    userID,
+		Status:    ExportStatusPending,
+		Token:     token,
+		CreatedAt: time.Now(),
+	}
+
+	err = db.DB.Create(&export).Error
+	if db.IsUniqueViolation(err) {
+		return nil, ErrDataExportInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func GetDataExport(id uint) (*DataExport, error) {
+	var export DataExport
+
+	if err := db.DB.First(&export, id).Error; err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func GetDataExportByToken(token string) (*DataExport, error) {
+	var export DataExport
+
+	err := db.DB.
+		Where("token = ?", token).
+		First(&export).Error
+	if err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// CreateActiveDataExportIndex adds the partial unique index that allows a
+// single active export per user. Duplicates queued before the index existed
+// are failed first, keeping each user's oldest.
+func CreateActiveDataExportIndex() error {
+	if db.DB.Migrator().HasIndex(&DataExport{}, activeDataExportIndex) {
+		return nil
+	}
+
+	now := time.Now()
+	err := db.DB.
+		Model(&DataExport{}).
+		Where("status IN ?", []string{ExportStatusPending, ExportStatusProcessing}).
+		Where("EXISTS (SELECT 1 FROM data_exports older WHERE older.user_id = data_exports.user_id AND older.status IN ? AND older.id < data_exports.id)",
+			[]string{ExportStatusPending, ExportStatusProcessing}).
+		Updates(map[string]interface{}{
+			"status":       ExportStatusFailed,
+			"error":        ErrDataExportInProgress.Error(),
+			"completed_at": now,
+			"expires_at":   now,
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Exec("CREATE UNIQUE INDEX " + activeDataExportIndex +
+		" ON data_exports (user_id) WHERE status IN ('" + ExportStatusPending + "', '" + ExportStatusProcessing + "')").Error
+}
+
+// ClaimPendingDataExport marks the oldest pending export as processing and
+// returns it, or nil when nothing is pending. The status check in the update
+// keeps two workers from claiming the same export.
+func ClaimPendingDataExport() (*DataExport, error) {
+	for {
+		var export DataExport
+		err := db.DB.
+			Where("status = ?", ExportStatusPending).
+			Order("created_at ASC, id ASC").
+			First(&export).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result := db.DB.Model(&DataExport{}).
+			Where("id = ? AND status = ?", export.ID, ExportStatusPending).
+			Update("status", ExportStatusProcessing)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			export.Status = ExportStatusProcessing
+			return &export, nil
+		}
+		// Claimed by another worker; try the next one.
+	}
+}
+
+// ResetProcessingDataExports puts exports that were being built when the
+// server last stopped back in the queue.
+func ResetProcessingDataExports() error {
+	return db.DB.
+		Model(&DataExport{}).
+		Where("status = ?", ExportStatusProcessing).
+		Update("status", ExportStatusPending).Error
+}
+
+// GetExpiredDataExports returns ready and failed exports past their expiry.
+func GetExpiredDataExports(now time.Time) ([]DataExport, error) {
+	var exports []DataExport
+
+	err := db.DB.
+		Where("status IN ? AND expires_at < ?", []string{ExportStatusReady, ExportStatusFailed}, now).
+		Find(&exports).Error
+
+	return exports, err
+}
+
+func GetDataExportsForUser(userID uint) ([]DataExport, error) {
+	var exports []DataExport
+
+	err := db.DB.
+		Where("user_id = ?", userID).
+		Find(&exports).Error
+
+	return exports, err
+}
+
+func (e *DataExport) MarkReady(filePath string, linkExpiry time.Duration) error {
+	now := time.Now()
+	expiresAt := now.Add(linkExpiry)
+
+	e.Status = ExportStatusReady
+	e.FilePath = filePath
+	e.CompletedAt = &now
+	e.ExpiresAt = &expiresAt
+
+	return db.DB.Model(e).Updates(map[string]interface{}{
+		"status":       e.Status,
+		"file_path":    e.FilePath,
+		"completed_at": e.CompletedAt,
+		"expires_at":   e.ExpiresAt,
+	}).Error
+}
+
+// MarkFailed records why the export failed. The failure is kept for
+// retention so the user can see it, then cleaned up like a ready export.
+func (e *DataExport) MarkFailed(cause error, retention time.Duration) error {
+	now := time.Now()
+	expiresAt := now.Add(retention)
+
+	e.Status = ExportStatusFailed
+	e.Error = cause.Error()
+	e.CompletedAt = &now
+	e.ExpiresAt = &expiresAt
+
+	return db.DB.Model(e).Updates(map[string]interface{}{
+		"status":       e.Status,
+		"error":        e.Error,
+		"completed_at": e.CompletedAt,
+		"expires_at":   e.ExpiresAt,
+	}).Error
+}
+
+func DeleteDataExport(id uint) error {
+	return db.DB.Delete(&DataExport{}, id).Error
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"klubRanks/db"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DiscoverSortMembers  = "members"
+	DiscoverSortActivity = "activity"
+	DiscoverSortNewest   = "newest"
+
+	// Activity is counted over this window when sorting by activity.
+	discoverActivityWindow = 7 * 24 * time.Hour
+)
+
+var DiscoverSorts = []string{DiscoverSortMembers, DiscoverSortActivity, DiscoverSortNewest}
+
+var ErrClubNotPublic = errors.New("private clubs can only be joined with an invite code")
+
+// ClubTag indexes Club.Tags, one row per tag, so that discovery can look tags
+// up exactly. Club.Tags stays the ordered list shown to users.
+type ClubTag struct {
+	ClubID uint   `gorm:"primaryKey" json:"club_id"`
+	Tag    string `gorm:"primaryKey;index" json:"tag"`
+}
+
+type DiscoverQuery struct {
+	// Every whitespace separated term must appear in the name, description
+	// or action. This is a substring match that can't use an index; full-text
+	// search (FTS5 needs a build tag on sqlite, tsvector is postgres only) is
+	// left out until the number of public clubs calls for it.
+	Search string
+	// Matched exactly against the club's tags, ignoring case.
+	Tag    string
+	Sort   string
+	Limit  int
+	Offset int
+}
+
+type DiscoveredClub struct {
+	Club
+	MemberCount    int64
+	RecentActivity int64
+	IsMember       bool
+}
+
+// DiscoverClubs lists public, unarchived clubs for userID to browse.
+func DiscoverClubs(userID uint, q DiscoverQuery) ([]DiscoveredClub, error) {
+	var clubs []DiscoveredClub
+
+	query := db.DB.
+		Model(&Club{}).
+		Select(`clubs.*,
+			(SELECT COUNT(*) FROM members WHERE members.club_id = clubs.id) AS member_count,
+			(SELECT COUNT(*) FROM activity_logs WHERE activity_logs.club_id = clubs.id AND activity_logs.created_at >= ?) AS recent_activity,
+			EXISTS (SELECT 1 FROM members WHERE members.club_id = clubs.id AND members.user_id = ?) AS is_member`,
+			time.Now().Add(-discoverActivityWindow), userID).
+		Where("clubs.is_private = ? AND clubs.archived_at IS NULL", false)
+
+	for _, term := range strings.Fields(strings.ToLower(q.Search)) {
+		pattern := "%" + escapeLike(term) + "%"
+		query = query.Where(
+			`LOWER(clubs.name) LIKE ? ESCAPE '\' OR LOWER(COALESCE(clubs.description, '')) LIKE ? ESCAPE '\' OR LOWER(clubs.action) LIKE ? ESCAPE '\'`,
+			pattern, pattern, pattern,
+		)
+	}
+	if q.Tag != "" {
+		query = query.Where(
+			"EXISTS (SELECT 1 FROM club_tags WHERE club_tags.club_id = clubs.id AND club_tags.tag = ?)",
+			strings.ToLower(q.Tag),
+		)
+	}
+
+	switch q.Sort {
+	case DiscoverSortActivity:
+		query = query.Order("recent_activity DESC").Order("member_count DESC")
+	case DiscoverSortNewest:
+		query = query.Order("clubs.created_at DESC")
+	default:
+		query = query.Order("member_count DESC").Order("recent_activity DESC")
+	}
+
+	err := query.
+		Order("clubs.id DESC").
+		Limit(q.Limit).
+		Offset(q.Offset).
+		Scan(&clubs).Error
+
+	return clubs, err
+}
+
+// JoinPublicClub joins a public club by ID, without an invite code. Full
+// clubs put the user on the waitlist and return the entry.
+func JoinPublicClub(userID, clubID uint) (*ClubWaitlistEntry, error) {
+	club, err := getClubByID(clubID)
+	if err != nil {
+		return nil, errors.New("club not found")
+	}
+	if club.IsPrivate {
+		return nil, ErrClubNotPublic
+	}
+	if err := checkCanJoin(userID, club); err != nil {
+		return nil, err
+	}
+	return joinOrWaitlist(userID, club.ID, RoleMember, nil)
+}
+
+// setClubTagsTx replaces the club's rows in club_tags with its current tags.
+func setClubTagsTx(tx *gorm.DB, club *Club) error {
+	if err := tx.Where("club_id = ?", club.ID).Delete(&ClubTag{}).Error; err != nil {
+		return err
+	}
+
+	tags := club.TagList()
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := make([]ClubTag, len(tags))
+	for i, tag := range tags {
+		rows[i] = ClubTag{ClubID: club.ID, Tag: tag}
+	}
+	return tx.Create(&rows).Error
+}
+
+// BackfillClubTags fills club_tags for clubs tagged before it existed.
+func BackfillClubTags() error {
+	var clubs []Club
+	err := db.DB.
+		Select("id", "tags").
+		Where("tags <> '' AND NOT EXISTS (SELECT 1 FROM club_tags WHERE club_tags.club_id = clubs.id)").
+		Find(&clubs).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range clubs {
+		if err := setClubTagsTx(db.DB, &clubs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,417 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"klubRanks/db"
+	"klubRanks/logger"
+
+	"gorm.io/gorm"
+)
+
+// Duel is two members of a club competing for the most check-ins over a
+// period that starts when the opponent accepts.
+type Duel struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	ClubID       uint   `gorm:"not null;index" json:"club_id"`
+	ChallengerID uint   `gorm:"not null;index" json:"challenger_id"`
+	OpponentID   uint   `gorm:"not null;index" json:"opponent_id"`
+	Status       string `gorm:"not null;index" json:"status"`
+	Days         int    `gorm:"not null" json:"days"`
+	// Set once the opponent accepts.
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `gorm:"index" json:"ends_at,omitempty"`
+	// Nil for a draw or while the duel is running.
+	WinnerID  *uint     `json:"winner_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	DuelPending   = "pending"
+	DuelAccepted  = "accepted"
+	DuelDeclined  = "declined"
+	DuelCancelled = "cancelled"
+	DuelFinished  = "finished"
+)
+
+const ActionDuel = "duel"
+
+var (
+	ErrDuelNotFound = errors.New("duel not found")
+	ErrDuelSelf     = errors.New("you cannot duel yourself")
+	ErrDuelExists   = errors.New("you already have an open duel with this member")
+)
+
+// DuelProgress is the head-to-head check-in count of a duel.
+type DuelProgress struct {
+	ChallengerCheckIns int
+	OpponentCheckIns   int
+}
+
+// DuelRecord is a member's duel results.
+type DuelRecord struct {
+	Wins   int
+	Losses int
+	Draws  int
+}
+
+// CreateDuel challenges another member of the club.
+func CreateDuel(challengerID, opponentID, clubID uint, days int) (*Duel, error) {
+	if challengerID == opponentID {
+		return nil, ErrDuelSelf
+	}
+
+	duel := Duel{
+		ClubID:       clubID,
+		ChallengerID: challengerID,
+		OpponentID:   opponentID,
+		Status:       DuelPending,
+		Days:         days,
+		CreatedAt:    time.Now(),
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&Member{}).
+			Where("club_id = ? AND user_id IN ?", clubID, []uint{challengerID, opponentID}).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count < 2 {
+			return ErrNotClubMember
+		}
+
+		err = tx.Model(&Duel{}).
+			Where("club_id = ? AND status IN ?", clubID, []string{DuelPending, DuelAccepted}).
+			Where("(challenger_id = ? AND opponent_id = ?) OR (challenger_id = ? AND opponent_id = ?)",
+				challengerID, opponentID, opponentID, challengerID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDuelExists
+		}
+
+		return tx.Create(&duel).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &duel, nil
+}
+
+// DuelOpenStatuses are the statuses of duels that are not settled yet.
+var DuelOpenStatuses = []string{DuelPending, DuelAccepted}
+
+var DuelStatuses = []string{DuelPending, DuelAccepted, DuelDeclined, DuelCancelled, DuelFinished}
+
+// GetDuelsForClub returns up to limit of the club's duels with one of the
+// statuses, or any status when statuses is empty, newest first.
+func GetDuelsForClub(clubID uint, statuses []string, limit int) ([]Duel, error) {
+	return findDuels(db.DB.Where("club_id = ?", clubID), statuses, limit)
+}
+
+// GetDuelsForUser returns up to limit of the user's duels in all clubs with
+// one of the statuses, or any status when statuses is empty, newest first.
+func GetDuelsForUser(userID uint, statuses []string, limit int) ([]Duel, error) {
+	return findDuels(db.DB.Where("challenger_id = ? OR opponent_id = ?", userID, userID), statuses, limit)
+}
+
+func findDuels(query *gorm.DB, statuses []string, limit int) ([]Duel, error) {
+	var duels []Duel
+
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	err := query.
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&duels).Error
+
+	return duels, err
+}
+
+func getDuelTx(tx *gorm.DB, clubID, duelID uint) (*Duel, error) {
+	var duel Duel
+
+	err := tx.Where("id = ? AND club_id = ?", duelID, clubID).First(&duel).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDuelNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &duel, nil
+}
+
+// AcceptDuel starts a pending duel on behalf of the opponent and announces
+// it in the club chat.
+func AcceptDuel(userID, clubID, duelID uint) (*Duel, error) {
+	var duel *Duel
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if duel, err = getDuelTx(tx, clubID, duelID); err != nil {
+			return err
+		}
+		if duel.OpponentID != userID || duel.Status != DuelPending {
+			return ErrDuelNotFound
+		}
+
+		now := time.Now()
+		endsAt := now.AddDate(0, 0, duel.Days)
+		result := tx.Model(&Duel{}).
+			Where("id = ? AND status = ?", duel.ID, DuelPending).
+			Updates(map[string]interface{}{
+				"status":    DuelAccepted,
+				"starts_at": now,
+				"ends_at":   endsAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrDuelNotFound
+		}
+		duel.Status = DuelAccepted
+		duel.StartsAt = &now
+		duel.EndsAt = &endsAt
+
+		return logClubEventTx(tx, userID, clubID, ActionDuel,
+			fmt.Sprintf("%s accepted %s's duel. Most check-ins until %s wins.",
+				mention(userID), mention(duel.ChallengerID), endsAt.UTC().Format(time.RFC1123)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duel, nil
+}
+
+// DeclineDuel is the opponent turning down a pending duel.
+func DeclineDuel(userID, clubID, duelID uint) (*Duel, error) {
+	return closePendingDuel(clubID, duelID, DuelDeclined, func(d *Duel) bool { return d.OpponentID == userID })
+}
+
+// CancelDuel is the challenger withdrawing a pending duel.
+func CancelDuel(userID, clubID, duelID uint) (*Duel, error) {
+	return closePendingDuel(clubID, duelID, DuelCancelled, func(d *Duel) bool { return d.ChallengerID == userID })
+}
+
+func closePendingDuel(clubID, duelID uint, status string, allowed func(*Duel) bool) (*Duel, error) {
+	var duel *Duel
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if duel, err = getDuelTx(tx, clubID, duelID); err != nil {
+			return err
+		}
+		if !allowed(duel) || duel.Status != DuelPending {
+			return ErrDuelNotFound
+		}
+
+		result := tx.Model(&Duel{}).
+			Where("id = ? AND status = ?", duel.ID, DuelPending).
+			Update("status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrDuelNotFound
+		}
+		duel.Status = status
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return duel, nil
+}
+
+// cancelOpenDuelsTx calls off the user's pending and running duels, in one
+// club or in all clubs when clubID is 0. Used when they leave.
+func cancelOpenDuelsTx(tx *gorm.DB, userID, clubID uint) error {
+	query := tx.Model(&Duel{}).
+		Where("status IN ?", []string{DuelPending, DuelAccepted}).
+		Where("challenger_id = ? OR opponent_id = ?", userID, userID)
+	if clubID != 0 {
+		query = query.Where("club_id = ?", clubID)
+	}
+	return query.Update("status", DuelCancelled).Error
+}
+
+// GetDuelProgresses counts both members' check-ins in the club since each
+// duel started, keyed by duel ID, in one query. Duels that have not started
+// are left out.
+func GetDuelProgresses(duels []Duel) (map[uint]DuelProgress, error) {
+	progresses := make(map[uint]DuelProgress, len(duels))
+	challengers := make(map[uint]uint, len(duels))
+
+	ids := make([]uint, 0, len(duels))
+	for _, d := range duels {
+		if d.StartsAt != nil {
+			ids = append(ids, d.ID)
+			progresses[d.ID] = DuelProgress{}
+			challengers[d.ID] = d.ChallengerID
+		}
+	}
+	if len(ids) == 0 {
+		return progresses, nil
+	}
+
+	var counts []struct {
+		DuelID   uint
+		UserID   uint
+		CheckIns int
+	}
+	err := db.DB.Table("duels").
+		Select("duels.id AS duel_id, activity_logs.user_id, COUNT(*) AS check_ins").
+		Joins(`JOIN activity_logs ON activity_logs.club_id = duels.club_id
+			AND activity_logs.user_id IN (duels.challenger_id, duels.opponent_id)
+			AND activity_logs.updated_score > 0
+			AND activity_logs.created_at >= duels.starts_at
+			AND activity_logs.created_at < duels.ends_at`).
+		Where("duels.id IN ?", ids).
+		Group("duels.id, activity_logs.user_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range counts {
+		progress := progresses[c.DuelID]
+		if c.UserID == challengers[c.DuelID] {
+			progress.ChallengerCheckIns = c.CheckIns
+		} else {
+			progress.OpponentCheckIns = c.CheckIns
+		}
+		progresses[c.DuelID] = progress
+	}
+	return progresses, nil
+}
+
+func duelProgressTx(tx *gorm.DB, duel *Duel) (DuelProgress, error) {
+	var progress DuelProgress
+	if duel.StartsAt == nil {
+		return progress, nil
+	}
+
+	var counts []struct {
+		UserID   uint
+		CheckIns int
+	}
+	err := tx.Model(&ActivityLog{}).
+		Select("user_id, COUNT(*) AS check_ins").
+		Where("club_id = ? AND user_id IN ? AND updated_score > 0 AND created_at >= ? AND created_at < ?",
+			duel.ClubID, []uint{duel.ChallengerID, duel.OpponentID}, *duel.StartsAt, *duel.EndsAt).
+		Group("user_id").
+		Scan(&counts).Error
+	if err != nil {
+		return progress, err
+	}
+
+	for _, c := range counts {
+		switch c.UserID {
+		case duel.ChallengerID:
+			progress.ChallengerCheckIns = c.CheckIns
+		case duel.OpponentID:
+			progress.OpponentCheckIns = c.CheckIns
+		}
+	}
+	return progress, nil
+}
+
+// FinishEndedDuels settles running duels whose period is over and announces
+// the winner in the club chat.
+func FinishEndedDuels(now time.Time) error {
+	var duels []Duel
+	err := db.DB.
+		Where("status = ? AND ends_at <= ?", DuelAccepted, now).
+		Find(&duels).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range duels {
+		duel := &duels[i]
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			progress, err := duelProgressTx(tx, duel)
+			if err != nil {
+				return err
+			}
+
+			challenger, opponent := mention(duel.ChallengerID), mention(duel.OpponentID)
+			var text string
+			switch {
+			case progress.ChallengerCheckIns > progress.OpponentCheckIns:
+				duel.WinnerID = &duel.ChallengerID
+				text = fmt.Sprintf("%s won the duel against %s, %d to %d check-ins.", challenger, opponent,
+					progress.ChallengerCheckIns, progress.OpponentCheckIns)
+			case progress.OpponentCheckIns > progress.ChallengerCheckIns:
+				duel.WinnerID = &duel.OpponentID
+				text = fmt.Sprintf("%s won the duel against %s, %d to %d check-ins.", opponent, challenger,
+					progress.OpponentCheckIns, progress.ChallengerCheckIns)
+			default:
+				text = fmt.Sprintf("The duel between %s and %s ended in a draw at %d check-ins.", challenger, opponent,
+					progress.ChallengerCheckIns)
+			}
+
+			result := tx.Model(&Duel{}).
+				Where("id = ? AND status = ?", duel.ID, DuelAccepted).
+				Updates(map[string]interface{}{
+					"status":    DuelFinished,
+					"winner_id": duel.WinnerID,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrDuelNotFound
+			}
+			duel.Status = DuelFinished
+
+			return logClubEventTx(tx, duel.ChallengerID, duel.ClubID, ActionDuel, text)
+		})
+		if errors.Is(err, ErrDuelNotFound) {
+			// Finished or called off in the meantime.
+			continue
+		}
+		if err != nil {
+			logger.LogError("Failed to finish duel", duel.ID, ":", err)
+		}
+	}
+	return nil
+}
+
+// GetDuelRecord counts the user's finished duels in a club, or in all clubs
+// when clubID is 0.
+func GetDuelRecord(userID, clubID uint) (DuelRecord, error) {
+	var record DuelRecord
+
+	query := db.DB.
+		Where("status = ?", DuelFinished).
+		Where("challenger_id = ? OR opponent_id = ?", userID, userID)
+	if clubID != 0 {
+		query = query.Where("club_id = ?", clubID)
+	}
+
+	var duels []Duel
+	if err := query.Select("winner_id").Find(&duels).Error; err != nil {
+		return record, err
+	}
+
+	for _, d := range duels {
+		switch {
+		case d.WinnerID == nil:
+			record.Draws++
+		case *d.WinnerID == userID:
+			record.Wins++
+		default:
+			record.Losses++
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,292 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"klubRanks/db"
+
+	"gorm.io/gorm"
+)
+
+// Goal is a member's personal target of check-ins in a club per day, week
+// or month. Periods follow UTC calendar days, like streaks, with weeks
+// starting on Monday.
+type Goal struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"not null;index" json:"user_id"`
+	ClubID uint   `gorm:"not null;index" json:"club_id"`
+	Period string `gorm:"not null" json:"period"`
+	Target int    `gorm:"not null" json:"target"`
+	// Visible goals show up for the other members and their completion is
+	// announced in the club chat.
+	Visible bool `gorm:"not null;default:false" json:"visible"`
+	// Start of the last period the goal was completed in.
+	CompletedFor *time.Time `json:"completed_for,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+const (
+	GoalPeriodDay   = "day"
+	GoalPeriodWeek  = "week"
+	GoalPeriodMonth = "month"
+)
+
+const ActionGoalCompleted = "goal_completed"
+
+// MaxGoalsPerMember caps how many goals a member can have in one club.
+const MaxGoalsPerMember = 10
+
+var (
+	ErrGoalNotFound      = errors.New("goal not found")
+	ErrInvalidGoalPeriod = errors.New("goal period must be one of day, week or month")
+	ErrTooManyGoals      = fmt.Errorf("a member can have at most %d goals in a club", MaxGoalsPerMember)
+)
+
+// GoalProgress is a goal with its check-ins in the current period.
+type GoalProgress struct {
+	Goal        Goal
+	CheckIns    int
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+func (p GoalProgress) Completed() bool {
+	return p.CheckIns >= p.Goal.Target
+}
+
+// CurrentPeriod returns the bounds of the goal's period that contains now.
+func (g *Goal) CurrentPeriod(now time.Time) (time.Time, time.Time) {
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	switch g.Period {
+	case GoalPeriodWeek:
+		// Weekday counts from Sunday; weeks start on Monday.
+		start := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	case GoalPeriodMonth:
+		start := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		return today, today.AddDate(0, 0, 1)
+	}
+}
+
+func (g *Goal) periodPhrase() string {
+	if g.Period == GoalPeriodDay {
+		return "today"
+	}
+	return "this " + g.Period
+}
+
+func checkInCount(n int) string {
+	if n == 1 {
+		return "1 check-in"
+	}
+	return fmt.Sprintf("%d check-ins", n)
+}
+
+func validGoalPeriod(period string) bool {
+	return period == GoalPeriodDay || period == GoalPeriodWeek || period == GoalPeriodMonth
+}
+
+// CreateGoal sets a new goal for a member of the club.
+func CreateGoal(userID, clubID uint, period string, target int, visible bool) (*Goal, error) {
+	if !validGoalPeriod(period) {
+		return nil, ErrInvalidGoalPeriod
+	}
+
+	goal := Goal{
+		UserID:    userID,
+		ClubID:    clubID,
+		Period:    period,
+		Target:    target,
+		Visible:   visible,
+		CreatedAt: time.Now(),
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&Member{}).
+			Where("user_id = ? AND club_id = ?", userID, clubID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotClubMember
+		}
+
+		err = tx.Model(&Goal{}).
+			Where("user_id = ? AND club_id = ?", userID, clubID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count >= MaxGoalsPerMember {
+			return ErrTooManyGoals
+		}
+
+		return tx.Create(&goal).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &goal, nil
+}
+
+// UpdateGoal changes one of the user's goals. Changing the period or target
+// lets the goal be completed again in the current period.
+func UpdateGoal(userID, clubID, goalID uint, period string, target int, visible bool) (*Goal, error) {
+	if !validGoalPeriod(period) {
+		return nil, ErrInvalidGoalPeriod
+	}
+
+	goal, err := getGoalTx(db.DB, userID, clubID, goalID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"period":  period,
+		"target":  target,
+		"visible": visible,
+	}
+	if period != goal.Period || target != goal.Target {
+		updates["completed_for"] = nil
+		goal.CompletedFor = nil
+	}
+	if err := db.DB.Model(goal).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	goal.Period = period
+	goal.Target = target
+	goal.Visible = visible
+	return goal, nil
+}
+
+func DeleteGoal(userID, clubID, goalID uint) error {
+	result := db.DB.
+		Where("id = ? AND user_id = ? AND club_id = ?", goalID, userID, clubID).
+		Delete(&Goal{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrGoalNotFound
+	}
+	return nil
+}
+
+func getGoalTx(tx *gorm.DB, userID, clubID, goalID uint) (*Goal, error) {
+	var goal Goal
+
+	err := tx.Where("id = ? AND user_id = ? AND club_id = ?", goalID, userID, clubID).First(&goal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGoalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &goal, nil
+}
+
+// GetGoalProgress returns a goal with its progress in the current period.
+func GetGoalProgress(goal *Goal) (GoalProgress, error) {
+	return goalProgressTx(db.DB, goal, time.Now())
+}
+
+func goalProgressTx(tx *gorm.DB, goal *Goal, now time.Time) (GoalProgress, error) {
+	start, end := goal.CurrentPeriod(now)
+	progress := GoalProgress{Goal: *goal, PeriodStart: start, PeriodEnd: end}
+
+	var n int64
+	err := tx.Model(&ActivityLog{}).
+		Where("user_id = ? AND club_id = ? AND updated_score > 0 AND created_at >= ? AND created_at < ?",
+			goal.UserID, goal.ClubID, start, end).
+		Count(&n).Error
+	progress.CheckIns = int(n)
+	return progress, err
+}
+
+// GetGoalsForMember returns the member's goals in the club with their
+// progress, leaving out hidden ones unless includeHidden is set.
+func GetGoalsForMember(userID, clubID uint, includeHidden bool) ([]GoalProgress, error) {
+	query := db.DB.Where("user_id = ? AND club_id = ?", userID, clubID)
+	if !includeHidden {
+		query = query.Where("visible = ?", true)
+	}
+	return goalsWithProgress(query)
+}
+
+// GetVisibleGoalsForClub returns the goals the club's members share, with
+// their progress.
+func GetVisibleGoalsForClub(clubID uint) ([]GoalProgress, error) {
+	return goalsWithProgress(db.DB.Where("club_id = ? AND visible = ?", clubID, true))
+}
+
+func goalsWithProgress(query *gorm.DB) ([]GoalProgress, error) {
+	var goals []Goal
+	if err := query.Order("created_at ASC, id ASC").Find(&goals).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	progress := make([]GoalProgress, 0, len(goals))
+	for i := range goals {
+		p, err := goalProgressTx(db.DB, &goals[i], now)
+		if err != nil {
+			return nil, err
+		}
+		progress = append(progress, p)
+	}
+	return progress, nil
+}
+
+// completeGoalsTx marks the member's goals in the club that the check-in
+// just logged in tx completed for the current period. Completed visible
+// goals are announced in the club chat. It returns the goals completed just
+// now.
+func completeGoalsTx(tx *gorm.DB, userID, clubID uint, now time.Time) ([]GoalProgress, error) {
+	var completed []GoalProgress
+
+	var goals []Goal
+	if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).Find(&goals).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range goals {
+		goal := &goals[i]
+		progress, err := goalProgressTx(tx, goal, now)
+		if err != nil {
+			return nil, err
+		}
+		if !progress.Completed() {
+			continue
+		}
+
+		result := tx.Model(&Goal{}).
+			Where("id = ? AND (completed_for IS NULL OR completed_for < ?)", goal.ID, progress.PeriodStart).
+			Update("completed_for", progress.PeriodStart)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Already completed this period.
+			continue
+		}
+		progress.Goal.CompletedFor = &progress.PeriodStart
+
+		if goal.Visible {
+			err := logClubEventTx(tx, userID, clubID, ActionGoalCompleted,
+				fmt.Sprintf("%s reached their goal of %s %s.", mention(userID), checkInCount(goal.Target), goal.periodPhrase()))
+			if err != nil {
+				return nil, err
+			}
+		}
+		completed = append(completed, progress)
+	}
+	return completed, nil
+}
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"klubRanks/db"
+	"klubRanks/utils"
+
+	"gorm.io/gorm"
+)
+
+// ExternalIdentity links an account at an external login provider to a user.
+type ExternalIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Provider    string     `gorm:"not null;uniqueIndex:idx_provider_subject" json:"provider"`
+	Subject     string     `gorm:"not null;uniqueIndex:idx_provider_subject" json:"-"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// OAuthState holds the secrets of an in-flight provider login until the
+// provider redirects back. LinkUserID is set when an existing user is
+// linking a provider rather than logging in.
+type OAuthState struct {
+	ID           uint   `gorm:"primaryKey"`
+	State        string `gorm:"not null;uniqueIndex"`
+	Provider     string `gorm:"not null"`
+	CodeVerifier string `gorm:"not null"`
+	Nonce        string `gorm:"not null"`
+	// Hash of the secret in the starting browser's cookie, so that a login
+	// URL handed to someone else can't be completed in their browser.
+	BrowserBindingHash string    `gorm:"not null;default:''"`
+	LinkUserID         *uint     `gorm:"index"`
+	ExpiresAt          time.Time `gorm:"not null;index"`
+}
+
+var (
+	ErrIdentityLinkedElsewhere = errors.New("this account is already linked to another user")
+	ErrProviderAlreadyLinked   = errors.New("a login from this provider is already linked")
+	ErrLastLoginMethod         = errors.New("cannot unlink the only way to log in, set a password first with PUT /users/me/password")
+	ErrInvalidOAuthState       = errors.New("login request expired or is invalid")
+)
+
+func SaveOAuthState(state *OAuthState) error {
+	// Opportunistically drop abandoned login attempts.
+	db.DB.Where("expires_at < ?", time.Now()).Delete(&OAuthState{})
+
+	return db.DB.Create(state).Error
+}
+
+// ConsumeOAuthState returns the stored state and deletes it, so every state
+// can be used only once. browserBinding is the secret from the cookie of the
+// browser completing the login and must match the one that started it.
+func ConsumeOAuthState(state, provider, browserBinding string) (*OAuthState, error) {
+	var stored OAuthState
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Where("state = ? AND provider = ?", state, provider).
+			First(&stored).Error
+		if err != nil {
+			return ErrInvalidOAuthState
+		}
+		if err := tx.Delete(&stored).Error; err != nil {
+			return err
+		}
+		if time.Now().After(stored.ExpiresAt) {
+			return ErrInvalidOAuthState
+		}
+		if browserBinding == "" ||
+			subtle.ConstantTimeCompare([]byte(stored.BrowserBindingHash), []byte(utils.HashToken(browserBinding))) != 1 {
+			return ErrInvalidOAuthState
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// GetUserByExternalIdentity returns the linked user and records the login.
+func GetUserByExternalIdentity(provider, subject string) (*User, error) {
+	var identity ExternalIdentity
+
+	err := db.DB.
+		Where("provider = ? AND subject = ?", provider, subject).
+		First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+
+	db.DB.Model(&identity).Update("last_login_at", time.Now())
+
+	return GetUserByID(identity.UserID)
+}
+
+func LinkExternalIdentity(userID uint, provider, subject, email string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var existing ExternalIdentity
+
+		err := tx.Where("provider = ? AND subject = ?", provider, subject).First(&existing).Error
+		if err == nil {
+			if existing.UserID != userID {
+				return ErrIdentityLinkedElsewhere
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&ExternalIdentity{}).Where("user_id = ? AND provider = ?", userID, provider).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrProviderAlreadyLinked
+		}
+
+		identity := ExternalIdentity{
+			UserID:    userID,
+			Provider:  provider,
+			Subject:   subject,
+			Email:     email,
+			CreatedAt: time.Now(),
+		}
+		return tx.Create(&identity).Error
+	})
+}
+
+// CreateUserWithExternalIdentity signs up a new user from a provider login.
+// Such users have no password until they set one.
+func CreateUserWithExternalIdentity(usernameHint, provider, subject, email string) (*User, error) {
+	username, err := availableUsername(usernameHint)
+	if err != nil {
+		return nil, err
+	}
+
+	user := User{
+		Username:  username,
+		AvatarID:  "default",
+		CreatedAt: time.Now(),
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		identity := ExternalIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     subject,
+			Email:       email,
+			CreatedAt:   now,
+			LastLoginAt: &now,
+		}
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func GetExternalIdentitiesForUser(userID uint) ([]ExternalIdentity, error) {
+	var identities []ExternalIdentity
+
+	err := db.DB.
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&identities).Error
+
+	return identities, err
+}
+
+func UnlinkExternalIdentity(userID uint, provider string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Select("id", "password").First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&ExternalIdentity{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if user.Password == "" && count <= 1 {
+			return ErrLastLoginMethod
+		}
+
+		result := tx.Where("user_id = ? AND provider = ?", userID, provider).Delete(&ExternalIdentity{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// availableUsername turns a provider supplied name into a valid username
+// that nobody uses yet, adding a numeric suffix when needed.
+func availableUsername(hint string) (string, error) {
+	if at := strings.Index(hint, "@"); at >= 0 {
+		hint = hint[:at]
+	}
+
+	var b strings.Builder
+	for _, r := range hint {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('_')
+		}
+	}
+
+	base := strings.TrimLeft(b.String(), "_.-")
+	if len(base) > utils.UsernameMaxLength-5 {
+		base = base[:utils.UsernameMaxLength-5]
+	}
+	if utils.ValidateUsername(base) != nil {
+		base = "user"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 20; attempt++ {
+		taken, err := IsUsernameTaken(candidate, 0)
+		if err != nil {
+			return "", err
+		}
+		if !taken && utils.ValidateUsername(candidate) == nil {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s_%04d", base, rand.IntN(10000))
+	}
+	return "", errors.New("could not find an available username")
+}
@@ -0,0 +1,232 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"klubRanks/db"
+
+	"gorm.io/gorm"
+)
+
+// ClubInvitation is a member inviting a specific user into a club. The
+// invitee sees it in their inbox and accepts or declines it.
+type ClubInvitation struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	ClubID      uint       `gorm:"not null;index" json:"club_id"`
+	InviterID   uint       `gorm:"not null;index" json:"inviter_id"`
+	InviteeID   uint       `gorm:"not null;index" json:"invitee_id"`
+	Status      string     `gorm:"not null;index" json:"status"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+const (
+	InvitationPending   = "pending"
+	InvitationAccepted  = "accepted"
+	InvitationDeclined  = "declined"
+	InvitationCancelled = "cancelled"
+)
+
+const ActionInvitationAccepted = "invitation_accepted"
+
+var (
+	ErrInvitationNotFound  = errors.New("invitation not found")
+	ErrInvitationPending   = errors.New("user already has a pending invitation to this club")
+	ErrInviteeBanned       = errors.New("user is banned from this club")
+	ErrCannotInviteSelf    = errors.New("you cannot invite yourself")
+	ErrPrivateClubInviters = errors.New("only admins can invite people into a private club")
+)
+
+// CreateClubInvitation invites a user into a club. Any member can invite
+// into a public club; private clubs need someone who can manage members,
+// since accepting skips the join request.
+func CreateClubInvitation(inviterID, clubID, inviteeID uint) (*ClubInvitation, error) {
+	if inviterID == inviteeID {
+		return nil, ErrCannotInviteSelf
+	}
+
+	invitation := ClubInvitation{
+		ClubID:    clubID,
+		InviterID: inviterID,
+		InviteeID: inviteeID,
+		Status:    InvitationPending,
+		CreatedAt: time.Now(),
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var inviter Member
+		if err := tx.Where("user_id = ? AND club_id = ?", inviterID, clubID).First(&inviter).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotClubMember
+			}
+			return err
+		}
+
+		var club Club
+		if err := tx.First(&club, clubID).Error; err != nil {
+			return err
+		}
+		if club.ArchivedAt != nil {
+			return ErrClubArchived
+		}
+		if club.IsPrivate && !RoleHasPermission(inviter.Role, PermissionManageMembers) {
+			return ErrPrivateClubInviters
+		}
+
+		var count int64
+		if err := tx.Model(&Member{}).Where("user_id = ? AND club_id = ?", inviteeID, clubID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyMember
+		}
+		err := tx.Model(&ClubBan{}).
+			Where("user_id = ? AND club_id = ? AND (expires_at IS NULL OR expires_at > ?)", inviteeID, clubID, time.Now()).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrInviteeBanned
+		}
+		err = tx.Model(&ClubInvitation{}).
+			Where("invitee_id = ? AND club_id = ? AND status = ?", inviteeID, clubID, InvitationPending).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrInvitationPending
+		}
+
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// GetPendingInvitationsForUser is the invitee's inbox, newest first.
+func GetPendingInvitationsForUser(userID uint) ([]ClubInvitation, error) {
+	var invitations []ClubInvitation
+
+	err := db.DB.
+		Where("invitee_id = ? AND status = ?", userID, InvitationPending).
+		Order("created_at DESC").
+		Find(&invitations).Error
+
+	return invitations, err
+}
+
+// GetInvitationsForClub returns the club's invitations, newest first. When
+// inviterID is non-zero only that member's invitations are returned.
+func GetInvitationsForClub(clubID, inviterID uint) ([]ClubInvitation, error) {
+	var invitations []ClubInvitation
+
+	query := db.DB.Where("club_id = ?", clubID)
+	if inviterID != 0 {
+		query = query.Where("inviter_id = ?", inviterID)
+	}
+	err := query.
+		Order("created_at DESC").
+		Find(&invitations).Error
+
+	return invitations, err
+}
+
+// AcceptInvitation joins the invitee to the club through the regular join
+// path and lets the inviter know in the club chat.
+func AcceptInvitation(userID, invitationID uint) (*ClubInvitation, error) {
+	invitation, err := getPendingInvitation(invitationID, "invitee_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	club, err := getClubByID(invitation.ClubID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCanJoin(userID, club); err != nil {
+		return nil, err
+	}
+
+	err = addMember(userID, club.ID, RoleMember, func(tx *gorm.DB) error {
+		return respondToInvitationTx(tx, invitation, InvitationAccepted)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	text := fmt.Sprintf("%s accepted %s's invitation.", mention(userID), mention(invitation.InviterID))
+	if err := logClubEventTx(db.DB, userID, club.ID, ActionInvitationAccepted, text); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func DeclineInvitation(userID, invitationID uint) (*ClubInvitation, error) {
+	invitation, err := getPendingInvitation(invitationID, "invitee_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := respondToInvitationTx(db.DB, invitation, InvitationDeclined); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// CancelInvitation withdraws an invitation. The inviter and anyone who can
+// manage the club's members may cancel it.
+func CancelInvitation(userID, clubID, invitationID uint) error {
+	invitation, err := getPendingInvitation(invitationID, "club_id = ?", clubID)
+	if err != nil {
+		return err
+	}
+	if invitation.InviterID != userID {
+		if err := requireClubPermissionTx(db.DB, userID, clubID, PermissionManageMembers); err != nil {
+			return err
+		}
+	}
+	return respondToInvitationTx(db.DB, invitation, InvitationCancelled)
+}
+
+func getPendingInvitation(invitationID uint, condition string, value uint) (*ClubInvitation, error) {
+	var invitation ClubInvitation
+
+	err := db.DB.
+		Where("id = ? AND status = ?", invitationID, InvitationPending).
+		Where(condition, value).
+		First(&invitation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// respondToInvitationTx moves a pending invitation to status, failing if it
+// was answered in the meantime.
+func respondToInvitationTx(tx *gorm.DB, invitation *ClubInvitation, status string) error {
+	now := time.Now()
+
+	result := tx.Model(&ClubInvitation{}).
+		Where("id = ? AND status = ?", invitation.ID, InvitationPending).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"responded_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+
+	invitation.Status = status
+	invitation.RespondedAt = &now
+	return nil
+}
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"klubRanks/db"
+
+	"gorm.io/gorm"
+)
+
+// ClubJoinRequest is created when someone uses an invite code of a private
+// club. Admins approve or reject it.
+type ClubJoinRequest struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	ClubID uint   `gorm:"not null;index" json:"club_id"`
+	UserID uint   `gorm:"not null;index" json:"user_id"`
+	Status string `gorm:"not null;index" json:"status"`
+	// Role granted on approval, taken from the invite that was used.
+	Role      string     `gorm:"not null" json:"role"`
+	DecidedBy *uint      `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+const (
+	JoinRequestPending   = "pending"
+	JoinRequestApproved  = "approved"
+	JoinRequestRejected  = "rejected"
+	JoinRequestCancelled = "cancelled"
+)
+
+var (
+	ErrJoinRequestPending  = errors.New("you already have a pending request to join this club")
+	ErrJoinRequestNotFound = errors.New("join request not found")
+)
+
+func createJoinRequest(userID, clubID uint, invite *ClubInvite) (*ClubJoinRequest, error) {
+	request := ClubJoinRequest{
+		ClubID:    clubID,
+		UserID:    userID,
+		Status:    JoinRequestPending,
+		Role:      invite.Role,
+		CreatedAt: time.Now(),
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&ClubJoinRequest{}).
+			Where("user_id = ? AND club_id = ? AND status = ?", userID, clubID, JoinRequestPending).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrJoinRequestPending
+		}
+
+		// The invite is used up by the request so usage limits also bound
+		// how many people can ask to join.
+		if err := useInviteTx(tx, invite); err != nil {
+			return err
+		}
+		return tx.Create(&request).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// GetPendingJoinRequestsForClub returns the requests waiting for a decision,
+// oldest first.
+func GetPendingJoinRequestsForClub(clubID uint) ([]ClubJoinRequest, error) {
+	var requests []ClubJoinRequest
+
+	err := db.DB.
+		Where("club_id = ? AND status = ?", clubID, JoinRequestPending).
+		Order("created_at ASC").
+		Find(&requests).Error
+
+	return requests, err
+}
+
+func GetPendingJoinRequestsForUser(userID uint) ([]ClubJoinRequest, error) {
+	var requests []ClubJoinRequest
+
+	err := db.DB.
+		Where("user_id = ? AND status = ?", userID, JoinRequestPending).
+		Order("created_at DESC").
+		Find(&requests).Error
+
+	return requests, err
+}
+
+// ApproveJoinRequest adds the requester to the club through the regular
+// join path.
+func ApproveJoinRequest(actorID, clubID, requestID uint) (*ClubJoinRequest, error) {
+	request, err := getPendingJoinRequest(clubID, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireClubPermissionTx(db.DB, actorID, clubID, PermissionManageMembers); err != nil {
+		return nil, err
+	}
+	club, err := getClubByID(clubID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCanJoin(request.UserID, club); err != nil {
+		return nil, err
+	}
+
+	err = addMember(request.UserID, clubID, request.Role, func(tx *gorm.DB) error {
+		return decideJoinRequestTx(tx, request, actorID, JoinRequestApproved)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func RejectJoinRequest(actorID, clubID, requestID uint) (*ClubJoinRequest, error) {
+	request, err := getPendingJoinRequest(clubID, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionManageMembers); err != nil {
+			return err
+		}
+		return decideJoinRequestTx(tx, request, actorID, JoinRequestRejected)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// CancelJoinRequest withdraws one of the user's own pending requests.
+func CancelJoinRequest(userID, requestID uint) error {
+	result := db.DB.
+		Model(&ClubJoinRequest{}).
+		Where("id = ? AND user_id = ? AND status = ?", requestID, userID, JoinRequestPending).
+		Updates(map[string]interface{}{
+			"status":     JoinRequestCancelled,
+			"decided_by": userID,
+			"decided_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJoinRequestNotFound
+	}
+	return nil
+}
+
+func getPendingJoinRequest(clubID, requestID uint) (*ClubJoinRequest, error) {
+	var request ClubJoinRequest
+
+	err := db.DB.
+		Where("id = ? AND club_id = ? AND status = ?", requestID, clubID, JoinRequestPending).
+		First(&request).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJoinRequestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// decideJoinRequestTx moves a pending request to status, failing if someone
+// else decided it first.
+func decideJoinRequestTx(tx *gorm.DB, request *ClubJoinRequest, actorID uint, status string) error {
+	now := time.Now()
+
+	result := tx.Model(&ClubJoinRequest{}).
+		Where("id = ? AND status = ?", request.ID, JoinRequestPending).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"decided_by": actorID,
+			"decided_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJoinRequestNotFound
+	}
+
+	request.Status = status
+	request.DecidedBy = &actorID
+	request.DecidedAt = &now
+	return nil
+}
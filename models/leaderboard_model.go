@@ -1,6 +1,8 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"klubRanks/db"
@@ -22,6 +24,81 @@ func (LeaderboardEntry) TableName() string {
 	return "leaderboard"
 }
 
+// ActionScoreAdjusted logs a manual score correction. The points are kept
+// in ActivityLog.Amount rather than UpdatedScore, so adjustments don't count
+// as check-ins for streaks, goals, duels, challenges or XP.
+const ActionScoreAdjusted = "score_adjusted"
+
+var (
+	ErrCannotAdjustOwnScore = errors.New("you cannot adjust your own score")
+	ErrScoreBelowZero       = errors.New("the adjustment would take the score below zero")
+)
+
+// AdjustScore adds points, which may be negative, to a member's score on
+// behalf of someone with PermissionAdjustScores, and announces it in the
+// club chat.
+func AdjustScore(actorID, targetUserID, clubID uint, points int, reason *string) (*LeaderboardEntry, error) {
+	if actorID == targetUserID {
+		return nil, ErrCannotAdjustOwnScore
+	}
+
+	var entry LeaderboardEntry
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionAdjustScores); err != nil {
+			return err
+		}
+
+		result := tx.Model(&LeaderboardEntry{}).
+			Where("user_id = ? AND club_id = ? AND score + ? >= 0", targetUserID, clubID, points).
+			UpdateColumn("score", gorm.Expr("score + ?", points))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			err := tx.Where("user_id = ? AND club_id = ?", targetUserID, clubID).First(&entry).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotClubMember
+			}
+			if err != nil {
+				return err
+			}
+			return ErrScoreBelowZero
+		}
+		if err := tx.Where("user_id = ? AND club_id = ?", targetUserID, clubID).First(&entry).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		log := ActivityLog{
+			UserID:    targetUserID,
+			ClubID:    clubID,
+			Action:    ActionScoreAdjusted,
+			Amount:    points,
+			CreatedAt: now,
+		}
+		if err := tx.Create(&log).Error; err != nil {
+			return err
+		}
+
+		text := fmt.Sprintf("%s adjusted the score of %s by %+d points", mention(actorID), mention(targetUserID), points)
+		if reason != nil && *reason != "" {
+			text += ": " + *reason
+		}
+		message := Message{
+			UserID:    targetUserID,
+			ClubID:    clubID,
+			Message:   text + ".",
+			Timestamp: now,
+			Type:      MessageTypeSystem,
+		}
+		return tx.Create(&message).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
 func AddUserToLeaderboard(userID, clubID uint) error {
 	entry := LeaderboardEntry{
 		UserID: userID,
@@ -31,27 +108,15 @@ func AddUserToLeaderboard(userID, clubID uint) error {
 	return db.DB.Create(&entry).Error
 }
 
-func updateStreaks(userID, clubID uint) error {
-	var entry LeaderboardEntry
-
-	err := db.DB.
-		Where("user_id = ? AND club_id = ?", userID, clubID).
-		First(&entry).Error
-	if err != nil {
-		return err
-	}
-
-	now := time.Now()
+// advanceStreak updates the entry's streaks for a check-in at now. Only the
+// first check-in of a day counts.
+func advanceStreak(entry *LeaderboardEntry, now time.Time) {
 	today := now.Truncate(24 * time.Hour)
 	yesterday := today.AddDate(0, 0, -1)
 
 	switch {
 	case entry.LastCheckedIn == nil:
 		entry.CurrentStreak = 1
-		if entry.LongestStreak < 1 {
-			entry.LongestStreak = 1
-		}
-		entry.LastCheckedIn = &now
 
 	default:
 		lastDay := entry.LastCheckedIn.Truncate(24 * time.Hour)
@@ -59,42 +124,20 @@ func updateStreaks(userID, clubID uint) error {
 		// Checked in yesterday → increment streak
 		if lastDay.Equal(yesterday) {
 			entry.CurrentStreak++
-			if entry.CurrentStreak > entry.LongestStreak {
-				entry.LongestStreak = entry.CurrentStreak
-			}
-			entry.LastCheckedIn = &now
 
 			// Missed a day → reset
 		} else if lastDay.Before(yesterday) {
 			entry.CurrentStreak = 1
-			if entry.LongestStreak < 1 {
-				entry.LongestStreak = 1
-			}
-			entry.LastCheckedIn = &now
 
 			// Same day → do nothing
 		} else {
-			return nil
+			return
 		}
 	}
 
-	return db.DB.Save(&entry).Error
-}
-
-func UpdateLeaderboardScore(userID, clubID uint, delta int) error {
-	if err := updateStreaks(userID, clubID); err != nil {
-		return err
+	if entry.CurrentStreak > entry.LongestStreak {
+		entry.LongestStreak = entry.CurrentStreak
 	}
-
-	AddActivityLog(userID, clubID, delta, ActionUpdate)
-
-	return db.DB.
-		Model(&LeaderboardEntry{}).
-		Where("user_id = ? AND club_id = ?", userID, clubID).
-		UpdateColumns(map[string]interface{}{
-			"score":          gorm.Expr("score + ?", delta),
-			"last_checkedin": time.Now(),
-		}).Error
 }
 
 func GetLeaderboardForClub(clubID uint, limit int) ([]LeaderboardEntry, error) {
@@ -123,6 +166,38 @@ func GetLeaderboardEntryForUser(userID, clubID uint) (*LeaderboardEntry, error)
 	return &entry, nil
 }
 
+// GetUserRanks ranks the user in each of their clubs like GetUserRankInClub,
+// in one query, keyed by club ID.
+func GetUserRanks(userID uint) (map[uint]int, error) {
+	var rows []struct {
+		ClubID uint
+		Rank   int
+	}
+
+	query := `
+	SELECT me.club_id, COUNT(l.id) + 1 AS rank
+	FROM leaderboard me
+	LEFT JOIN leaderboard l
+	  ON l.club_id = me.club_id
+	  AND (
+	    l.score > me.score OR
+	    (l.score = me.score AND l.last_checkedin > me.last_checkedin)
+	  )
+	WHERE me.user_id = ?
+	GROUP BY me.club_id
+	`
+
+	if err := db.DB.Raw(query, userID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	ranks := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		ranks[row.ClubID] = row.Rank
+	}
+	return ranks, nil
+}
+
 func GetUserRankInClub(userID, clubID uint) (int, error) {
 	var rank int
 
@@ -180,3 +255,14 @@ func GetClubLeaderID(clubID uint) uint {
 
 	return leaderID
 }
+
+func GetLeaderboardEntriesForUser(userID uint) ([]LeaderboardEntry, error) {
+	var entries []LeaderboardEntry
+
+	err := db.DB.
+		Where("user_id = ?", userID).
+		Order("club_id ASC").
+		Find(&entries).Error
+
+	return entries, err
+}
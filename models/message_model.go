@@ -1,9 +1,15 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
 	"time"
 
 	"klubRanks/db"
+
+	"gorm.io/gorm"
 )
 
 const (
@@ -12,8 +18,10 @@ const (
 )
 
 type Message struct {
-	ID        uint      `gorm:"primaryKey" json:"message_id"`
-	ClubID    uint      `gorm:"not null;index" json:"club_id"`
+	ID     uint `gorm:"primaryKey" json:"message_id"`
+	ClubID uint `gorm:"not null;index" json:"club_id"`
+	// Set for messages in a team's chat, which the club chat leaves out.
+	TeamID    *uint     `gorm:"index" json:"team_id,omitempty"`
 	UserID    uint      `gorm:"not null;index" json:"user_id"`
 	User      User      `gorm:"foreignKey:UserID" json:"-"` // to preload user info
 	Timestamp time.Time `gorm:"not null;index" json:"timestamp"`
@@ -23,9 +31,130 @@ type Message struct {
 	ReplyTo   *Message  `gorm:"foreignKey:ReplyToID" json:"reply_to,omitempty"`
 }
 
+var (
+	ErrInvalidReply    = errors.New("can only reply to a message in the same chat")
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+var mentionPattern = regexp.MustCompile(`\{\{user:(\d+)\}\}`)
+
+// mention refers to a user in a system message. Mentions are rendered with
+// the user's current name when messages are read, so renamed and deleted
+// users never need their old messages rewritten.
+func mention(userID uint) string {
+	return fmt.Sprintf("{{user:%d}}", userID)
+}
+
+// renderMentions replaces the mentions in system messages, including the
+// ones replied to, with the usernames.
+func renderMentions(messages []Message) error {
+	var system []*Message
+	for i := range messages {
+		if messages[i].Type == MessageTypeSystem {
+			system = append(system, &messages[i])
+		}
+		if reply := messages[i].ReplyTo; reply != nil && reply.Type == MessageTypeSystem {
+			system = append(system, reply)
+		}
+	}
+
+	var ids []uint
+	for _, m := range system {
+		for _, match := range mentionPattern.FindAllStringSubmatch(m.Message, -1) {
+			if id, err := strconv.ParseUint(match[1], 10, 64); err == nil {
+				ids = append(ids, uint(id))
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var users []User
+	if err := db.DB.Select("id", "username", "deleted_at").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return err
+	}
+	names := make(map[string]string, len(users))
+	for _, u := range users {
+		name := u.Username
+		if u.DeletedAt != nil {
+			name = DeletedUserDisplayName
+		}
+		names[mention(u.ID)] = name
+	}
+
+	for _, m := range system {
+		m.Message = mentionPattern.ReplaceAllStringFunc(m.Message, func(s string) string {
+			if name, ok := names[s]; ok {
+				return name
+			}
+			return DeletedUserDisplayName
+		})
+	}
+	return nil
+}
+
+// AddMessage stores the message. Chat messages can only be posted by club
+// members without an active ban. A reply has to be to a message in the same chat, so a club
+// message can't quote a private team message.
 func (m *Message) AddMessage() error {
 	m.Timestamp = time.Now()
-	return db.DB.Create(m).Error
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if m.Type == MessageTypeUser {
+			if err := requireClubMemberTx(tx, m.UserID, m.ClubID); err != nil {
+				return err
+			}
+		}
+		if m.ReplyToID != nil {
+			var target Message
+			err := tx.Select("id", "club_id", "team_id").First(&target, *m.ReplyToID).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidReply
+			}
+			if err != nil {
+				return err
+			}
+			if target.ClubID != m.ClubID || !sameTeam(target.TeamID, m.TeamID) {
+				return ErrInvalidReply
+			}
+		}
+		return tx.Create(m).Error
+	})
+}
+
+// DeleteMessage removes a message from the club's chats. Members can delete
+// their own messages; anything else needs PermissionModerateChat. Replies
+// to the message are kept without the quote.
+func DeleteMessage(actorID, clubID, messageID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var message Message
+		err := tx.Where("id = ? AND club_id = ?", messageID, clubID).First(&message).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if message.Type != MessageTypeUser || message.UserID != actorID {
+			if err := requireClubPermissionTx(tx, actorID, clubID, PermissionModerateChat); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&Message{}).Where("reply_to_id = ?", message.ID).Update("reply_to_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&message).Error
+	})
+}
+
+func sameTeam(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
 }
 
 func GetMessagesForClub(clubID uint, limit, offset int) ([]Message, error) {
@@ -35,11 +164,45 @@ func GetMessagesForClub(clubID uint, limit, offset int) ([]Message, error) {
 		Preload("User").
 		Preload("ReplyTo").
 		Preload("ReplyTo.User").
-		Where("club_id = ?", clubID).
+		Where("club_id = ? AND team_id IS NULL", clubID).
+		Order("timestamp DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, renderMentions(messages)
+}
+
+func GetMessagesForTeam(teamID uint, limit, offset int) ([]Message, error) {
+	var messages []Message
+
+	err := db.DB.
+		Preload("User").
+		Preload("ReplyTo").
+		Preload("ReplyTo.User").
+		Where("team_id = ?", teamID).
 		Order("timestamp DESC").
 		Limit(limit).
 		Offset(offset).
 		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, renderMentions(messages)
+}
+
+// GetMessagesByUser returns the chat messages the user wrote, oldest first.
+func GetMessagesByUser(userID uint) ([]Message, error) {
+	var messages []Message
+
+	err := db.DB.
+		Where("user_id = ? AND type = ?", userID, MessageTypeUser).
+		Order("timestamp ASC").
+		Find(&messages).Error
 
 	return messages, err
 }
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"klubRanks/db"
+)
+
+// SigningKey is a key pair used to sign JWTs. Keys are kept until every
+// token they signed has expired. PrivateKey is encrypted with the configured
+// key encryption key, except in dev mode without one.
+type SigningKey struct {
+	ID          uint       `gorm:"primaryKey"`
+	Kid         string     `gorm:"not null;uniqueIndex"`
+	Algorithm   string     `gorm:"not null"`
+	PrivateKey  string     `gorm:"not null"`
+	ActivatesAt time.Time  `gorm:"not null;index"`
+	ExpiresAt   *time.Time `gorm:"index"`
+	CreatedAt   time.Time
+}
+
+func CreateSigningKey(key *SigningKey) error {
+	key.CreatedAt = time.Now()
+	return db.DB.Create(key).Error
+}
+
+// GetSigningKeys returns every key that may still verify tokens, oldest
+// activation first.
+func GetSigningKeys(now time.Time) ([]SigningKey, error) {
+	var keys []SigningKey
+
+	err := db.DB.
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Order("activates_at ASC").
+		Find(&keys).Error
+
+	return keys, err
+}
+
+func SetSigningKeyExpiry(id uint, expiresAt time.Time) error {
+	return db.DB.
+		Model(&SigningKey{}).
+		Where("id = ?", id).
+		Update("expires_at", expiresAt).Error
+}
+
+func SetSigningKeyPrivateKey(id uint, privateKey string) error {
+	return db.DB.
+		Model(&SigningKey{}).
+		Where("id = ?", id).
+		Update("private_key", privateKey).Error
+}
+
+func DeleteExpiredSigningKeys(now time.Time) error {
+	return db.DB.
+		Where("expires_at IS NOT NULL AND expires_at <= ?", now).
+		Delete(&SigningKey{}).Error
+}
@@ -0,0 +1,357 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"klubRanks/db"
+
+	"gorm.io/gorm"
+)
+
+// ClubTeam is a group of members inside a club, like a department, that
+// competes on the team leaderboard and has its own chat. A member is in at
+// most one team.
+type ClubTeam struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ClubID    uint      `gorm:"not null;index" json:"club_id"`
+	Name      string    `gorm:"not null" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// How member scores add up to a team score.
+const (
+	TeamScoringSum     = "sum"
+	TeamScoringAverage = "average"
+	TeamScoringTopN    = "top"
+)
+
+const (
+	ActionTeamJoined = "team_joined"
+	ActionTeamLeft   = "team_left"
+)
+
+var (
+	ErrTeamNotFound           = errors.New("team not found")
+	ErrTeamExists             = errors.New("club already has a team with this name")
+	ErrTeamSelfSelectDisabled = errors.New("team membership is assigned by the club admins")
+	ErrNotTeamMember          = errors.New("you are not a member of this team")
+	ErrInvalidTeamScoring     = errors.New("team scoring must be one of sum, average or top")
+)
+
+// TeamStanding is a team's place on the team leaderboard.
+type TeamStanding struct {
+	Team        ClubTeam
+	MemberCount int
+	Score       float64
+}
+
+func GetClubTeams(clubID uint) ([]ClubTeam, error) {
+	var teams []ClubTeam
+
+	err := db.DB.
+		Where("club_id = ?", clubID).
+		Order("name ASC").
+		Find(&teams).Error
+
+	return teams, err
+}
+
+func GetClubTeam(clubID, teamID uint) (*ClubTeam, error) {
+	return getClubTeamTx(db.DB, clubID, teamID)
+}
+
+func getClubTeamTx(tx *gorm.DB, clubID, teamID uint) (*ClubTeam, error) {
+	var team ClubTeam
+
+	err := tx.Where("id = ? AND club_id = ?", teamID, clubID).First(&team).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTeamNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+// CreateTeam adds a team on behalf of someone who can manage members.
+func CreateTeam(actorID, clubID uint, name string) (*ClubTeam, error) {
+	team := ClubTeam{
+		ClubID:    clubID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionManageMembers); err != nil {
+			return err
+		}
+		if err := checkTeamNameTx(tx, clubID, 0, name); err != nil {
+			return err
+		}
+		return tx.Create(&team).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+func RenameTeam(actorID, clubID, teamID uint, name string) (*ClubTeam, error) {
+	var team *ClubTeam
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionManageMembers); err != nil {
+			return err
+		}
+		var err error
+		if team, err = getClubTeamTx(tx, clubID, teamID); err != nil {
+			return err
+		}
+		if err := checkTeamNameTx(tx, clubID, teamID, name); err != nil {
+			return err
+		}
+
+		team.Name = name
+		return tx.Model(team).Update("name", name).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// DeleteTeam removes a team and its chat. Its members stay in the club
+// without a team.
+func DeleteTeam(actorID, clubID, teamID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionManageMembers); err != nil {
+			return err
+		}
+		if _, err := getClubTeamTx(tx, clubID, teamID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Member{}).Where("team_id = ?", teamID).Update("team_id", nil).Error; err != nil {
+			return err
+		}
+		// Replies can only be within the team chat, but clear any left from
+		// before that was enforced.
+		err := tx.Model(&Message{}).
+			Where("reply_to_id IN (?)", tx.Model(&Message{}).Select("id").Where("team_id = ?", teamID)).
+			Update("reply_to_id", nil).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("team_id = ?", teamID).Delete(&Message{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&ClubTeam{}, teamID).Error
+	})
+}
+
+func checkTeamNameTx(tx *gorm.DB, clubID, teamID uint, name string) error {
+	var count int64
+	err := tx.Model(&ClubTeam{}).
+		Where("club_id = ? AND id <> ? AND LOWER(name) = ?", clubID, teamID, strings.ToLower(name)).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTeamExists
+	}
+	return nil
+}
+
+// JoinTeam moves a member into a team of their choice, leaving their
+// current one. The club has to allow self-selection.
+func JoinTeam(userID, clubID, teamID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireTeamSelfSelectTx(tx, clubID); err != nil {
+			return err
+		}
+		return setMemberTeamTx(tx, userID, clubID, &teamID)
+	})
+}
+
+// LeaveTeam takes a member out of their team. The club has to allow
+// self-selection.
+func LeaveTeam(userID, clubID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireTeamSelfSelectTx(tx, clubID); err != nil {
+			return err
+		}
+		return setMemberTeamTx(tx, userID, clubID, nil)
+	})
+}
+
+// AssignTeam puts a member into a team, or takes them out of theirs when
+// teamID is nil, on behalf of someone who can manage members.
+func AssignTeam(actorID, targetUserID, clubID uint, teamID *uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionManageMembers); err != nil {
+			return err
+		}
+		return setMemberTeamTx(tx, targetUserID, clubID, teamID)
+	})
+}
+
+func requireTeamSelfSelectTx(tx *gorm.DB, clubID uint) error {
+	var club Club
+	if err := tx.Select("team_self_select").First(&club, clubID).Error; err != nil {
+		return err
+	}
+	if !club.TeamSelfSelect {
+		return ErrTeamSelfSelectDisabled
+	}
+	return nil
+}
+
+func setMemberTeamTx(tx *gorm.DB, userID, clubID uint, teamID *uint) error {
+	var member Member
+	if err := tx.Where("user_id = ? AND club_id = ?", userID, clubID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotClubMember
+		}
+		return err
+	}
+
+	var team *ClubTeam
+	if teamID != nil {
+		var err error
+		if team, err = getClubTeamTx(tx, clubID, *teamID); err != nil {
+			return err
+		}
+	}
+	if (member.TeamID == nil && teamID == nil) || (member.TeamID != nil && teamID != nil && *member.TeamID == *teamID) {
+		return nil
+	}
+
+	if err := tx.Model(&member).Update("team_id", teamID).Error; err != nil {
+		return err
+	}
+
+	if team == nil {
+		return logClubEventTx(tx, userID, clubID, ActionTeamLeft,
+			fmt.Sprintf("%s is no longer in a team.", mention(userID)))
+	}
+	return logClubEventTx(tx, userID, clubID, ActionTeamJoined,
+		fmt.Sprintf("%s joined team %s.", mention(userID), team.Name))
+}
+
+// UpdateTeamSettings sets whether members pick their own team and how the
+// team leaderboard adds up member scores. topN is only used with top scoring.
+func UpdateTeamSettings(actorID, clubID uint, selfSelect bool, scoring string, topN *int) (*Club, error) {
+	if scoring != TeamScoringSum && scoring != TeamScoringAverage && scoring != TeamScoringTopN {
+		return nil, ErrInvalidTeamScoring
+	}
+	if scoring != TeamScoringTopN {
+		topN = nil
+	}
+
+	var club Club
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := requireClubPermissionTx(tx, actorID, clubID, PermissionEditClub); err != nil {
+			return err
+		}
+		err := tx.Model(&Club{}).Where("id = ?", clubID).Updates(map[string]interface{}{
+			"team_self_select": selfSelect,
+			"team_scoring":     scoring,
+			"team_top_n":       topN,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.First(&club, clubID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &club, nil
+}
+
+// GetTeamLeaderboard ranks the club's teams by their members' leaderboard
+// scores, combined the way the club's team scoring says.
+func GetTeamLeaderboard(clubID uint) ([]TeamStanding, error) {
+	club, err := getClubByID(clubID)
+	if err != nil {
+		return nil, err
+	}
+	teams, err := GetClubTeams(clubID)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		TeamID uint
+		Score  int
+	}
+	err = db.DB.
+		Table("members").
+		Select("members.team_id, COALESCE(leaderboard.score, 0) AS score").
+		Joins("LEFT JOIN leaderboard ON leaderboard.user_id = members.user_id AND leaderboard.club_id = members.club_id").
+		Where("members.club_id = ? AND members.team_id IS NOT NULL", clubID).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make(map[uint][]int)
+	for _, r := range rows {
+		scores[r.TeamID] = append(scores[r.TeamID], r.Score)
+	}
+
+	standings := make([]TeamStanding, 0, len(teams))
+	for _, team := range teams {
+		standings = append(standings, TeamStanding{
+			Team:        team,
+			MemberCount: len(scores[team.ID]),
+			Score:       club.teamScore(scores[team.ID]),
+		})
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i].Score > standings[j].Score
+	})
+	return standings, nil
+}
+
+func (c *Club) teamScore(scores []int) float64 {
+	if len(scores) == 0 {
+		return 0
+	}
+
+	switch c.TeamScoring {
+	case TeamScoringAverage:
+		total := 0
+		for _, s := range scores {
+			total += s
+		}
+		return float64(total) / float64(len(scores))
+
+	case TeamScoringTopN:
+		sort.Sort(sort.Reverse(sort.IntSlice(scores)))
+		if c.TeamTopN != nil && *c.TeamTopN < len(scores) {
+			scores = scores[:*c.TeamTopN]
+		}
+	}
+
+	total := 0
+	for _, s := range scores {
+		total += s
+	}
+	return float64(total)
+}
+
+// IsTeamMember reports whether the user is in the team.
+func IsTeamMember(userID, clubID, teamID uint) (bool, error) {
+	var count int64
+	err := db.DB.
+		Model(&Member{}).
+		Where("user_id = ? AND club_id = ? AND team_id = ?", userID, clubID, teamID).
+		Count(&count).Error
+	return count > 0, err
+}
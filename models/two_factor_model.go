@@ -0,0 +1,316 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"klubRanks/db"
+	"klubRanks/utils"
+
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+// MaxTwoFactorAttempts is how many codes can be tried with one login
+// challenge before it is locked.
+const MaxTwoFactorAttempts = 5
+
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null;index" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TwoFactorChallenge backs the challenge token handed out after the password
+// step of a login. It can be redeemed once and tried MaxTwoFactorAttempts
+// times.
+type TwoFactorChallenge struct {
+	ID        string     `gorm:"primaryKey" json:"-"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	Attempts  int        `gorm:"not null;default:0" json:"attempts"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	ExpiresAt time.Time  `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+var (
+	ErrTwoFactorChallengeInvalid = errors.New("login challenge is expired, used or locked; log in again")
+	ErrTwoFactorEnabled          = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled       = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotStarted       = errors.New("two-factor enrollment has not been started")
+	ErrInvalidTwoFactor          = errors.New("invalid authentication code")
+)
+
+// BeginTOTPEnrollment stores a fresh secret for the user. It only takes
+// effect once confirmed with a code from the authenticator app.
+func BeginTOTPEnrollment(userID uint) (string, error) {
+	user, err := getTwoFactorUser(db.DB, userID)
+	if err != nil {
+		return "", err
+	}
+	if user.TOTPEnabled {
+		return "", ErrTwoFactorEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+
+	err = db.DB.
+		Model(&User{}).
+		Where("id = ?", userID).
+		Update("totp_secret", secret).Error
+
+	return secret, err
+}
+
+// ConfirmTOTPEnrollment enables two-factor authentication and returns the
+// plain recovery codes, which are only ever shown this once.
+func ConfirmTOTPEnrollment(userID uint, code string) ([]string, error) {
+	var codes []string
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := getTwoFactorUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabled {
+			return ErrTwoFactorEnabled
+		}
+		if user.TOTPSecret == "" {
+			return ErrTwoFactorNotStarted
+		}
+
+		step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return ErrInvalidTwoFactor
+		}
+
+		err = tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+
+	return codes, err
+}
+
+// CreateTwoFactorChallenge starts the second login step for the user and
+// returns the challenge ID to embed in the challenge token.
+func CreateTwoFactorChallenge(userID uint, expiry time.Duration) (string, error) {
+	id, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	challenge := TwoFactorChallenge{
+		ID:        id,
+		UserID:    userID,
+		ExpiresAt: now.Add(expiry),
+		CreatedAt: now,
+	}
+	if err := db.DB.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// RedeemTwoFactorChallenge checks a code against a login challenge. Every
+// try counts against the challenge, which is locked after
+// MaxTwoFactorAttempts; a correct code uses it up.
+func RedeemTwoFactorChallenge(challengeID string, userID uint, code string) error {
+	// Count the attempt before checking the code, and outside the
+	// transaction below, so failed tries are recorded and concurrent ones
+	// can't exceed the limit.
+	result := db.DB.Model(&TwoFactorChallenge{}).
+		Where("id = ? AND user_id = ? AND used_at IS NULL AND attempts < ? AND expires_at > ?",
+			challengeID, userID, MaxTwoFactorAttempts, time.Now()).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorChallengeInvalid
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactorTx(tx, userID, code); err != nil {
+			return err
+		}
+
+		result := tx.Model(&TwoFactorChallenge{}).
+			Where("id = ? AND used_at IS NULL", challengeID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTwoFactorChallengeInvalid
+		}
+		return nil
+	})
+}
+
+// VerifySecondFactor checks a code for a signed-in user re-confirming a
+// sensitive change.
+func VerifySecondFactor(userID uint, code string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return verifySecondFactorTx(tx, userID, code)
+	})
+}
+
+// DeleteExpiredTwoFactorChallenges removes challenges that can no longer be
+// redeemed.
+func DeleteExpiredTwoFactorChallenges(now time.Time) error {
+	return db.DB.Where("expires_at <= ?", now).Delete(&TwoFactorChallenge{}).Error
+}
+
+// verifySecondFactorTx accepts either a current TOTP code or an unused
+// recovery code. A recovery code is consumed when used.
+func verifySecondFactorTx(tx *gorm.DB, userID uint, code string) error {
+	user, err := getTwoFactorUser(tx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		// Each code may only be used once; the conditional update also
+		// stops two logins racing with the same code.
+		result := tx.Model(&User{}).
+			Where("id = ? AND totp_last_step < ?", userID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactor
+		}
+		return nil
+	}
+
+	result := tx.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactor
+	}
+	return nil
+}
+
+func DisableTOTP(userID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+func RegenerateRecoveryCodes(userID uint) ([]string, error) {
+	var codes []string
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := getTwoFactorUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !user.TOTPEnabled {
+			return ErrTwoFactorNotEnabled
+		}
+
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+
+	return codes, err
+}
+
+func CountUnusedRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+
+	err := db.DB.
+		Model(&RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+
+	return count, err
+}
+
+func IsTwoFactorEnabled(userID uint) (bool, error) {
+	user, err := getTwoFactorUser(db.DB, userID)
+	if err != nil {
+		return false, err
+	}
+	return user.TOTPEnabled, nil
+}
+
+func getTwoFactorUser(tx *gorm.DB, userID uint) (*User, error) {
+	var user User
+
+	err := tx.
+		Select("id", "username", "totp_secret", "totp_enabled", "totp_last_step").
+		First(&user, userID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]RecoveryCode, 0, recoveryCodeCount)
+	now := time.Now()
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := utils.GenerateRandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+
+		codes = append(codes, code)
+		rows = append(rows, RecoveryCode{
+			UserID:    userID,
+			CodeHash:  utils.HashToken(normalizeRecoveryCode(code)),
+			CreatedAt: now,
+		})
+	}
+
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Recovery codes are shown as "xxxxx-xxxxx" but accepted without the dash
+// and in any case.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
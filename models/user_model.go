@@ -2,19 +2,56 @@ package models
 
 import (
 	"errors"
+	"fmt"
 	"klubRanks/db"
 	"klubRanks/utils"
+	"os"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"uniqueIndex;not null" json:"username"`
-	Password  string    `gorm:"not null" json:"-"`
-	AvatarID  string    `gorm:"default:default" json:"avatar_id"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Username    string    `gorm:"uniqueIndex;not null" json:"username"`
+	Password    string    `gorm:"not null" json:"-"`
+	AvatarID    string    `gorm:"default:default" json:"avatar_id"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	Timezone    string    `gorm:"not null;default:UTC" json:"timezone"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Earned by checking in, across all clubs.
+	XP int `gorm:"not null;default:0" json:"xp"`
+
+	TOTPSecret   string `gorm:"column:totp_secret" json:"-"`
+	TOTPEnabled  bool   `gorm:"column:totp_enabled;not null;default:false" json:"-"`
+	TOTPLastStep int64  `gorm:"column:totp_last_step;not null;default:0" json:"-"`
+
+	// Tokens issued at or before this time are rejected by the auth middleware.
+	TokensRevokedAt *time.Time `json:"-"`
+	// Set when the account is deleted; the row is kept, anonymized, so that
+	// messages and activity logs keep a valid author.
+	DeletedAt *time.Time `gorm:"index" json:"-"`
+}
+
+const DeletedUserDisplayName = "Deleted user"
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUsernameTaken      = errors.New("username is already taken")
+)
+
+// usernameLowerIndex makes usernames of live accounts unique ignoring case.
+// Deleted accounts are renamed to deleted_<id>, so they are left out.
+const usernameLowerIndex = "idx_users_username_lower"
+
+type UserAggregateStats struct {
+	ClubCount     int
+	TotalScore    int
+	TotalCheckIns int
+	LongestStreak int
 }
 
 func UpdateAvatar(userID uint, avatarID string) error {
@@ -29,7 +66,7 @@ func GetUserByID(id uint) (*User, error) {
 	var user User
 
 	err := db.DB.
-		Select("id", "username", "avatar_id", "created_at").
+		Select("id", "username", "avatar_id", "display_name", "bio", "timezone", "created_at", "xp").
 		First(&user, id).Error
 
 	if err != nil {
@@ -39,6 +76,143 @@ func GetUserByID(id uint) (*User, error) {
 	return &user, nil
 }
 
+// GetUsersByIDs loads the users with the given IDs, keyed by ID, with the
+// same fields as GetUserByID.
+func GetUsersByIDs(ids []uint) (map[uint]*User, error) {
+	var users []User
+
+	err := db.DB.
+		Select("id", "username", "avatar_id", "display_name", "bio", "timezone", "created_at", "xp").
+		Where("id IN ?", ids).
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+	return byID, nil
+}
+
+// IsUsernameTaken reports whether the username, ignoring case, belongs to
+// another user, either currently or as one of their previous usernames.
+// Pass excludeUserID = 0 when there is no current user (e.g. signup).
+func IsUsernameTaken(username string, excludeUserID uint) (bool, error) {
+	var count int64
+
+	err := db.DB.
+		Model(&User{}).
+		Where("LOWER(username) = LOWER(?) AND id <> ?", username, excludeUserID).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	err = db.DB.
+		Model(&UsernameChange{}).
+		Where("LOWER(old_username) = LOWER(?) AND user_id <> ?", username, excludeUserID).
+		Count(&count).Error
+
+	return count > 0, err
+}
+
+// UpdateProfile applies the non-nil fields and records the old username
+// when it changes.
+func UpdateProfile(userID uint, username, displayName, bio, timezone *string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{}
+
+		if username != nil && *username != user.Username {
+			change := UsernameChange{
+				UserID:      userID,
+				OldUsername: user.Username,
+				NewUsername: *username,
+				ChangedAt:   time.Now(),
+			}
+			if err := tx.Create(&change).Error; err != nil {
+				return err
+			}
+			updates["username"] = *username
+		}
+		if displayName != nil {
+			updates["display_name"] = *displayName
+		}
+		if bio != nil {
+			updates["bio"] = *bio
+		}
+		if timezone != nil {
+			updates["timezone"] = *timezone
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+
+		err := tx.Model(&User{}).Where("id = ?", userID).Updates(updates).Error
+		if db.IsUniqueViolation(err) {
+			return ErrUsernameTaken
+		}
+		return err
+	})
+}
+
+// GetUserByUsername resolves a username to a user, falling back to the
+// username history so that mentions of an old name still find the user.
+func GetUserByUsername(username string) (*User, error) {
+	var user User
+
+	err := db.DB.
+		Select("id").
+		Where("LOWER(username) = LOWER(?) AND deleted_at IS NULL", username).
+		First(&user).Error
+	if err == nil {
+		return GetUserByID(user.ID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var change UsernameChange
+	err = db.DB.
+		Where("LOWER(old_username) = LOWER(?)", username).
+		Order("changed_at DESC").
+		First(&change).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return GetUserByID(change.UserID)
+}
+
+func GetUserAggregateStats(userID uint) (UserAggregateStats, error) {
+	var stats UserAggregateStats
+
+	err := db.DB.
+		Model(&LeaderboardEntry{}).
+		Select("COUNT(*) AS club_count, COALESCE(SUM(score), 0) AS total_score, COALESCE(MAX(longest_streak), 0) AS longest_streak").
+		Where("user_id = ?", userID).
+		Scan(&stats).Error
+	if err != nil {
+		return stats, err
+	}
+
+	var checkIns int64
+	err = db.DB.
+		Model(&ActivityLog{}).
+		Where("user_id = ? AND updated_score > 0", userID).
+		Count(&checkIns).Error
+	stats.TotalCheckIns = int(checkIns)
+
+	return stats, err
+}
+
 func (u *User) Save() error {
 	hashedPassword, err := utils.HashPassword(u.Password)
 	if err != nil {
@@ -48,29 +222,361 @@ func (u *User) Save() error {
 	u.Password = hashedPassword
 	u.CreatedAt = time.Now()
 
-	return db.DB.Create(u).Error
+	err = db.DB.Create(u).Error
+	if db.IsUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+// CreateUsernameIndex adds the case-insensitive unique index on usernames,
+// which gorm tags can't express. Live accounts whose username clashes with
+// an older one's, ignoring case, are renamed first so the index can be
+// built; the old name is kept in their username history.
+func CreateUsernameIndex() error {
+	if db.DB.Migrator().HasIndex(&User{}, usernameLowerIndex) {
+		return nil
+	}
+
+	var users []User
+	err := db.DB.
+		Select("id", "username").
+		Where("deleted_at IS NULL").
+		Where("EXISTS (SELECT 1 FROM users older WHERE LOWER(older.username) = LOWER(users.username) AND older.deleted_at IS NULL AND older.id < users.id)").
+		Order("id ASC").
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		username := fmt.Sprintf("%s_%d", user.Username, user.ID)
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			change := UsernameChange{
+				UserID:      user.ID,
+				OldUsername: user.Username,
+				NewUsername: username,
+				ChangedAt:   time.Now(),
+			}
+			if err := tx.Create(&change).Error; err != nil {
+				return err
+			}
+			return tx.Model(&user).Update("username", username).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.DB.Exec("CREATE UNIQUE INDEX " + usernameLowerIndex +
+		" ON users (LOWER(username)) WHERE deleted_at IS NULL").Error
 }
 
 func (u *User) ValidateCredentials() error {
 	var user User
 
 	err := db.DB.
-		Where("username = ?", u.Username).
+		Where("username = ? AND deleted_at IS NULL", u.Username).
 		First(&user).Error
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return errors.New("invalid credentials")
+			return ErrInvalidCredentials
 		}
 		return err
 	}
 
 	if !utils.CheckPasswordHash(u.Password, user.Password) {
-		return errors.New("invalid credentials")
+		return ErrInvalidCredentials
 	}
 
 	u.ID = user.ID
 	u.AvatarID = user.AvatarID
+	u.TOTPEnabled = user.TOTPEnabled
+	u.XP = user.XP
 
 	return nil
 }
+
+// CheckPassword re-authenticates an already logged in user.
+func CheckPassword(userID uint, password string) error {
+	var user User
+
+	err := db.DB.
+		Select("id", "password").
+		Where("deleted_at IS NULL").
+		First(&user, userID).Error
+	if err != nil {
+		return ErrInvalidCredentials
+	}
+
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// SetPassword replaces the user's password. Users who signed up through a
+// login provider have none yet and can set one without currentPassword.
+func SetPassword(userID uint, currentPassword, newPassword string) error {
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+
+		err := tx.
+			Select("id", "password").
+			Where("deleted_at IS NULL").
+			First(&user, userID).Error
+		if err != nil {
+			return err
+		}
+		if user.Password != "" && !utils.CheckPasswordHash(currentPassword, user.Password) {
+			return ErrInvalidCredentials
+		}
+
+		// Only the password read above may be replaced, so two concurrent
+		// first-time requests can't both succeed.
+		result := tx.Model(&User{}).
+			Where("id = ? AND password = ?", userID, user.Password).
+			Update("password", hashedPassword)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidCredentials
+		}
+		return nil
+	})
+}
+
+// IsTokenRevoked reports whether a token issued at issuedAt may no longer be
+// used, either because the account is gone or its tokens were revoked.
+func IsTokenRevoked(userID uint, issuedAt time.Time) (bool, error) {
+	var user User
+
+	err := db.DB.
+		Select("id", "tokens_revoked_at", "deleted_at").
+		First(&user, userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	if user.DeletedAt != nil {
+		return true, nil
+	}
+	if user.TokensRevokedAt != nil && issuedAt.Unix() <= user.TokensRevokedAt.Unix() {
+		return true, nil
+	}
+	return false, nil
+}
+
+// DeleteAccount removes the user's memberships and leaderboard entries, hands
+// clubs they created to another member (or deletes them when nobody is left),
+// scrubs their name from system messages and anonymizes the user row. Messages
+// and activity logs stay attached to the anonymized row. Data exports and
+// their archives are removed as well.
+func DeleteAccount(userID uint) error {
+	exports, err := GetDataExportsForUser(userID)
+	if err != nil {
+		return err
+	}
+	clubs, err := GetMembershipsForUser(userID)
+	if err != nil {
+		return err
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Where("deleted_at IS NULL").First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var createdClubs []Club
+		if err := tx.Where("created_by = ?", userID).Find(&createdClubs).Error; err != nil {
+			return err
+		}
+		for _, club := range createdClubs {
+			var successor Member
+			err := tx.
+				Where("club_id = ? AND user_id <> ?", club.ID, userID).
+				Order(clause.Expr{SQL: "CASE role WHEN ? THEN 0 WHEN ? THEN 1 ELSE 2 END, joined_at ASC", Vars: []interface{}{RoleAdmin, RoleModerator}}).
+				First(&successor).Error
+
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				if err := deleteClubTx(tx, club.ID); err != nil {
+					return err
+				}
+			case err != nil:
+				return err
+			default:
+				if err := setClubOwnerTx(tx, club.ID, &successor); err != nil {
+					return err
+				}
+			}
+		}
+
+		var memberships []Member
+		if err := tx.Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, m := range memberships {
+			leave := ActivityLog{UserID: userID, ClubID: m.ClubID, Action: ActionLeave, CreatedAt: now}
+			if err := tx.Create(&leave).Error; err != nil {
+				return err
+			}
+			message := Message{
+				UserID:    userID,
+				ClubID:    m.ClubID,
+				Message:   "A member deleted their account and left the club.",
+				Timestamp: now,
+				Type:      MessageTypeSystem,
+			}
+			if err := tx.Create(&message).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&Member{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&LeaderboardEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&ActionScore{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&UserBadge{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&Goal{}).Error; err != nil {
+			return err
+		}
+		if err := cancelOpenDuelsTx(tx, userID, 0); err != nil {
+			return err
+		}
+
+		// System messages name users with mentions that render as "Deleted
+		// user" from now on. Messages stored before mentions existed embed
+		// the username, including any previous ones.
+		names := []string{user.Username}
+		var history []UsernameChange
+		if err := tx.Where("user_id = ?", userID).Find(&history).Error; err != nil {
+			return err
+		}
+		for _, h := range history {
+			names = append(names, h.OldUsername)
+		}
+		var systemMessages []Message
+		err := tx.Select("id", "message").
+			Where("user_id = ? AND type = ? AND message NOT LIKE ?", userID, MessageTypeSystem, "%{{user:%").
+			Find(&systemMessages).Error
+		if err != nil {
+			return err
+		}
+		for _, m := range systemMessages {
+			text := m.Message
+			for _, name := range names {
+				text = replaceUsername(text, name, DeletedUserDisplayName)
+			}
+			if text == m.Message {
+				continue
+			}
+			if err := tx.Model(&Message{}).Where("id = ?", m.ID).Update("message", text).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&UsernameChange{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&DataExport{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&ExternalIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&APIToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&ClubBan{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&ClubJoinRequest{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&ClubWaitlistEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("invitee_id = ? OR inviter_id = ?", userID, userID).Delete(&ClubInvitation{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"username":          fmt.Sprintf("deleted_%d", userID),
+			"password":          "",
+			"avatar_id":         "default",
+			"display_name":      DeletedUserDisplayName,
+			"bio":               "",
+			"xp":                0,
+			"totp_secret":       "",
+			"totp_enabled":      false,
+			"tokens_revoked_at": now,
+			"deleted_at":        now,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range exports {
+		if e.FilePath != "" {
+			os.Remove(e.FilePath)
+		}
+	}
+	for _, m := range clubs {
+		admitFromWaitlistAfterLeave(m.ClubID)
+	}
+	return nil
+}
+
+// replaceUsername replaces name in text where it stands on its own, so that
+// "al" does not match inside "alice" or "al_2". A trailing period counts as
+// punctuation unless more of a username follows it.
+func replaceUsername(text, name, replacement string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(text, name)
+		if i < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		end := i + len(name)
+
+		startsWord := i == 0 || !isUsernameByte(text[i-1])
+		endsWord := end == len(text) || !isUsernameByte(text[end]) ||
+			(text[end] == '.' && (end+1 == len(text) || !isUsernameByte(text[end+1])))
+		if startsWord && endsWord {
+			b.WriteString(text[:i])
+			b.WriteString(replacement)
+		} else {
+			b.WriteString(text[:end])
+		}
+		text = text[end:]
+	}
+}
+
+func isUsernameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '-'
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"klubRanks/db"
+)
+
+type UsernameChange struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	OldUsername string    `gorm:"not null;index" json:"old_username"`
+	NewUsername string    `gorm:"not null" json:"new_username"`
+	ChangedAt   time.Time `gorm:"not null" json:"changed_at"`
+}
+
+func GetUsernameHistory(userID uint) ([]UsernameChange, error) {
+	var changes []UsernameChange
+
+	err := db.DB.
+		Where("user_id = ?", userID).
+		Order("changed_at DESC").
+		Find(&changes).Error
+
+	return changes, err
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"klubRanks/db"
+	"klubRanks/logger"
+
+	"gorm.io/gorm"
+)
+
+// ClubWaitlistEntry is someone waiting for a seat in a full club. They are
+// admitted in order as members leave.
+type ClubWaitlistEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ClubID    uint      `gorm:"not null;uniqueIndex:idx_club_waitlist_club_user" json:"club_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_club_waitlist_club_user" json:"user_id"`
+	Role      string    `gorm:"not null" json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ClubWaitlistEntry) TableName() string {
+	return "club_waitlist"
+}
+
+var (
+	ErrClubFull          = errors.New("club is full")
+	ErrAlreadyWaitlisted = errors.New("you are already on the waitlist for this club")
+	ErrNotWaitlisted     = errors.New("you are not on the waitlist for this club")
+)
+
+// reserveSeatTx checks the club has room for one more member. Touching the
+// club row first locks it, so concurrent joins are serialized and cannot
+// both take the last seat.
+func reserveSeatTx(tx *gorm.DB, clubID uint) error {
+	if err := tx.Model(&Club{}).Where("id = ?", clubID).Update("max_members", gorm.Expr("max_members")).Error; err != nil {
+		return err
+	}
+
+	var club Club
+	if err := tx.Select("max_members").First(&club, clubID).Error; err != nil {
+		return err
+	}
+	if club.MaxMembers == nil {
+		return nil
+	}
+
+	var count int64
+	if err := tx.Model(&Member{}).Where("club_id = ?", clubID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(*club.MaxMembers) {
+		return ErrClubFull
+	}
+	return nil
+}
+
+// joinOrWaitlist adds the user to the club, or to its waitlist when the
+// club is full. The returned entry is nil when the user joined.
+func joinOrWaitlist(userID, clubID uint, role string, inTx func(tx *gorm.DB) error) (*ClubWaitlistEntry, error) {
+	err := addMember(userID, clubID, role, inTx)
+	if !errors.Is(err, ErrClubFull) {
+		return nil, err
+	}
+
+	entry := ClubWaitlistEntry{
+		ClubID:    clubID,
+		UserID:    userID,
+		Role:      role,
+		CreatedAt: time.Now(),
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&ClubWaitlistEntry{}).Where("club_id = ? AND user_id = ?", clubID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyWaitlisted
+		}
+		return tx.Create(&entry).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetWaitlist returns the club's waitlist in admission order.
+func GetWaitlist(clubID uint) ([]ClubWaitlistEntry, error) {
+	var entries []ClubWaitlistEntry
+
+	err := db.DB.
+		Where("club_id = ?", clubID).
+		Order("id ASC").
+		Find(&entries).Error
+
+	return entries, err
+}
+
+// GetWaitlistPosition returns the user's entry on the club's waitlist and
+// its 1-based position.
+func GetWaitlistPosition(clubID, userID uint) (*ClubWaitlistEntry, int, error) {
+	var entry ClubWaitlistEntry
+	err := db.DB.Where("club_id = ? AND user_id = ?", clubID, userID).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, ErrNotWaitlisted
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ahead int64
+	err = db.DB.Model(&ClubWaitlistEntry{}).Where("club_id = ? AND id < ?", clubID, entry.ID).Count(&ahead).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return &entry, int(ahead) + 1, nil
+}
+
+func LeaveWaitlist(userID, clubID uint) error {
+	result := db.DB.Where("club_id = ? AND user_id = ?", clubID, userID).Delete(&ClubWaitlistEntry{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotWaitlisted
+	}
+	return nil
+}
+
+// AdmitFromWaitlist fills free seats with people from the waitlist, in
+// order. Entries of users who can no longer join are dropped.
+func AdmitFromWaitlist(clubID uint) error {
+	club, err := getClubByID(clubID)
+	if err != nil {
+		return err
+	}
+
+	for {
+		var entry ClubWaitlistEntry
+		err := db.DB.Where("club_id = ?", clubID).Order("id ASC").First(&entry).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := checkCanJoin(entry.UserID, club); err != nil {
+			if errors.Is(err, ErrClubArchived) {
+				return nil
+			}
+			logger.LogInfo("Dropping waitlist entry of user", entry.UserID, "for club", clubID, ":", err)
+			if err := db.DB.Delete(&entry).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = addMember(entry.UserID, clubID, entry.Role, func(tx *gorm.DB) error {
+			return tx.Delete(&entry).Error
+		})
+		if errors.Is(err, ErrClubFull) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		logger.LogInfo("Admitted user", entry.UserID, "to club", clubID, "from the waitlist")
+	}
+}
+
+// admitFromWaitlistAfterLeave is called once a seat was freed. The leave
+// itself already succeeded, so failures are only logged.
+func admitFromWaitlistAfterLeave(clubID uint) {
+	if err := AdmitFromWaitlist(clubID); err != nil {
+		logger.LogError("Failed to admit from waitlist of club", clubID, ":", err)
+	}
+}
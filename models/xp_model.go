@@ -0,0 +1,101 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// XPRules says how check-ins earn XP and how XP adds up to levels. The
+// values come from the config.
+type XPRules struct {
+	PerCheckIn  int
+	DailyDecay  float64
+	LevelBase   int
+	LevelGrowth float64
+}
+
+const ActionLevelUp = "level_up"
+
+// XPResult is what a check-in earned.
+type XPResult struct {
+	Gained int
+	XP     int
+	Level  int
+	// Whether the check-in took the user to a new level.
+	LeveledUp bool
+}
+
+// Level returns the level a user with the given XP is at, starting at 1.
+func (r XPRules) Level(xp int) int {
+	level := 1
+	need := float64(r.LevelBase)
+	for total := need; float64(xp) >= total; total += need {
+		level++
+		need *= r.LevelGrowth
+	}
+	return level
+}
+
+// awardXPTx credits the user for the check-in just logged in the club
+// inside tx. Every check-in in the same club on the same day earns less than
+// the one before. Reaching a new level is announced in all the user's active
+// clubs.
+func awardXPTx(tx *gorm.DB, userID, clubID uint, rules XPRules, now time.Time) (*XPResult, error) {
+	var result XPResult
+	today := now.Truncate(24 * time.Hour)
+
+	var checkIns int64
+	err := tx.Model(&ActivityLog{}).
+		Where("user_id = ? AND club_id = ? AND updated_score > 0 AND created_at >= ?", userID, clubID, today).
+		Count(&checkIns).Error
+	if err != nil {
+		return nil, err
+	}
+	if checkIns > 0 {
+		// Today's count includes the check-in being credited.
+		checkIns--
+	}
+	result.Gained = int(float64(rules.PerCheckIn) * math.Pow(rules.DailyDecay, float64(checkIns)))
+
+	if result.Gained > 0 {
+		// The update locks the user's row until the check-in commits, so
+		// the XP read below is exactly this check-in's total and concurrent
+		// check-ins can't both see themselves crossing the same level.
+		err = tx.Model(&User{}).
+			Where("id = ?", userID).
+			UpdateColumn("xp", gorm.Expr("xp + ?", result.Gained)).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var user User
+	if err := tx.Select("id", "xp").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	result.XP = user.XP
+	result.Level = rules.Level(user.XP)
+	result.LeveledUp = result.Level > rules.Level(user.XP-result.Gained)
+
+	if !result.LeveledUp {
+		return &result, nil
+	}
+	var clubIDs []uint
+	err = tx.Model(&Member{}).
+		Joins("JOIN clubs ON clubs.id = members.club_id").
+		Where("members.user_id = ? AND clubs.archived_at IS NULL", userID).
+		Pluck("members.club_id", &clubIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	text := fmt.Sprintf("%s reached level %d!", mention(userID), result.Level)
+	for _, id := range clubIDs {
+		if err := logClubEventTx(tx, userID, id, ActionLevelUp, text); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
@@ -0,0 +1,42 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// NewAuthRequest generates a fresh state, PKCE verifier, nonce and browser
+// binding.
+func NewAuthRequest() (AuthRequest, error) {
+	var req AuthRequest
+	var err error
+
+	if req.State, err = randomString(24); err != nil {
+		return req, err
+	}
+	if req.CodeVerifier, err = randomString(32); err != nil {
+		return req, err
+	}
+	if req.Nonce, err = randomString(24); err != nil {
+		return req, err
+	}
+	if req.BrowserBinding, err = randomString(24); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge from the verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,92 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"klubRanks/config"
+	"klubRanks/logger"
+)
+
+var ErrUnknownProvider = errors.New("unknown login provider")
+
+// Identity is what a provider tells us about the person who signed in.
+type Identity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// AuthRequest carries the per-login secrets that must round-trip through
+// the provider: the state, the PKCE verifier and the OIDC nonce.
+type AuthRequest struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+	// BrowserBinding never goes to the provider. It is kept in a cookie in
+	// the browser that started the login, and the callback must present it.
+	BrowserBinding string
+}
+
+// Provider is implemented by every external login provider.
+type Provider interface {
+	Name() string
+	// AuthCodeURL returns the URL the user is sent to in order to sign in.
+	AuthCodeURL(ctx context.Context, req AuthRequest) (string, error)
+	// Exchange trades the authorization code for a verified identity.
+	Exchange(ctx context.Context, code string, req AuthRequest) (*Identity, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{}
+)
+
+// Register makes a provider available by name, replacing any existing one.
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[p.Name()] = p
+}
+
+func Get(name string) (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	p, ok := providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Init registers an OpenID Connect provider for every configured entry.
+// Discovery happens lazily on first use so a provider being down does not
+// stop the server from starting.
+func Init() {
+	for _, cfg := range config.AppConfig.OAuth.Providers {
+		if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			logger.LogError("Skipping login provider with incomplete configuration:", cfg.Name)
+			continue
+		}
+		Register(NewOIDCProvider(cfg))
+		logger.LogInfo("Registered login provider:", cfg.Name)
+	}
+}
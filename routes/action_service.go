@@ -0,0 +1,311 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	actionLeaderboardDefaultLimit = 50
+	actionLeaderboardMaxLimit     = 100
+)
+
+// GetClubActions godoc
+// @Summary List club actions
+// @Description Lists the actions members can check in, the default action first. Only members can list them.
+// @Tags Actions
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.ClubActionResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/actions [get]
+func GetClubActions(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	if !requireClubMember(c, middlewares.GetPrincipal(c).UserID, uint(clubID)) {
+		return
+	}
+
+	actions, err := models.GetClubActions(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := make([]dto.ClubActionResponse, 0, len(actions))
+	for _, action := range actions {
+		resp = append(resp, toClubActionResponse(&action))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateClubAction godoc
+// @Summary Add a club action
+// @Description Needs permission to edit the club
+// @Tags Actions
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param action body dto.ClubActionRequest true "Action"
+// @Success 201 {object} dto.ClubActionResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/actions [post]
+func CreateClubAction(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	action, ok := bindClubAction(c)
+	if !ok {
+		return
+	}
+	if !requireActiveClub(c, uint(clubID)) {
+		return
+	}
+	action.ClubID = uint(clubID)
+
+	userID := middlewares.GetPrincipal(c).UserID
+	if err := models.CreateClubAction(userID, action); err != nil {
+		writeClubActionError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "added action", action.ID, "to club", clubID)
+
+	c.JSON(http.StatusCreated, toClubActionResponse(action))
+}
+
+// UpdateClubAction godoc
+// @Summary Update a club action
+// @Description Needs permission to edit the club. A new weight only applies to future check-ins.
+// @Tags Actions
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param actionId path int true "Action ID"
+// @Param action body dto.ClubActionRequest true "Action"
+// @Success 200 {object} dto.ClubActionResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/actions/{actionId} [put]
+func UpdateClubAction(c *gin.Context) {
+	clubID, actionID, ok := parseClubActionParams(c)
+	if !ok {
+		return
+	}
+
+	action, ok := bindClubAction(c)
+	if !ok {
+		return
+	}
+	if !requireActiveClub(c, clubID) {
+		return
+	}
+	action.ID = actionID
+	action.ClubID = clubID
+
+	if err := models.UpdateClubAction(middlewares.GetPrincipal(c).UserID, action); err != nil {
+		writeClubActionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toClubActionResponse(action))
+}
+
+// DeleteClubAction godoc
+// @Summary Delete a club action
+// @Description Needs permission to edit the club. Removes the action's leaderboard; points already earned stay on the club leaderboard. The last action cannot be deleted.
+// @Tags Actions
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param actionId path int true "Action ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/actions/{actionId} [delete]
+func DeleteClubAction(c *gin.Context) {
+	clubID, actionID, ok := parseClubActionParams(c)
+	if !ok {
+		return
+	}
+	if !requireActiveClub(c, clubID) {
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+	if err := models.DeleteClubAction(userID, clubID, actionID); err != nil {
+		writeClubActionError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "deleted action", actionID, "of club", clubID)
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "action deleted"})
+}
+
+// GetActionLeaderboard godoc
+// @Summary Get an action's leaderboard
+// @Description Ranks members by their total amount of one action. Only members can see it.
+// @Tags Leaderboard
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param actionId path int true "Action ID"
+// @Param limit query int false "Result limit, at most 100" default(50)
+// @Success 200 {array} dto.ActionLeaderboardEntryResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/actions/{actionId}/leaderboard [get]
+func GetActionLeaderboard(c *gin.Context) {
+	clubID, actionID, ok := parseClubActionParams(c)
+	if !ok {
+		return
+	}
+
+	limit := actionLeaderboardDefaultLimit
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = min(parsed, actionLeaderboardMaxLimit)
+		}
+	}
+
+	if !requireClubMember(c, middlewares.GetPrincipal(c).UserID, clubID) {
+		return
+	}
+	if _, err := models.GetClubAction(clubID, actionID); err != nil {
+		writeClubActionError(c, err)
+		return
+	}
+
+	scores, err := models.GetActionLeaderboard(clubID, actionID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := make([]dto.ActionLeaderboardEntryResponse, 0, len(scores))
+	for _, s := range scores {
+		user, err := models.GetUserByID(s.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		resp = append(resp, dto.ActionLeaderboardEntryResponse{
+			User:          toUserDTO(user),
+			Amount:        s.Amount,
+			Points:        s.Points,
+			LastCheckedIn: s.LastCheckedIn,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func parseClubActionParams(c *gin.Context) (uint, uint, bool) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return 0, 0, false
+	}
+	actionID, err := strconv.ParseUint(c.Param("actionId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid action id"})
+		return 0, 0, false
+	}
+	return uint(clubID), uint(actionID), true
+}
+
+func bindClubAction(c *gin.Context) (*models.ClubAction, bool) {
+	var req dto.ClubActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return nil, false
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return nil, false
+	}
+
+	points := 1
+	if req.Points != nil {
+		points = *req.Points
+	}
+	return &models.ClubAction{
+		Name:            strings.TrimSpace(req.Name),
+		Unit:            strings.TrimSpace(req.Unit),
+		Points:          points,
+		CooldownMinutes: req.CooldownMinutes,
+	}, true
+}
+
+func writeClubActionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotClubMember), errors.Is(err, models.ErrPermissionDenied):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrClubActionNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrClubActionExists), errors.Is(err, models.ErrLastClubAction):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+}
+
+// toActionStats pairs each action with the member's totals and when they can
+// check in for it again.
+func toActionStats(actions []models.ClubAction, scores map[uint]models.ActionScore) []dto.ActionStats {
+	stats := make([]dto.ActionStats, 0, len(actions))
+	for _, action := range actions {
+		score := scores[action.ID]
+		stats = append(stats, dto.ActionStats{
+			Action:        toClubActionResponse(&action),
+			Amount:        score.Amount,
+			Points:        score.Points,
+			LastCheckedIn: score.LastCheckedIn,
+			NextCheckIn:   action.NextCheckIn(score.LastCheckedIn),
+		})
+	}
+	return stats
+}
+
+func toClubActionResponse(action *models.ClubAction) dto.ClubActionResponse {
+	return dto.ClubActionResponse{
+		ID:              action.ID,
+		Name:            action.Name,
+		Unit:            action.Unit,
+		Points:          action.Points,
+		CooldownMinutes: action.CooldownMinutes,
+		CreatedAt:       action.CreatedAt,
+	}
+}
@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMyAPITokens godoc
+// @Summary List personal API tokens
+// @Tags API Tokens
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} dto.APITokenResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/tokens [get]
+func GetMyAPITokens(c *gin.Context) {
+	tokens, err := models.GetAPITokensForUser(middlewares.GetPrincipal(c).UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := make([]dto.APITokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		resp = append(resp, toAPITokenResponse(&t))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateAPIToken godoc
+// @Summary Create a personal API token
+// @Description Tokens are sent as "Bearer <token>" and limited to their scopes: read, checkin, chat, member (joining and leaving clubs, teams and waitlists, invitations, duels and goals), admin (club management, implies all others). The token value is only returned once.
+// @Tags API Tokens
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param token body dto.CreateAPITokenRequest true "Token name, scopes and expiry"
+// @Success 201 {object} dto.CreateAPITokenResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/tokens [post]
+func CreateAPIToken(c *gin.Context) {
+	var req dto.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if fields := req.Validate(models.APITokenScopes); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	days := dto.APITokenDefaultExpiryDays
+	if req.ExpiresInDays != nil {
+		days = *req.ExpiresInDays
+	}
+	expiresAt := time.Now().AddDate(0, 0, days)
+
+	scopes := slices.Clone(req.Scopes)
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	token, plain, err := models.CreateAPIToken(userID, strings.TrimSpace(req.Name), scopes, &expiresAt)
+	if err != nil {
+		if errors.Is(err, models.ErrTooManyAPITokens) {
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	logger.LogInfo("User", userID, "created API token", token.ID)
+
+	c.JSON(http.StatusCreated, dto.CreateAPITokenResponse{
+		APITokenResponse: toAPITokenResponse(token),
+		Token:            plain,
+	})
+}
+
+// RevokeAPIToken godoc
+// @Summary Revoke a personal API token
+// @Tags API Tokens
+// @Security BearerAuth
+// @Produce json
+// @Param tokenId path int true "Token ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/tokens/{tokenId} [delete]
+func RevokeAPIToken(c *gin.Context) {
+	tokenID, err := strconv.ParseUint(c.Param("tokenId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid token id"})
+		return
+	}
+
+	if err := models.DeleteAPIToken(middlewares.GetPrincipal(c).UserID, uint(tokenID)); err != nil {
+		if errors.Is(err, models.ErrAPITokenNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "token revoked"})
+}
+
+func toAPITokenResponse(t *models.APIToken) dto.APITokenResponse {
+	return dto.APITokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.ScopeList(),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
@@ -0,0 +1,271 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetClubChallenges godoc
+// @Summary List a club's challenges
+// @Description Challenges the club sent or received, newest first, with live standings
+// @Tags Challenges
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.ChallengeResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/challenges [get]
+func GetClubChallenges(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	challenges, err := models.GetChallengesForClub(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := make([]dto.ChallengeResponse, 0, len(challenges))
+	for _, challenge := range challenges {
+		r, err := toChallengeResponse(&challenge)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		resp = append(resp, r)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetClubChallenge godoc
+// @Summary Get a challenge with live standings
+// @Tags Challenges
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param challengeId path int true "Challenge ID"
+// @Success 200 {object} dto.ChallengeResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/challenges/{challengeId} [get]
+func GetClubChallenge(c *gin.Context) {
+	clubID, challengeID, ok := parseClubChallengeParams(c)
+	if !ok {
+		return
+	}
+
+	challenge, err := models.GetChallenge(clubID, challengeID)
+	if err != nil {
+		writeChallengeError(c, err)
+		return
+	}
+
+	writeChallenge(c, http.StatusOK, challenge)
+}
+
+// CreateChallenge godoc
+// @Summary Challenge another club
+// @Description Needs permission to edit the club. The opponent club's admins have to accept before it counts; check-ins between starts_at and ends_at are compared. Private clubs can only be challenged by their members or people with a pending invitation to them, and two clubs can have only one pending or running challenge at a time.
+// @Tags Challenges
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param challenge body dto.CreateChallengeRequest true "Challenge"
+// @Success 201 {object} dto.ChallengeResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/challenges [post]
+func CreateChallenge(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	var req dto.CreateChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+	challenge, err := models.CreateChallenge(userID, uint(clubID), req.OpponentClubID, req.Metric, req.StartsAt, req.EndsAt)
+	if err != nil {
+		writeChallengeError(c, err)
+		return
+	}
+	logger.LogInfo("Club", clubID, "challenged club", req.OpponentClubID)
+
+	writeChallenge(c, http.StatusCreated, challenge)
+}
+
+// AcceptChallenge godoc
+// @Summary Accept a challenge
+// @Description Needs permission to edit the challenged club
+// @Tags Challenges
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param challengeId path int true "Challenge ID"
+// @Success 200 {object} dto.ChallengeResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/challenges/{challengeId}/accept [post]
+func AcceptChallenge(c *gin.Context) {
+	respondToChallenge(c, models.AcceptChallenge)
+}
+
+// DeclineChallenge godoc
+// @Summary Decline a challenge
+// @Description Needs permission to edit the challenged club
+// @Tags Challenges
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param challengeId path int true "Challenge ID"
+// @Success 200 {object} dto.ChallengeResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/challenges/{challengeId}/decline [post]
+func DeclineChallenge(c *gin.Context) {
+	respondToChallenge(c, models.DeclineChallenge)
+}
+
+func respondToChallenge(c *gin.Context, respond func(actorID, clubID, challengeID uint) (*models.ClubChallenge, error)) {
+	clubID, challengeID, ok := parseClubChallengeParams(c)
+	if !ok {
+		return
+	}
+
+	challenge, err := respond(middlewares.GetPrincipal(c).UserID, clubID, challengeID)
+	if err != nil {
+		writeChallengeError(c, err)
+		return
+	}
+
+	writeChallenge(c, http.StatusOK, challenge)
+}
+
+// CancelChallenge godoc
+// @Summary Withdraw a challenge
+// @Description Needs permission to edit the challenging club. Only pending challenges can be withdrawn.
+// @Tags Challenges
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param challengeId path int true "Challenge ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/challenges/{challengeId} [delete]
+func CancelChallenge(c *gin.Context) {
+	clubID, challengeID, ok := parseClubChallengeParams(c)
+	if !ok {
+		return
+	}
+
+	if err := models.CancelChallenge(middlewares.GetPrincipal(c).UserID, clubID, challengeID); err != nil {
+		writeChallengeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "challenge withdrawn"})
+}
+
+func parseClubChallengeParams(c *gin.Context) (uint, uint, bool) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return 0, 0, false
+	}
+	challengeID, err := strconv.ParseUint(c.Param("challengeId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid challenge id"})
+		return 0, 0, false
+	}
+	return uint(clubID), uint(challengeID), true
+}
+
+func writeChallengeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotClubMember), errors.Is(err, models.ErrPermissionDenied), errors.Is(err, models.ErrChallengePrivateClub):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrChallengeNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "club not found"})
+	case errors.Is(err, models.ErrClubArchived), errors.Is(err, models.ErrChallengeEnded), errors.Is(err, models.ErrChallengeExists):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrChallengeSelf), errors.Is(err, models.ErrInvalidChallengeMetric):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+}
+
+func writeChallenge(c *gin.Context, status int, challenge *models.ClubChallenge) {
+	resp, err := toChallengeResponse(challenge)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(status, resp)
+}
+
+func toChallengeResponse(challenge *models.ClubChallenge) (dto.ChallengeResponse, error) {
+	standings, err := models.GetChallengeStandings(challenge)
+	if err != nil {
+		return dto.ChallengeResponse{}, err
+	}
+
+	resp := dto.ChallengeResponse{
+		ID:           challenge.ID,
+		Metric:       challenge.Metric,
+		Status:       challenge.Status,
+		Standings:    make([]dto.ChallengeClubStanding, 0, len(standings)),
+		StartsAt:     challenge.StartsAt,
+		EndsAt:       challenge.EndsAt,
+		WinnerClubID: challenge.WinnerClubID,
+		CreatedAt:    challenge.CreatedAt,
+	}
+	for _, s := range standings {
+		resp.Standings = append(resp.Standings, dto.ChallengeClubStanding{
+			ClubID:   s.ClubID,
+			Name:     s.ClubName,
+			CheckIns: s.CheckIns,
+			Members:  s.Members,
+			Score:    s.Score,
+		})
+	}
+	return resp, nil
+}
@@ -1,27 +1,31 @@
 package routes
 
 import (
+	"errors"
 	"klubRanks/config"
 	"klubRanks/dto"
 	"klubRanks/logger"
+	"klubRanks/middlewares"
 	"klubRanks/models"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // CreateClub godoc
 // @Summary Create a new club
-// @Description Create a club and add creator as admin
+// @Description Create a club and add creator as owner
 // @Tags Clubs
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param club body dto.CreateClubRequest true "Create club payload"
 // @Success 201 {object} dto.ClubResponse
-// @Failure 400 {object} dto.ErrorResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs [post]
 func CreateClub(c *gin.Context) {
@@ -33,14 +37,27 @@ func CreateClub(c *gin.Context) {
 		return
 	}
 
-	userID := c.GetUint("userId")
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
 
 	club := models.Club{
 		Name:        req.Name,
 		Description: req.Description,
 		IsPrivate:   req.IsPrivate,
 		Action:      req.Action,
+		Tags:        strings.Join(dto.NormalizeTags(req.Tags), ","),
+		MaxMembers:  req.MaxMembers,
 		CreatedBy:   userID,
+		// The club's action doubles as its default tracked action.
+		Actions: []models.ClubAction{{
+			Name:            req.Action,
+			Points:          config.AppConfig.Server.Counter,
+			CooldownMinutes: config.AppConfig.Server.CoolDownMinutes,
+		}},
 	}
 
 	if err := club.Save(); err != nil {
@@ -62,7 +79,9 @@ func CreateClub(c *gin.Context) {
 		Code:            club.Code,
 		IsPrivate:       club.IsPrivate,
 		Action:          club.Action,
+		Tags:            club.TagList(),
 		NumberOfMembers: 1,
+		MaxMembers:      club.MaxMembers,
 		CreatedBy:       club.CreatedBy,
 		CreatedAt:       club.CreatedAt,
 	})
@@ -77,9 +96,10 @@ func CreateClub(c *gin.Context) {
 // @Param clubId path int true "Club ID"
 // @Param club body dto.UpdateClubRequest true "Update club payload"
 // @Success 200 {object} dto.ClubResponse
-// @Failure 400 {object} dto.ErrorResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
 // @Failure 403 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs/{clubId} [put]
 func UpdateClub(c *gin.Context) {
@@ -94,18 +114,24 @@ func UpdateClub(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
 		return
 	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
 
-	userID := c.GetUint("userId")
+	userID := middlewares.GetPrincipal(c).UserID
 
-	// Verify ownership
 	club, err := models.GetClub(uint(clubID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "club not found"})
 		return
 	}
 
-	if club.CreatedBy != userID {
-		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "only the creator can edit this club"})
+	if !requireClubPermission(c, userID, club.ID, models.PermissionEditClub) {
+		return
+	}
+	if club.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: models.ErrClubArchived.Error()})
 		return
 	}
 
@@ -114,19 +140,36 @@ func UpdateClub(c *gin.Context) {
 	club.Description = req.Description
 	club.IsPrivate = req.IsPrivate
 	club.Action = req.Action
+	if req.Tags != nil {
+		club.Tags = strings.Join(dto.NormalizeTags(req.Tags), ",")
+	}
+	if req.MaxMembers != nil {
+		if *req.MaxMembers == 0 {
+			club.MaxMembers = nil
+		} else {
+			club.MaxMembers = req.MaxMembers
+		}
+	}
 
 	if err := club.Update(); err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	// A higher or removed limit may free seats for the waitlist.
+	if err := models.AdmitFromWaitlist(club.ID); err != nil {
+		logger.LogError("Failed to admit from waitlist:", err)
+	}
+
 	c.JSON(http.StatusOK, dto.ClubResponse{
 		ID:          club.ID,
 		Name:        club.Name,
 		Description: club.Description,
 		Code:        club.Code,
 		Action:      club.Action,
+		Tags:        club.TagList(),
 		IsPrivate:   club.IsPrivate,
+		MaxMembers:  club.MaxMembers,
 		CreatedBy:   club.CreatedBy,
 		CreatedAt:   club.CreatedAt,
 	})
@@ -134,17 +177,20 @@ func UpdateClub(c *gin.Context) {
 
 // GetMyClubs godoc
 // @Summary Get user's clubs
-// @Description Get all clubs the user is a member of
+// @Description Get all clubs the user is a member of. Archived clubs are left out unless requested. Each club lists the user's goals with their progress and, per action, their totals and next allowed check-in.
 // @Tags Clubs
 // @Security BearerAuth
 // @Produce json
+// @Param include_archived query bool false "Include archived clubs"
 // @Success 200 {array} dto.ClubResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs [get]
 func GetMyClubs(c *gin.Context) {
-	userID := c.GetUint("userId")
+	userID := middlewares.GetPrincipal(c).UserID
+
+	includeArchived, _ := strconv.ParseBool(c.Query("include_archived"))
 
-	clubs, err := models.GetClubsForUser(userID)
+	clubs, err := models.GetClubsForUser(userID, includeArchived)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Error: err.Error(),
@@ -152,22 +198,44 @@ func GetMyClubs(c *gin.Context) {
 		return
 	}
 
+	clubIDs := make([]uint, 0, len(clubs))
+	for _, club := range clubs {
+		clubIDs = append(clubIDs, club.ID)
+	}
+	actions, err := models.GetClubActionsForClubs(clubIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	actionScores, err := models.GetActionScoresForUser(userID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	memberCounts, err := models.GetMemberCountsForClubs(clubIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	entries, err := getLeaderboardEntriesByClub(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	ranks, err := models.GetUserRanks(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	resp := make([]dto.ClubResponse, 0, len(clubs))
 	for _, club := range clubs {
-		numberOfMembers, err := models.GetMemberCountForClub(club.ID)
-		rank, err := models.GetUserRankInClub(userID, club.ID)
-		stats, err := models.GetLeaderboardEntryForUser(userID, club.ID)
+		stats := entries[club.ID]
+		goals, err := models.GetGoalsForMember(userID, club.ID, true)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-				Error: err.Error(),
-			})
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
 			return
 		}
-		var nextCheckIn *time.Time
-		if stats.LastCheckedIn != nil {
-			t := stats.LastCheckedIn.Add(time.Duration(config.AppConfig.Server.CoolDownMinutes) * time.Minute)
-			nextCheckIn = &t
-		}
 
 		resp = append(resp, dto.ClubResponse{
 			ID:              club.ID,
@@ -175,13 +243,17 @@ func GetMyClubs(c *gin.Context) {
 			Description:     club.Description,
 			Code:            club.Code,
 			Action:          club.Action,
+			Tags:            club.TagList(),
 			IsPrivate:       club.IsPrivate,
-			NumberOfMembers: int(numberOfMembers),
+			MaxMembers:      club.MaxMembers,
+			NumberOfMembers: int(memberCounts[club.ID]),
 			LastCheckedIn:   stats.LastCheckedIn,
-			NextCheckIn:     nextCheckIn,
-			CurrentRank:     rank,
+			CurrentRank:     ranks[club.ID],
 			CreatedBy:       club.CreatedBy,
 			CreatedAt:       club.CreatedAt,
+			ArchivedAt:      club.ArchivedAt,
+			Goals:           toGoalResponses(goals),
+			Actions:         toActionStats(actions[club.ID], actionScores),
 		})
 	}
 
@@ -190,43 +262,84 @@ func GetMyClubs(c *gin.Context) {
 
 // JoinClub godoc (Renamed from AddMember)
 // @Summary Join a club using invite code
+// @Description Joins public clubs right away. For private clubs a join request is created for the admins to approve (202 with a join request). Full clubs put the user on the waitlist (202 with a dto.WaitlistEntryResponse).
 // @Tags Clubs
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param code path string true "Club Invite Code"
 // @Success 200 {object} dto.MessageResponse
+// @Success 202 {object} dto.JoinRequestResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs/join/{code} [post]
 func JoinClub(c *gin.Context) {
 	clubCode := c.Param("code") // Changed from clubId to code
 
-	userID := c.GetUint("userId")
-	role := "member"
-
-	if err := models.AddMember(userID, clubCode, role); err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	userID := middlewares.GetPrincipal(c).UserID
+	result, err := models.AddMember(userID, clubCode)
+	if err != nil {
+		writeJoinError(c, err)
 		return
 	}
-	logger.LogInfo("User", userID, "joined club with code", clubCode)
 
-	c.JSON(http.StatusOK, dto.MessageResponse{
-		Message: "joined club successfully",
-	})
+	switch {
+	case result != nil && result.Request != nil:
+		logger.LogInfo("User", userID, "requested to join club", result.Request.ClubID)
+		resp, err := toJoinRequestResponse(result.Request)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, resp)
+	case result != nil && result.Waitlist != nil:
+		logger.LogInfo("User", userID, "joined the waitlist of club", result.Waitlist.ClubID)
+		writeWaitlistEntry(c, http.StatusAccepted, result.Waitlist.ClubID, result.Waitlist.UserID)
+	default:
+		logger.LogInfo("User", userID, "joined club with code", clubCode)
+		c.JSON(http.StatusOK, dto.MessageResponse{
+			Message: "joined club successfully",
+		})
+	}
+}
+
+// writeJoinError maps the errors of the join paths.
+func writeJoinError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrBannedFromClub), errors.Is(err, models.ErrClubNotPublic):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrClubArchived), errors.Is(err, models.ErrAlreadyMember),
+		errors.Is(err, models.ErrJoinRequestPending), errors.Is(err, models.ErrAlreadyWaitlisted):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	}
 }
 
 // GetClubMembers godoc
 // @Summary Get club members
+// @Description Only members can list them
 // @Tags Clubs
 // @Security BearerAuth
 // @Produce json
 // @Param clubId path int true "Club ID"
 // @Success 200 {array} dto.MemberResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs/{clubId}/members [get]
 func GetClubMembers(c *gin.Context) {
 	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	if !requireClubMember(c, middlewares.GetPrincipal(c).UserID, uint(clubID)) {
+		return
+	}
 
 	members, err := models.GetClubMembers(uint(clubID))
 	if err != nil {
@@ -242,12 +355,9 @@ func GetClubMembers(c *gin.Context) {
 			return
 		}
 		resp = append(resp, dto.MemberResponse{
-			User: dto.User{
-				ID:       user.ID,
-				Username: user.Username,
-				AvatarID: user.AvatarID,
-			},
+			User:     toUserDTO(user),
 			Role:     m.Role,
+			TeamID:   m.TeamID,
 			JoinedAt: m.JoinedAt,
 		})
 	}
@@ -256,12 +366,15 @@ func GetClubMembers(c *gin.Context) {
 }
 
 // @Summary Leave a club
+// @Description An owner leaving hands the club to the longest-standing admin. Without one, ownership must be transferred first.
 // @Tags Clubs
 // @Security BearerAuth
 // @Produce json
 // @Param clubId path int true "Club ID"
 // @Success 200 {object} dto.MessageResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs/{clubId}/members [delete]
 func LeaveClub(c *gin.Context) {
@@ -271,10 +384,17 @@ func LeaveClub(c *gin.Context) {
 		return
 	}
 
-	userID := c.GetUint("userId")
+	userID := middlewares.GetPrincipal(c).UserID
 
 	if err := models.RemoveMember(userID, uint(clubID)); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		switch {
+		case errors.Is(err, models.ErrNotClubMember):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrOwnerMustTransfer):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		}
 		return
 	}
 
@@ -295,9 +415,9 @@ func LeaveClub(c *gin.Context) {
 func GetCurrentUserStats(c *gin.Context) {
 	clubID, _ := strconv.ParseInt(c.Param("clubId"), 10, 64)
 
-	userID := c.GetUint("userId")
+	userID := middlewares.GetPrincipal(c).UserID
 
-	userStats, err := getClubUserStats(userID, uint(clubID))
+	userStats, err := getClubUserStats(userID, uint(clubID), true)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
 		return
@@ -314,14 +434,29 @@ func GetCurrentUserStats(c *gin.Context) {
 // @Param clubId path int true "Club ID"
 // @Param userId path int true "User ID"
 // @Success 200 {array} dto.UserStats
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs/{clubId}/stats/{userId} [get]
 func GetUserStats(c *gin.Context) {
-	clubID, _ := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
 
-	userID, _ := strconv.ParseUint(c.Param("userId"), 10, 64)
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid user id"})
+		return
+	}
 
-	userStats, err := getClubUserStats(uint(userID), uint(clubID))
+	viewerID := middlewares.GetPrincipal(c).UserID
+	if !requireClubMember(c, viewerID, uint(clubID)) {
+		return
+	}
+
+	userStats, err := getClubUserStats(uint(userID), uint(clubID), uint(userID) == viewerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
 		return
@@ -330,7 +465,9 @@ func GetUserStats(c *gin.Context) {
 	c.JSON(http.StatusOK, userStats)
 }
 
-func getClubUserStats(userID uint, clubID uint) (dto.UserStats, error) {
+// getClubUserStats includes the member's hidden goals when includeHidden is
+// set, i.e. when they look at their own stats.
+func getClubUserStats(userID uint, clubID uint, includeHidden bool) (dto.UserStats, error) {
 
 	var userStats dto.UserStats
 
@@ -370,6 +507,29 @@ func getClubUserStats(userID uint, clubID uint) (dto.UserStats, error) {
 		})
 	}
 
+	actions, err := models.GetClubActions(clubID)
+	if err != nil {
+		return userStats, err
+	}
+	actionScores, err := models.GetActionScoresForUser(userID, clubID)
+	if err != nil {
+		return userStats, err
+	}
+	actionStats := toActionStats(actions, actionScores)
+
+	duels, err := models.GetDuelRecord(userID, clubID)
+	if err != nil {
+		return userStats, err
+	}
+	badges, err := models.GetBadgesForUser(userID, clubID)
+	if err != nil {
+		return userStats, err
+	}
+	goals, err := models.GetGoalsForMember(userID, clubID, includeHidden)
+	if err != nil {
+		return userStats, err
+	}
+
 	userStats = dto.UserStats{
 		UserID:        user.ID,
 		Username:      user.Username,
@@ -380,7 +540,200 @@ func getClubUserStats(userID uint, clubID uint) (dto.UserStats, error) {
 		LastCheckedIn: stats.LastCheckedIn,
 		Rank:          rank,
 		GraphData:     graphData,
+		Actions:       actionStats,
+		Duels:         toDuelRecord(duels),
+		Badges:        toBadgeResponses(badges),
+		Goals:         toGoalResponses(goals),
 	}
 
 	return userStats, nil
 }
+
+// requireClubPermission writes a 403 and returns false unless the user's
+// role in the club grants the permission.
+func requireClubPermission(c *gin.Context, userID, clubID uint, permission models.Permission) bool {
+	err := models.RequireClubPermission(userID, clubID, permission)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, models.ErrNotClubMember), errors.Is(err, models.ErrPermissionDenied):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: models.ErrPermissionDenied.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+	return false
+}
+
+// requireClubMember writes a 403 and returns false unless the user is a
+// member of the club with no active ban.
+func requireClubMember(c *gin.Context, userID, clubID uint) bool {
+	err := models.RequireClubMember(userID, clubID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, models.ErrNotClubMember), errors.Is(err, models.ErrBannedFromClub):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+	return false
+}
+
+// getLeaderboardEntriesByClub loads the user's leaderboard entries in all
+// their clubs, keyed by club ID.
+func getLeaderboardEntriesByClub(userID uint) (map[uint]models.LeaderboardEntry, error) {
+	entries, err := models.GetLeaderboardEntriesForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byClub := make(map[uint]models.LeaderboardEntry, len(entries))
+	for _, entry := range entries {
+		byClub[entry.ClubID] = entry
+	}
+	return byClub, nil
+}
+
+// requireActiveClub writes a 404 or 409 and returns false unless the club
+// exists and is not archived.
+func requireActiveClub(c *gin.Context, clubID uint) bool {
+	club, err := models.GetClub(clubID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "club not found"})
+		return false
+	}
+	if club.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: models.ErrClubArchived.Error()})
+		return false
+	}
+	return true
+}
+
+// ArchiveClub godoc
+// @Summary Archive a club
+// @Description Owner only. Archived clubs stay visible but are read-only.
+// @Tags Clubs
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {object} dto.ClubResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/archive [post]
+func ArchiveClub(c *gin.Context) {
+	setClubArchived(c, true)
+}
+
+// UnarchiveClub godoc
+// @Summary Unarchive a club
+// @Description Owner only
+// @Tags Clubs
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {object} dto.ClubResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/unarchive [post]
+func UnarchiveClub(c *gin.Context) {
+	setClubArchived(c, false)
+}
+
+func setClubArchived(c *gin.Context, archived bool) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	club, err := models.SetClubArchived(userID, uint(clubID), archived)
+	if err != nil {
+		writeClubAdminError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "set archived of club", clubID, "to", archived)
+
+	c.JSON(http.StatusOK, dto.ClubResponse{
+		ID:          club.ID,
+		Name:        club.Name,
+		Description: club.Description,
+		Code:        club.Code,
+		Action:      club.Action,
+		Tags:        club.TagList(),
+		IsPrivate:   club.IsPrivate,
+		MaxMembers:  club.MaxMembers,
+		CreatedBy:   club.CreatedBy,
+		CreatedAt:   club.CreatedAt,
+		ArchivedAt:  club.ArchivedAt,
+	})
+}
+
+// DeleteClub godoc
+// @Summary Delete a club
+// @Description Owner only. Permanently removes the club with its members, leaderboard, messages and activity. The club name must be repeated to confirm.
+// @Tags Clubs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param confirm body dto.DeleteClubRequest true "Confirmation"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId} [delete]
+func DeleteClub(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	var req dto.DeleteClubRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	club, err := models.GetClub(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "club not found"})
+		return
+	}
+	if req.Confirm != club.Name {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "confirmation does not match the club name"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if err := models.DeleteClub(userID, club.ID); err != nil {
+		writeClubAdminError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "deleted club", club.ID)
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "club deleted"})
+}
+
+func writeClubAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotClubMember), errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "club not found"})
+	case errors.Is(err, models.ErrPermissionDenied):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrClubArchived), errors.Is(err, models.ErrClubNotArchived):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+}
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	discoverDefaultLimit = 20
+	discoverMaxLimit     = 100
+)
+
+// DiscoverClubs godoc
+// @Summary Discover public clubs
+// @Description Search public, unarchived clubs by name, description and action
+// @Tags Discovery
+// @Security BearerAuth
+// @Produce json
+// @Param q query string false "Search terms, all must match"
+// @Param tag query string false "Only clubs with this tag"
+// @Param sort query string false "Sort order" Enums(members, activity, newest) default(members)
+// @Param limit query int false "Limit" default(20)
+// @Param offset query int false "Offset" default(0)
+// @Success 200 {array} dto.DiscoverClubResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/discover [get]
+func DiscoverClubs(c *gin.Context) {
+	query := models.DiscoverQuery{
+		Search: strings.TrimSpace(c.Query("q")),
+		Tag:    strings.TrimSpace(c.Query("tag")),
+		Sort:   c.DefaultQuery("sort", models.DiscoverSortMembers),
+		Limit:  discoverDefaultLimit,
+	}
+
+	if !slices.Contains(models.DiscoverSorts, query.Sort) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "sort must be one of " + strings.Join(models.DiscoverSorts, ", ")})
+		return
+	}
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			query.Limit = min(parsed, discoverMaxLimit)
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed > 0 {
+			query.Offset = parsed
+		}
+	}
+
+	clubs, err := models.DiscoverClubs(middlewares.GetPrincipal(c).UserID, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := make([]dto.DiscoverClubResponse, 0, len(clubs))
+	for _, club := range clubs {
+		resp = append(resp, dto.DiscoverClubResponse{
+			ID:              club.ID,
+			Name:            club.Name,
+			Description:     club.Description,
+			Action:          club.Action,
+			Tags:            club.TagList(),
+			NumberOfMembers: int(club.MemberCount),
+			RecentActivity:  int(club.RecentActivity),
+			IsMember:        club.IsMember,
+			CreatedAt:       club.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// JoinPublicClub godoc
+// @Summary Join a public club
+// @Description Joins a public club by ID without an invite code. Full clubs put the user on the waitlist.
+// @Tags Discovery
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {object} dto.MessageResponse
+// @Success 202 {object} dto.WaitlistEntryResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/join [post]
+func JoinPublicClub(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	entry, err := models.JoinPublicClub(userID, uint(clubID))
+	if err != nil {
+		writeJoinError(c, err)
+		return
+	}
+	if entry != nil {
+		logger.LogInfo("User", userID, "joined the waitlist of club", clubID)
+		writeWaitlistEntry(c, http.StatusAccepted, entry.ClubID, entry.UserID)
+		return
+	}
+	logger.LogInfo("User", userID, "joined public club", clubID)
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "joined club successfully"})
+}
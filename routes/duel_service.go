@@ -0,0 +1,361 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultDuelDays  = 7
+	duelDefaultLimit = 20
+	duelMaxLimit     = 100
+	// duelStatusOpen lists pending and running duels, duelStatusAll every
+	// duel.
+	duelStatusOpen = "open"
+	duelStatusAll  = "all"
+)
+
+// GetMyDuels godoc
+// @Summary List the current user's duels
+// @Description Duels in all clubs the user challenged or was challenged to, newest first, with live check-in counts. Only pending and running duels unless status says otherwise.
+// @Tags Duels
+// @Security BearerAuth
+// @Produce json
+// @Param status query string false "Which duels to list" Enums(open, all, pending, accepted, declined, cancelled, finished) default(open)
+// @Param limit query int false "Limit" default(20)
+// @Success 200 {array} dto.DuelResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/duels [get]
+func GetMyDuels(c *gin.Context) {
+	statuses, limit, ok := parseDuelFilter(c)
+	if !ok {
+		return
+	}
+
+	duels, err := models.GetDuelsForUser(middlewares.GetPrincipal(c).UserID, statuses, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writeDuels(c, duels)
+}
+
+// GetClubDuels godoc
+// @Summary List a club's duels
+// @Description Newest first, with live check-in counts. Only pending and running duels unless status says otherwise.
+// @Tags Duels
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param status query string false "Which duels to list" Enums(open, all, pending, accepted, declined, cancelled, finished) default(open)
+// @Param limit query int false "Limit" default(20)
+// @Success 200 {array} dto.DuelResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/duels [get]
+func GetClubDuels(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	statuses, limit, ok := parseDuelFilter(c)
+	if !ok {
+		return
+	}
+
+	duels, err := models.GetDuelsForClub(uint(clubID), statuses, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writeDuels(c, duels)
+}
+
+// CreateDuel godoc
+// @Summary Challenge a member to a duel
+// @Description The opponent has to accept. From then on, whoever checks in more often in this club before the duel ends wins.
+// @Tags Duels
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param duel body dto.CreateDuelRequest true "Duel"
+// @Success 201 {object} dto.DuelResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/duels [post]
+func CreateDuel(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	var req dto.CreateDuelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+	if !requireActiveClub(c, uint(clubID)) {
+		return
+	}
+
+	days := defaultDuelDays
+	if req.Days != nil {
+		days = *req.Days
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+	duel, err := models.CreateDuel(userID, req.OpponentID, uint(clubID), days)
+	if err != nil {
+		writeDuelError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "challenged user", req.OpponentID, "to a duel in club", clubID)
+
+	writeDuel(c, http.StatusCreated, duel)
+}
+
+// AcceptDuel godoc
+// @Summary Accept a duel
+// @Description Only the challenged member can accept. The duel starts now and runs for its number of days.
+// @Tags Duels
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param duelId path int true "Duel ID"
+// @Success 200 {object} dto.DuelResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/duels/{duelId}/accept [post]
+func AcceptDuel(c *gin.Context) {
+	clubID, duelID, ok := parseClubDuelParams(c)
+	if !ok || !requireActiveClub(c, clubID) {
+		return
+	}
+
+	duel, err := models.AcceptDuel(middlewares.GetPrincipal(c).UserID, clubID, duelID)
+	if err != nil {
+		writeDuelError(c, err)
+		return
+	}
+
+	writeDuel(c, http.StatusOK, duel)
+}
+
+// DeclineDuel godoc
+// @Summary Decline a duel
+// @Description Only the challenged member can decline
+// @Tags Duels
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param duelId path int true "Duel ID"
+// @Success 200 {object} dto.DuelResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/duels/{duelId}/decline [post]
+func DeclineDuel(c *gin.Context) {
+	clubID, duelID, ok := parseClubDuelParams(c)
+	if !ok {
+		return
+	}
+
+	duel, err := models.DeclineDuel(middlewares.GetPrincipal(c).UserID, clubID, duelID)
+	if err != nil {
+		writeDuelError(c, err)
+		return
+	}
+
+	writeDuel(c, http.StatusOK, duel)
+}
+
+// CancelDuel godoc
+// @Summary Withdraw a duel
+// @Description Only the challenger can withdraw, and only while the duel is pending
+// @Tags Duels
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param duelId path int true "Duel ID"
+// @Success 200 {object} dto.DuelResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/duels/{duelId} [delete]
+func CancelDuel(c *gin.Context) {
+	clubID, duelID, ok := parseClubDuelParams(c)
+	if !ok {
+		return
+	}
+
+	duel, err := models.CancelDuel(middlewares.GetPrincipal(c).UserID, clubID, duelID)
+	if err != nil {
+		writeDuelError(c, err)
+		return
+	}
+
+	writeDuel(c, http.StatusOK, duel)
+}
+
+func parseClubDuelParams(c *gin.Context) (uint, uint, bool) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return 0, 0, false
+	}
+	duelID, err := strconv.ParseUint(c.Param("duelId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid duel id"})
+		return 0, 0, false
+	}
+	return uint(clubID), uint(duelID), true
+}
+
+// parseDuelFilter reads the status and limit query parameters of the duel
+// lists. No statuses means any status.
+func parseDuelFilter(c *gin.Context) ([]string, int, bool) {
+	var statuses []string
+	switch status := c.DefaultQuery("status", duelStatusOpen); {
+	case status == duelStatusOpen:
+		statuses = models.DuelOpenStatuses
+	case status == duelStatusAll:
+	case slices.Contains(models.DuelStatuses, status):
+		statuses = []string{status}
+	default:
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: "status must be one of open, all, " + strings.Join(models.DuelStatuses, ", "),
+		})
+		return nil, 0, false
+	}
+
+	limit := duelDefaultLimit
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = min(parsed, duelMaxLimit)
+		}
+	}
+	return statuses, limit, true
+}
+
+func writeDuelError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotClubMember):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrDuelNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrDuelExists), errors.Is(err, models.ErrClubArchived):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrDuelSelf):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+}
+
+func writeDuels(c *gin.Context, duels []models.Duel) {
+	resp, err := toDuelResponses(duels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func writeDuel(c *gin.Context, status int, duel *models.Duel) {
+	resp, err := toDuelResponses([]models.Duel{*duel})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(status, resp[0])
+}
+
+// toDuelResponses loads the clubs, members and progress of all the duels
+// at once.
+func toDuelResponses(duels []models.Duel) ([]dto.DuelResponse, error) {
+	resp := make([]dto.DuelResponse, 0, len(duels))
+	if len(duels) == 0 {
+		return resp, nil
+	}
+
+	var clubIDs, userIDs []uint
+	for _, d := range duels {
+		clubIDs = append(clubIDs, d.ClubID)
+		userIDs = append(userIDs, d.ChallengerID, d.OpponentID)
+	}
+	clubs, err := models.GetClubsByIDs(clubIDs)
+	if err != nil {
+		return nil, err
+	}
+	users, err := models.GetUsersByIDs(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	progresses, err := models.GetDuelProgresses(duels)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, duel := range duels {
+		club, challenger, opponent := clubs[duel.ClubID], users[duel.ChallengerID], users[duel.OpponentID]
+		if club == nil || challenger == nil || opponent == nil {
+			return nil, fmt.Errorf("duel %d refers to a missing club or user", duel.ID)
+		}
+		progress := progresses[duel.ID]
+
+		resp = append(resp, dto.DuelResponse{
+			ID:       duel.ID,
+			ClubID:   club.ID,
+			ClubName: club.Name,
+			Status:   duel.Status,
+			Days:     duel.Days,
+			Challenger: dto.DuelParticipant{
+				User:     toUserDTO(challenger),
+				CheckIns: progress.ChallengerCheckIns,
+			},
+			Opponent: dto.DuelParticipant{
+				User:     toUserDTO(opponent),
+				CheckIns: progress.OpponentCheckIns,
+			},
+			StartsAt:  duel.StartsAt,
+			EndsAt:    duel.EndsAt,
+			WinnerID:  duel.WinnerID,
+			CreatedAt: duel.CreatedAt,
+		})
+	}
+	return resp, nil
+}
+
+func toDuelRecord(record models.DuelRecord) dto.DuelRecord {
+	return dto.DuelRecord{
+		Wins:   record.Wins,
+		Losses: record.Losses,
+		Draws:  record.Draws,
+	}
+}
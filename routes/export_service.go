@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/jobs"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestDataExport godoc
+// @Summary Request a personal data export
+// @Description Queues a ZIP archive with the user's profile, memberships, leaderboard entries, activity logs and messages as JSON and CSV
+// @Tags Users
+// @Security BearerAuth
+// @Produce json
+// @Success 202 {object} dto.DataExportResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/export [post]
+func RequestDataExport(c *gin.Context) {
+	userID := middlewares.GetPrincipal(c).UserID
+
+	export, err := models.CreateDataExport(userID)
+	if errors.Is(err, models.ErrDataExportInProgress) {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	jobs.NotifyExportWorker()
+	logger.LogInfo("Queued data export", export.ID, "for user", userID)
+
+	c.JSON(http.StatusAccepted, toDataExportResponse(export))
+}
+
+// GetDataExport godoc
+// @Summary Get data export status
+// @Description Returns the export status and, once ready, a time-limited download link
+// @Tags Users
+// @Security BearerAuth
+// @Produce json
+// @Param exportId path int true "Export ID"
+// @Success 200 {object} dto.DataExportResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /users/me/export/{exportId} [get]
+func GetDataExport(c *gin.Context) {
+	exportID, err := strconv.ParseUint(c.Param("exportId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid export id"})
+		return
+	}
+
+	export, err := models.GetDataExport(uint(exportID))
+	if err != nil || export.UserID != middlewares.GetPrincipal(c).UserID {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "export not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toDataExportResponse(export))
+}
+
+// DownloadDataExport godoc
+// @Summary Download a data export
+// @Description The link itself grants access and stops working once it expires
+// @Tags Users
+// @Produce application/zip
+// @Param token path string true "Download token"
+// @Success 200 {file} file
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 410 {object} dto.ErrorResponse
+// @Router /exports/{token} [get]
+func DownloadDataExport(c *gin.Context) {
+	export, err := models.GetDataExportByToken(c.Param("token"))
+	if err != nil || export.Status != models.ExportStatusReady {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "export not found"})
+		return
+	}
+
+	if export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		c.JSON(http.StatusGone, dto.ErrorResponse{Error: "download link has expired"})
+		return
+	}
+
+	c.FileAttachment(export.FilePath, "klubranks-export.zip")
+}
+
+func toDataExportResponse(export *models.DataExport) dto.DataExportResponse {
+	resp := dto.DataExportResponse{
+		ID:          export.ID,
+		Status:      export.Status,
+		CreatedAt:   export.CreatedAt,
+		CompletedAt: export.CompletedAt,
+		ExpiresAt:   export.ExpiresAt,
+		Error:       export.Error,
+	}
+	if export.Status == models.ExportStatusReady {
+		resp.DownloadURL = "/exports/" + export.Token
+	}
+	return resp
+}
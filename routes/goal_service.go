@@ -0,0 +1,244 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetClubGoals godoc
+// @Summary List the goals members share with the club
+// @Description Visible goals of all members with their progress in the current period. Only members can list them.
+// @Tags Goals
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.GoalResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/goals [get]
+func GetClubGoals(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	if !requireClubMember(c, middlewares.GetPrincipal(c).UserID, uint(clubID)) {
+		return
+	}
+
+	goals, err := models.GetVisibleGoalsForClub(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toGoalResponses(goals))
+}
+
+// GetMyGoals godoc
+// @Summary List the current user's goals in a club
+// @Description Hidden goals included, with their progress in the current period
+// @Tags Goals
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.GoalResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/goals/me [get]
+func GetMyGoals(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	goals, err := models.GetGoalsForMember(middlewares.GetPrincipal(c).UserID, uint(clubID), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toGoalResponses(goals))
+}
+
+// CreateGoal godoc
+// @Summary Set a personal goal
+// @Description A target number of check-ins in the club per day, week or month. Periods follow UTC and weeks start on Monday.
+// @Tags Goals
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param goal body dto.GoalRequest true "Goal"
+// @Success 201 {object} dto.GoalResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/goals [post]
+func CreateGoal(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	var req dto.GoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+	if !requireActiveClub(c, uint(clubID)) {
+		return
+	}
+
+	goal, err := models.CreateGoal(middlewares.GetPrincipal(c).UserID, uint(clubID), req.Period, req.Target, req.Visible)
+	if err != nil {
+		writeGoalError(c, err)
+		return
+	}
+
+	writeGoal(c, http.StatusCreated, goal)
+}
+
+// UpdateGoal godoc
+// @Summary Change a personal goal
+// @Description Changing the period or target lets the goal be completed again in the current period
+// @Tags Goals
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param goalId path int true "Goal ID"
+// @Param goal body dto.GoalRequest true "Goal"
+// @Success 200 {object} dto.GoalResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/goals/{goalId} [put]
+func UpdateGoal(c *gin.Context) {
+	clubID, goalID, ok := parseClubGoalParams(c)
+	if !ok {
+		return
+	}
+
+	var req dto.GoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	goal, err := models.UpdateGoal(middlewares.GetPrincipal(c).UserID, clubID, goalID, req.Period, req.Target, req.Visible)
+	if err != nil {
+		writeGoalError(c, err)
+		return
+	}
+
+	writeGoal(c, http.StatusOK, goal)
+}
+
+// DeleteGoal godoc
+// @Summary Remove a personal goal
+// @Tags Goals
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param goalId path int true "Goal ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/goals/{goalId} [delete]
+func DeleteGoal(c *gin.Context) {
+	clubID, goalID, ok := parseClubGoalParams(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteGoal(middlewares.GetPrincipal(c).UserID, clubID, goalID); err != nil {
+		writeGoalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "goal deleted"})
+}
+
+func parseClubGoalParams(c *gin.Context) (uint, uint, bool) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return 0, 0, false
+	}
+	goalID, err := strconv.ParseUint(c.Param("goalId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid goal id"})
+		return 0, 0, false
+	}
+	return uint(clubID), uint(goalID), true
+}
+
+func writeGoalError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotClubMember):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrGoalNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrTooManyGoals):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrInvalidGoalPeriod):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+}
+
+func writeGoal(c *gin.Context, status int, goal *models.Goal) {
+	progress, err := models.GetGoalProgress(goal)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(status, toGoalResponse(progress))
+}
+
+func toGoalResponse(p models.GoalProgress) dto.GoalResponse {
+	return dto.GoalResponse{
+		ID:          p.Goal.ID,
+		UserID:      p.Goal.UserID,
+		ClubID:      p.Goal.ClubID,
+		Period:      p.Goal.Period,
+		Target:      p.Goal.Target,
+		Visible:     p.Goal.Visible,
+		CheckIns:    p.CheckIns,
+		Completed:   p.Completed(),
+		PeriodStart: p.PeriodStart,
+		PeriodEnd:   p.PeriodEnd,
+		CreatedAt:   p.Goal.CreatedAt,
+	}
+}
+
+func toGoalResponses(goals []models.GoalProgress) []dto.GoalResponse {
+	resp := make([]dto.GoalResponse, 0, len(goals))
+	for _, g := range goals {
+		resp = append(resp, toGoalResponse(g))
+	}
+	return resp
+}
@@ -0,0 +1,272 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// InviteUser godoc
+// @Summary Invite a user into a club
+// @Description Any member can invite into a public club; private clubs need an admin
+// @Tags Invitations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param invitation body dto.InviteUserRequest true "Invitee"
+// @Success 201 {object} dto.InvitationResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/invitations [post]
+func InviteUser(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	var req dto.InviteUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	invitee, err := models.GetUserByUsername(strings.TrimSpace(req.Username))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "user not found"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	invitation, err := models.CreateClubInvitation(userID, uint(clubID), invitee.ID)
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "invited user", invitee.ID, "to club", clubID)
+
+	writeInvitation(c, http.StatusCreated, invitation)
+}
+
+// GetClubInvitations godoc
+// @Summary List invitations sent for a club
+// @Description Admins see every invitation, other members only their own
+// @Tags Invitations
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.InvitationResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/invitations [get]
+func GetClubInvitations(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	member, err := models.GetMember(userID, uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: models.ErrNotClubMember.Error()})
+		return
+	}
+	inviterID := userID
+	if models.RoleHasPermission(member.Role, models.PermissionManageMembers) {
+		inviterID = 0
+	}
+
+	invitations, err := models.GetInvitationsForClub(uint(clubID), inviterID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writeInvitations(c, invitations)
+}
+
+// CancelInvitation godoc
+// @Summary Cancel a pending invitation
+// @Tags Invitations
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param invitationId path int true "Invitation ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/invitations/{invitationId} [delete]
+func CancelInvitation(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+	invitationID, err := strconv.ParseUint(c.Param("invitationId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid invitation id"})
+		return
+	}
+
+	if err := models.CancelInvitation(middlewares.GetPrincipal(c).UserID, uint(clubID), uint(invitationID)); err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "invitation cancelled"})
+}
+
+// GetMyInvitations godoc
+// @Summary List my pending club invitations
+// @Tags Invitations
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} dto.InvitationResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/invitations [get]
+func GetMyInvitations(c *gin.Context) {
+	invitations, err := models.GetPendingInvitationsForUser(middlewares.GetPrincipal(c).UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writeInvitations(c, invitations)
+}
+
+// AcceptInvitation godoc
+// @Summary Accept a club invitation
+// @Tags Invitations
+// @Security BearerAuth
+// @Produce json
+// @Param invitationId path int true "Invitation ID"
+// @Success 200 {object} dto.InvitationResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/invitations/{invitationId}/accept [post]
+func AcceptInvitation(c *gin.Context) {
+	respondToInvitation(c, models.AcceptInvitation)
+}
+
+// DeclineInvitation godoc
+// @Summary Decline a club invitation
+// @Tags Invitations
+// @Security BearerAuth
+// @Produce json
+// @Param invitationId path int true "Invitation ID"
+// @Success 200 {object} dto.InvitationResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/invitations/{invitationId}/decline [post]
+func DeclineInvitation(c *gin.Context) {
+	respondToInvitation(c, models.DeclineInvitation)
+}
+
+func respondToInvitation(c *gin.Context, respond func(userID, invitationID uint) (*models.ClubInvitation, error)) {
+	invitationID, err := strconv.ParseUint(c.Param("invitationId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid invitation id"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	invitation, err := respond(userID, uint(invitationID))
+	if err != nil {
+		writeInvitationError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "marked invitation", invitationID, "as", invitation.Status)
+
+	writeInvitation(c, http.StatusOK, invitation)
+}
+
+func writeInvitationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrCannotInviteSelf):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrInvitationNotFound), errors.Is(err, models.ErrNotClubMember):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "club not found"})
+	case errors.Is(err, models.ErrPermissionDenied), errors.Is(err, models.ErrPrivateClubInviters),
+		errors.Is(err, models.ErrInviteeBanned), errors.Is(err, models.ErrBannedFromClub):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrAlreadyMember), errors.Is(err, models.ErrInvitationPending), errors.Is(err, models.ErrClubArchived),
+		errors.Is(err, models.ErrClubFull):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+}
+
+func writeInvitation(c *gin.Context, status int, invitation *models.ClubInvitation) {
+	resp, err := toInvitationResponse(invitation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(status, resp)
+}
+
+func writeInvitations(c *gin.Context, invitations []models.ClubInvitation) {
+	resp := make([]dto.InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		r, err := toInvitationResponse(&invitation)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		resp = append(resp, r)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func toInvitationResponse(invitation *models.ClubInvitation) (dto.InvitationResponse, error) {
+	club, err := models.GetClub(invitation.ClubID)
+	if err != nil {
+		return dto.InvitationResponse{}, err
+	}
+	inviter, err := models.GetUserByID(invitation.InviterID)
+	if err != nil {
+		return dto.InvitationResponse{}, err
+	}
+	invitee, err := models.GetUserByID(invitation.InviteeID)
+	if err != nil {
+		return dto.InvitationResponse{}, err
+	}
+
+	return dto.InvitationResponse{
+		ID:          invitation.ID,
+		ClubID:      club.ID,
+		ClubName:    club.Name,
+		Inviter:     toUserDTO(inviter),
+		Invitee:     toUserDTO(invitee),
+		Status:      invitation.Status,
+		RespondedAt: invitation.RespondedAt,
+		CreatedAt:   invitation.CreatedAt,
+	}, nil
+}
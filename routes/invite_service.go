@@ -0,0 +1,244 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetClubInvites godoc
+// @Summary List club invites
+// @Description Lists all invites of a club with their usage, including revoked and expired ones
+// @Tags Invites
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.ClubInviteResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/invites [get]
+func GetClubInvites(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+	if !requireClubPermission(c, userID, uint(clubID), models.PermissionManageMembers) {
+		return
+	}
+
+	club, err := models.GetClub(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "club not found"})
+		return
+	}
+
+	invites, err := models.GetClubInvites(club.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	now := time.Now()
+	resp := make([]dto.ClubInviteResponse, 0, len(invites))
+	for _, invite := range invites {
+		resp = append(resp, toClubInviteResponse(&invite, club, now))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateClubInvite godoc
+// @Summary Create a club invite
+// @Description Creates an extra invite code with an optional expiry, usage limit and role on join
+// @Tags Invites
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param invite body dto.CreateClubInviteRequest false "Invite settings"
+// @Success 201 {object} dto.ClubInviteResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/invites [post]
+func CreateClubInvite(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	var req dto.CreateClubInviteRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	if !requireActiveClub(c, uint(clubID)) {
+		return
+	}
+	club, err := models.GetClub(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "club not found"})
+		return
+	}
+
+	role := models.RoleMember
+	if req.Role != nil {
+		role = *req.Role
+	}
+	var expiresAt *time.Time
+	if req.ExpiresInHours != nil {
+		t := time.Now().Add(time.Duration(*req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	invite, err := models.CreateClubInvite(userID, club.ID, role, req.MaxUses, expiresAt)
+	if err != nil {
+		writeInviteError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "created invite", invite.ID, "for club", club.ID)
+
+	c.JSON(http.StatusCreated, toClubInviteResponse(invite, club, time.Now()))
+}
+
+// RevokeClubInvite godoc
+// @Summary Revoke a club invite
+// @Tags Invites
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param inviteId path int true "Invite ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/invites/{inviteId} [delete]
+func RevokeClubInvite(c *gin.Context) {
+	clubID, inviteID, ok := parseClubInviteParams(c)
+	if !ok {
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if err := models.RevokeClubInvite(userID, clubID, inviteID); err != nil {
+		writeInviteError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "revoked invite", inviteID, "of club", clubID)
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "invite revoked"})
+}
+
+// RegenerateClubInvite godoc
+// @Summary Regenerate a club invite
+// @Description Revokes the invite and issues a new code with the same settings. Regenerating the default invite changes the club code.
+// @Tags Invites
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param inviteId path int true "Invite ID"
+// @Success 201 {object} dto.ClubInviteResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/invites/{inviteId}/regenerate [post]
+func RegenerateClubInvite(c *gin.Context) {
+	clubID, inviteID, ok := parseClubInviteParams(c)
+	if !ok {
+		return
+	}
+	if !requireActiveClub(c, clubID) {
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	invite, err := models.RegenerateClubInvite(userID, clubID, inviteID)
+	if err != nil {
+		writeInviteError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "regenerated invite", inviteID, "of club", clubID, "as", invite.ID)
+
+	club, err := models.GetClub(clubID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toClubInviteResponse(invite, club, time.Now()))
+}
+
+func parseClubInviteParams(c *gin.Context) (clubID, inviteID uint, ok bool) {
+	club, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return 0, 0, false
+	}
+	invite, err := strconv.ParseUint(c.Param("inviteId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid invite id"})
+		return 0, 0, false
+	}
+	return uint(club), uint(invite), true
+}
+
+func writeInviteError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrNotClubMember), errors.Is(err, models.ErrInviteNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrPermissionDenied), errors.Is(err, models.ErrInviteRole):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrInviteRevoked):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+}
+
+func toClubInviteResponse(invite *models.ClubInvite, club *models.Club, now time.Time) dto.ClubInviteResponse {
+	return dto.ClubInviteResponse{
+		ID:        invite.ID,
+		Code:      invite.Code,
+		Role:      invite.Role,
+		Uses:      invite.Uses,
+		MaxUses:   invite.MaxUses,
+		ExpiresAt: invite.ExpiresAt,
+		RevokedAt: invite.RevokedAt,
+		Default:   invite.Code == club.Code,
+		Active:    invite.IsUsable(now),
+		CreatedBy: invite.CreatedBy,
+		CreatedAt: invite.CreatedAt,
+	}
+}
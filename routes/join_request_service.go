@@ -0,0 +1,204 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetClubJoinRequests godoc
+// @Summary List pending join requests of a club
+// @Tags Join Requests
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.JoinRequestResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/join-requests [get]
+func GetClubJoinRequests(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+	if !requireClubPermission(c, userID, uint(clubID), models.PermissionManageMembers) {
+		return
+	}
+
+	requests, err := models.GetPendingJoinRequestsForClub(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writeJoinRequests(c, requests)
+}
+
+// ApproveJoinRequest godoc
+// @Summary Approve a join request
+// @Tags Join Requests
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param requestId path int true "Join request ID"
+// @Success 200 {object} dto.JoinRequestResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/join-requests/{requestId}/approve [post]
+func ApproveJoinRequest(c *gin.Context) {
+	decideJoinRequest(c, models.ApproveJoinRequest)
+}
+
+// RejectJoinRequest godoc
+// @Summary Reject a join request
+// @Tags Join Requests
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param requestId path int true "Join request ID"
+// @Success 200 {object} dto.JoinRequestResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/join-requests/{requestId}/reject [post]
+func RejectJoinRequest(c *gin.Context) {
+	decideJoinRequest(c, models.RejectJoinRequest)
+}
+
+// GetMyJoinRequests godoc
+// @Summary List my pending join requests
+// @Tags Join Requests
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} dto.JoinRequestResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/join-requests [get]
+func GetMyJoinRequests(c *gin.Context) {
+	requests, err := models.GetPendingJoinRequestsForUser(middlewares.GetPrincipal(c).UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writeJoinRequests(c, requests)
+}
+
+// CancelJoinRequest godoc
+// @Summary Cancel my pending join request
+// @Tags Join Requests
+// @Security BearerAuth
+// @Produce json
+// @Param requestId path int true "Join request ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/join-requests/{requestId} [delete]
+func CancelJoinRequest(c *gin.Context) {
+	requestID, err := strconv.ParseUint(c.Param("requestId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request id"})
+		return
+	}
+
+	if err := models.CancelJoinRequest(middlewares.GetPrincipal(c).UserID, uint(requestID)); err != nil {
+		if errors.Is(err, models.ErrJoinRequestNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "join request cancelled"})
+}
+
+func decideJoinRequest(c *gin.Context, decide func(actorID, clubID, requestID uint) (*models.ClubJoinRequest, error)) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+	requestID, err := strconv.ParseUint(c.Param("requestId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request id"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	request, err := decide(userID, uint(clubID), uint(requestID))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrJoinRequestNotFound), errors.Is(err, models.ErrNotClubMember):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrPermissionDenied):
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrBannedFromClub), errors.Is(err, models.ErrClubArchived), errors.Is(err, models.ErrAlreadyMember),
+			errors.Is(err, models.ErrClubFull):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+	logger.LogInfo("User", userID, "marked join request", requestID, "as", request.Status)
+
+	resp, err := toJoinRequestResponse(request)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func writeJoinRequests(c *gin.Context, requests []models.ClubJoinRequest) {
+	resp := make([]dto.JoinRequestResponse, 0, len(requests))
+	for _, request := range requests {
+		r, err := toJoinRequestResponse(&request)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		resp = append(resp, r)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func toJoinRequestResponse(request *models.ClubJoinRequest) (dto.JoinRequestResponse, error) {
+	club, err := models.GetClub(request.ClubID)
+	if err != nil {
+		return dto.JoinRequestResponse{}, err
+	}
+	user, err := models.GetUserByID(request.UserID)
+	if err != nil {
+		return dto.JoinRequestResponse{}, err
+	}
+
+	return dto.JoinRequestResponse{
+		ID:        request.ID,
+		ClubID:    club.ID,
+		ClubName:  club.Name,
+		User:      toUserDTO(user),
+		Status:    request.Status,
+		Role:      request.Role,
+		DecidedAt: request.DecidedAt,
+		CreatedAt: request.CreatedAt,
+	}, nil
+}
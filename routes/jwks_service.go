@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"klubRanks/dto"
+	"klubRanks/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS godoc
+// @Summary Public keys for verifying KlubRanks tokens
+// @Description JSON Web Key Set with every key that signs or may still verify tokens, including the next key before it activates
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} dto.JWKSResponse
+// @Router /.well-known/jwks.json [get]
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, dto.JWKSResponse{Keys: utils.PublicJWKS()})
+}
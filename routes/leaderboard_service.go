@@ -1,26 +1,39 @@
 package routes
 
 import (
+	"errors"
 	"klubRanks/config"
 	"klubRanks/dto"
 	"klubRanks/logger"
+	"klubRanks/middlewares"
 	"klubRanks/models"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	leaderboardDefaultLimit = 50
+	leaderboardMaxLimit     = 100
+)
+
 // UpdateLeaderboardScore godoc
-// @Summary Update leaderboard score
-// @Description Increment user's score
+// @Summary Check in an action
+// @Description Logs an amount of one of the club's actions. The body is optional: without it one unit of the club's default action is logged. Points are the amount times the action's weight. Badges the check-in earned are returned and announced in the club chat. Goals it completed are returned too and announced when they are visible to the club.
 // @Tags Leaderboard
 // @Security BearerAuth
+// @Accept json
 // @Produce json
 // @Param clubId path int true "Club ID"
-// @Success 200 {object} dto.MessageResponse
-// @Failure 400 {object} dto.ErrorResponse
+// @Param checkin body dto.CheckInRequest false "Action and amount"
+// @Success 200 {object} dto.CheckInResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs/{clubId}/leaderboard/score [post]
 func UpdateLeaderboardScore(c *gin.Context) {
@@ -30,33 +43,78 @@ func UpdateLeaderboardScore(c *gin.Context) {
 		return
 	}
 
-	userID := c.GetUint("userId")
+	var req dto.CheckInRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	if !requireActiveClub(c, uint(clubID)) {
+		return
+	}
+
+	amount := 1
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
 	logger.LogInfo("Updating leaderboard score for user: ", userID, " in club: ", clubID)
 
-	err = models.UpdateLeaderboardScore(userID, uint(clubID), config.AppConfig.Server.Counter)
+	result, err := models.CheckIn(userID, uint(clubID), req.ActionID, amount, xpRules())
 	if err != nil {
-		if err.Error() == "leaderboard entry not found" {
+		switch {
+		case errors.Is(err, models.ErrNotClubMember):
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrClubActionNotFound):
 			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
-			return
+		case errors.Is(err, models.ErrActionCooldown):
+			c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
 		}
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.MessageResponse{
-		Message: "score updated",
-	})
+	// The check-in already counts; a failure here only delays the badges
+	// until the next one.
+	badges, err := models.AwardBadges(userID, uint(clubID), configuredBadges())
+	if err != nil {
+		logger.LogError("Failed to award badges to user", userID, "in club", clubID, ":", err)
+	}
+
+	resp := dto.CheckInResponse{
+		Action:         toClubActionResponse(&result.Action),
+		Amount:         result.Amount,
+		Points:         result.Points,
+		NextCheckIn:    result.NextCheckIn,
+		Badges:         toBadgeResponses(badges),
+		XP:             result.XP.Gained,
+		Level:          result.XP.Level,
+		LeveledUp:      result.XP.LeveledUp,
+		CompletedGoals: toGoalResponses(result.CompletedGoals),
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 // GetLeaderboard godoc
 // @Summary Get club leaderboard
-// @Description Fetch top N users sorted by score
+// @Description Fetch top N users sorted by score. Only members can see it. A score adds up the points each check-in earned at the time, so changing an action's weight does not re-weight earlier check-ins.
 // @Tags Leaderboard
 // @Security BearerAuth
 // @Produce json
 // @Param clubId path int true "Club ID"
-// @Param limit query int false "Result limit" default(50)
+// @Param limit query int false "Result limit, at most 100" default(50)
 // @Success 200 {array} dto.LeaderboardEntryResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs/{clubId}/leaderboard [get]
 func GetLeaderboard(c *gin.Context) {
@@ -66,13 +124,17 @@ func GetLeaderboard(c *gin.Context) {
 		return
 	}
 
-	limit := 50
+	limit := leaderboardDefaultLimit
 	if l := c.Query("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil {
-			limit = parsed
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = min(parsed, leaderboardMaxLimit)
 		}
 	}
 
+	if !requireClubMember(c, middlewares.GetPrincipal(c).UserID, uint(clubID)) {
+		return
+	}
+
 	entries, err := models.GetLeaderboardForClub(uint(clubID), limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
@@ -89,11 +151,7 @@ func GetLeaderboard(c *gin.Context) {
 			return
 		}
 		resp = append(resp, dto.LeaderboardEntryResponse{
-			User: dto.User{
-				ID:       user.ID,
-				Username: user.Username,
-				AvatarID: user.AvatarID,
-			},
+			User:          toUserDTO(user),
 			CurrentStreak: e.CurrentStreak,
 			LongestStreak: e.LongestStreak,
 			Score:         e.Score,
@@ -103,3 +161,120 @@ func GetLeaderboard(c *gin.Context) {
 
 	c.JSON(http.StatusOK, resp)
 }
+
+func configuredBadges() []models.Badge {
+	badges := make([]models.Badge, 0, len(config.AppConfig.Badges))
+	for _, b := range config.AppConfig.Badges {
+		badges = append(badges, models.Badge{
+			Key:         b.Key,
+			Name:        b.Name,
+			Description: b.Description,
+			Rule:        b.Rule,
+			Threshold:   b.Threshold,
+		})
+	}
+	return badges
+}
+
+func xpRules() models.XPRules {
+	xp := config.AppConfig.XP
+	return models.XPRules{
+		PerCheckIn:  xp.PerCheckIn,
+		DailyDecay:  xp.DailyDecay,
+		LevelBase:   xp.LevelBase,
+		LevelGrowth: xp.LevelGrowth,
+	}
+}
+
+func toBadgeResponses(badges []models.UserBadge) []dto.BadgeResponse {
+	resp := make([]dto.BadgeResponse, 0, len(badges))
+	for _, b := range badges {
+		resp = append(resp, dto.BadgeResponse{
+			Key:         b.BadgeKey,
+			Name:        b.Name,
+			Description: b.Description,
+			ClubID:      b.ClubID,
+			AwardedAt:   b.AwardedAt,
+		})
+	}
+	return resp
+}
+
+// AdjustMemberScore godoc
+// @Summary Adjust a member's score
+// @Description Adds points to, or with a negative value deducts them from, a member's club score. The change is announced in the club chat and does not count as a check-in. Needs the adjust scores permission.
+// @Tags Leaderboard
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param userId path int true "User ID"
+// @Param adjustment body dto.AdjustScoreRequest true "Points and reason"
+// @Success 200 {object} dto.LeaderboardEntryResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/members/{userId}/score [post]
+func AdjustMemberScore(c *gin.Context) {
+	clubID, targetID, ok := parseClubMemberParams(c)
+	if !ok {
+		return
+	}
+
+	var req dto.AdjustScoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	if !requireActiveClub(c, clubID) {
+		return
+	}
+
+	var reason *string
+	if req.Reason != nil {
+		if trimmed := strings.TrimSpace(*req.Reason); trimmed != "" {
+			reason = &trimmed
+		}
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	entry, err := models.AdjustScore(userID, targetID, clubID, req.Points, reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrCannotAdjustOwnScore):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrPermissionDenied):
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrNotClubMember):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrScoreBelowZero):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+	logger.LogInfo("User", userID, "adjusted the score of user", targetID, "in club", clubID, "by", req.Points)
+
+	user, err := models.GetUserByID(entry.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.LeaderboardEntryResponse{
+		User:          toUserDTO(user),
+		Score:         entry.Score,
+		CurrentStreak: entry.CurrentStreak,
+		LongestStreak: entry.LongestStreak,
+		LastCheckedIn: entry.LastCheckedIn,
+	})
+}
@@ -0,0 +1,315 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UpdateMemberRole godoc
+// @Summary Promote or demote a club member
+// @Description Owners and admins can change the role of members ranked below them to a role below their own
+// @Tags Clubs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param userId path int true "User ID"
+// @Param role body dto.UpdateMemberRoleRequest true "New role"
+// @Success 200 {object} dto.MemberResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/members/{userId}/role [put]
+func UpdateMemberRole(c *gin.Context) {
+	clubID, targetID, ok := parseClubMemberParams(c)
+	if !ok {
+		return
+	}
+
+	var req dto.UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	member, err := models.SetMemberRole(userID, targetID, clubID, req.Role)
+	if err != nil {
+		writeMemberActionError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "set role of user", targetID, "in club", clubID, "to", req.Role)
+
+	user, err := models.GetUserByID(member.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MemberResponse{
+		User:     toUserDTO(user),
+		Role:     req.Role,
+		JoinedAt: member.JoinedAt,
+	})
+}
+
+// KickMember godoc
+// @Summary Kick a club member
+// @Description Removes a member ranked below the caller. They can rejoin with the invite code.
+// @Tags Clubs
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param userId path int true "User ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/members/{userId} [delete]
+func KickMember(c *gin.Context) {
+	clubID, targetID, ok := parseClubMemberParams(c)
+	if !ok {
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if err := models.KickMember(userID, targetID, clubID); err != nil {
+		writeMemberActionError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "kicked user", targetID, "from club", clubID)
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "member removed from club"})
+}
+
+// GetClubBans godoc
+// @Summary List active bans of a club
+// @Tags Clubs
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.ClubBanResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/bans [get]
+func GetClubBans(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+	if !requireClubPermission(c, userID, uint(clubID), models.PermissionManageMembers) {
+		return
+	}
+
+	bans, err := models.GetClubBans(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := make([]dto.ClubBanResponse, 0, len(bans))
+	for _, ban := range bans {
+		banResp, err := toClubBanResponse(&ban)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		resp = append(resp, banResp)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// BanMember godoc
+// @Summary Ban a user from a club
+// @Description Removes the user if they are a member and blocks rejoining by code until the ban expires or is lifted
+// @Tags Clubs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param userId path int true "User ID"
+// @Param ban body dto.BanMemberRequest false "Ban reason and expiry"
+// @Success 200 {object} dto.ClubBanResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/bans/{userId} [post]
+func BanMember(c *gin.Context) {
+	clubID, targetID, ok := parseClubMemberParams(c)
+	if !ok {
+		return
+	}
+
+	var req dto.BanMemberRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	var reason *string
+	if req.Reason != nil {
+		if trimmed := strings.TrimSpace(*req.Reason); trimmed != "" {
+			reason = &trimmed
+		}
+	}
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		t := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	ban, err := models.BanMember(userID, targetID, clubID, reason, expiresAt)
+	if err != nil {
+		writeMemberActionError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "banned user", targetID, "from club", clubID)
+
+	resp, err := toClubBanResponse(ban)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UnbanMember godoc
+// @Summary Lift a club ban
+// @Tags Clubs
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param userId path int true "User ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/bans/{userId} [delete]
+func UnbanMember(c *gin.Context) {
+	clubID, targetID, ok := parseClubMemberParams(c)
+	if !ok {
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if err := models.UnbanMember(userID, targetID, clubID); err != nil {
+		writeMemberActionError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "unbanned user", targetID, "from club", clubID)
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "ban lifted"})
+}
+
+// TransferOwnership godoc
+// @Summary Transfer club ownership
+// @Description The owner hands the club to another member and becomes an admin
+// @Tags Clubs
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param owner body dto.TransferOwnershipRequest true "New owner"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/owner [post]
+func TransferOwnership(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	var req dto.TransferOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if err := models.TransferOwnership(userID, req.UserID, uint(clubID)); err != nil {
+		writeMemberActionError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "transferred club", clubID, "to user", req.UserID)
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "ownership transferred"})
+}
+
+func parseClubMemberParams(c *gin.Context) (clubID, userID uint, ok bool) {
+	club, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return 0, 0, false
+	}
+	user, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid user id"})
+		return 0, 0, false
+	}
+	return uint(club), uint(user), true
+}
+
+func writeMemberActionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrInvalidRole), errors.Is(err, models.ErrCannotModerateYourself), errors.Is(err, models.ErrAlreadyClubOwner):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrNotClubMember), errors.Is(err, models.ErrNotBanned):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "user not found"})
+	case errors.Is(err, models.ErrRoleChangeForbidden), errors.Is(err, models.ErrMemberActionForbidden), errors.Is(err, models.ErrNotClubOwner):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+}
+
+func toClubBanResponse(ban *models.ClubBan) (dto.ClubBanResponse, error) {
+	user, err := models.GetUserByID(ban.UserID)
+	if err != nil {
+		return dto.ClubBanResponse{}, err
+	}
+	return dto.ClubBanResponse{
+		User:      toUserDTO(user),
+		BannedBy:  ban.BannedBy,
+		Reason:    ban.Reason,
+		ExpiresAt: ban.ExpiresAt,
+		CreatedAt: ban.CreatedAt,
+	}, nil
+}
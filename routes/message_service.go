@@ -1,7 +1,9 @@
 package routes
 
 import (
+	"errors"
 	"klubRanks/dto"
+	"klubRanks/middlewares"
 	"klubRanks/models"
 	"net/http"
 	"strconv"
@@ -20,6 +22,9 @@ import (
 // @Param message body dto.SendMessageRequest true "Message payload"
 // @Success 201 {object} dto.ClubMessageResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs/{clubId}/messages [post]
 func SendMessage(c *gin.Context) {
@@ -39,7 +44,11 @@ func SendMessage(c *gin.Context) {
 		return
 	}
 
-	userID := c.GetUint("userId")
+	if !requireActiveClub(c, uint(clubID)) {
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
 
 	msg := models.Message{
 		ClubID:    uint(clubID),
@@ -50,9 +59,14 @@ func SendMessage(c *gin.Context) {
 	}
 
 	if err := msg.AddMessage(); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Error: err.Error(),
-		})
+		switch {
+		case errors.Is(err, models.ErrInvalidReply):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrNotClubMember), errors.Is(err, models.ErrBannedFromClub):
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		}
 		return
 	}
 	c.JSON(http.StatusCreated, dto.MessageResponse{
@@ -62,7 +76,7 @@ func SendMessage(c *gin.Context) {
 
 // GetClubMessages godoc
 // @Summary Get club messages
-// @Description Fetch paginated messages for a club
+// @Description Fetch paginated messages for a club. Only members without an active ban can read the chat.
 // @Tags Messages
 // @Security BearerAuth
 // @Produce json
@@ -70,6 +84,8 @@ func SendMessage(c *gin.Context) {
 // @Param limit query int false "Limit" default(50)
 // @Param offset query int false "Offset" default(0)
 // @Success 200 {array} dto.ClubMessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /clubs/{clubId}/messages [get]
 func GetClubMessages(c *gin.Context) {
@@ -96,6 +112,10 @@ func GetClubMessages(c *gin.Context) {
 		}
 	}
 
+	if !requireClubMember(c, middlewares.GetPrincipal(c).UserID, uint(clubID)) {
+		return
+	}
+
 	messages, err := models.GetMessagesForClub(uint(clubID), limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
@@ -104,6 +124,55 @@ func GetClubMessages(c *gin.Context) {
 		return
 	}
 
+	writeMessages(c, messages)
+}
+
+// DeleteClubMessage godoc
+// @Summary Delete a chat message
+// @Description Members can delete their own messages. Deleting anyone else's message, in the club or a team chat, needs the moderate chat permission.
+// @Tags Messages
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param messageId path int true "Message ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/messages/{messageId} [delete]
+func DeleteClubMessage(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid message id"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if err := models.DeleteMessage(userID, uint(clubID), uint(messageID)); err != nil {
+		switch {
+		case errors.Is(err, models.ErrMessageNotFound):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrNotClubMember), errors.Is(err, models.ErrPermissionDenied):
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: models.ErrPermissionDenied.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "message deleted"})
+}
+
+// writeMessages responds with the messages and the authors of the messages
+// they reply to.
+func writeMessages(c *gin.Context, messages []models.Message) {
 	resp := make([]dto.ClubMessageResponse, 0, len(messages))
 	// for _, m := range messages {
 	// 	user, err := models.GetUserByID(m.UserID)
@@ -132,11 +201,7 @@ func GetClubMessages(c *gin.Context) {
 			})
 			return
 		}
-		userDto := dto.User{
-			ID:       user.ID, // Uses preloaded User
-			Username: user.Username,
-			AvatarID: user.AvatarID,
-		}
+		userDto := toUserDTO(user)
 
 		var replyToDto *dto.ReplyInfo
 		if m.ReplyTo != nil {
@@ -148,11 +213,7 @@ func GetClubMessages(c *gin.Context) {
 				return
 			}
 			replyToDto = &dto.ReplyInfo{
-				User: dto.User{
-					ID:       replyToUser.ID,
-					Username: replyToUser.Username,
-					AvatarID: replyToUser.AvatarID,
-				},
+				User:    toUserDTO(replyToUser),
 				Message: m.ReplyTo.Message,
 			}
 		}
@@ -0,0 +1,290 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/config"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"klubRanks/oauth"
+	"klubRanks/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// oauthBrowserCookie holds the secret that ties a provider login to the
+// browser that started it.
+const oauthBrowserCookie = "oauth_browser"
+
+// GetLoginProviders godoc
+// @Summary List external login providers
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} dto.LoginProvidersResponse
+// @Router /auth/providers [get]
+func GetLoginProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, dto.LoginProvidersResponse{Providers: oauth.Names()})
+}
+
+// StartProviderLogin godoc
+// @Summary Start login with an external provider
+// @Description Returns the provider URL to send the user to (authorization code flow with PKCE)
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} dto.AuthorizationURLResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 502 {object} dto.ErrorResponse
+// @Router /auth/{provider}/login [get]
+func StartProviderLogin(c *gin.Context) {
+	startProviderFlow(c, nil)
+}
+
+// ProviderCallback godoc
+// @Summary Finish login with an external provider
+// @Description Exchanges the authorization code, verifies the ID token and logs the user in, creating an account on first login. For link requests the provider is linked to the requesting user instead. Must come from the browser that started the login, which holds the oauth_browser cookie.
+// @Tags Auth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the login request"
+// @Success 200 {object} dto.LoginResponse
+// @Success 202 {object} dto.TwoFactorChallengeResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /auth/{provider}/callback [get]
+func ProviderCallback(c *gin.Context) {
+	providerName := c.Param("provider")
+
+	provider, err := oauth.Get(providerName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "login was not completed: " + providerErr})
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" || c.Query("state") == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "missing code or state"})
+		return
+	}
+
+	binding, _ := c.Cookie(oauthBrowserCookie)
+	setOAuthBrowserCookie(c, providerName, "", -1)
+
+	state, err := models.ConsumeOAuthState(c.Query("state"), providerName, binding)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), code, oauth.AuthRequest{
+		State:        state.State,
+		CodeVerifier: state.CodeVerifier,
+		Nonce:        state.Nonce,
+	})
+	if err != nil {
+		logger.LogError("Login with", providerName, "failed:", err)
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "could not verify login with " + providerName})
+		return
+	}
+
+	if state.LinkUserID != nil {
+		err := models.LinkExternalIdentity(*state.LinkUserID, identity.Provider, identity.Subject, identity.Email)
+		if err != nil {
+			if errors.Is(err, models.ErrIdentityLinkedElsewhere) || errors.Is(err, models.ErrProviderAlreadyLinked) {
+				c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		logger.LogInfo("User", *state.LinkUserID, "linked login provider", providerName)
+		c.JSON(http.StatusOK, dto.MessageResponse{Message: providerName + " account linked"})
+		return
+	}
+
+	user, err := models.GetUserByExternalIdentity(identity.Provider, identity.Subject)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		hint := identity.PreferredUsername
+		if hint == "" {
+			hint = identity.Email
+		}
+		if hint == "" {
+			hint = identity.Name
+		}
+		user, err = models.CreateUserWithExternalIdentity(hint, identity.Provider, identity.Subject, identity.Email)
+		if err == nil {
+			logger.LogInfo("Created user", user.ID, "from", providerName, "login")
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	enabled, err := models.IsTwoFactorEnabled(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if enabled {
+		challenge, err := issueTwoFactorChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, dto.TwoFactorChallengeResponse{
+			Message:           "two-factor authentication required",
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+		})
+		return
+	}
+
+	token, err := utils.GenerateToken(user.Username, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.LoginResponse{
+		Message: "login successful",
+		Token:   token,
+		User:    toUserDTO(user),
+	})
+}
+
+// GetMyIdentities godoc
+// @Summary List linked login providers
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} dto.ExternalIdentityResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/identities [get]
+func GetMyIdentities(c *gin.Context) {
+	identities, err := models.GetExternalIdentitiesForUser(middlewares.GetPrincipal(c).UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := make([]dto.ExternalIdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		resp = append(resp, dto.ExternalIdentityResponse{
+			Provider:    identity.Provider,
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt,
+			LastLoginAt: identity.LastLoginAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// LinkProvider godoc
+// @Summary Link an external login provider
+// @Description Returns the provider URL to send the user to. The callback links the provider to the current user.
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} dto.AuthorizationURLResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 502 {object} dto.ErrorResponse
+// @Router /users/me/identities/{provider} [post]
+func LinkProvider(c *gin.Context) {
+	userID := middlewares.GetPrincipal(c).UserID
+	startProviderFlow(c, &userID)
+}
+
+// UnlinkProvider godoc
+// @Summary Unlink an external login provider
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Param provider path string true "Provider name"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/identities/{provider} [delete]
+func UnlinkProvider(c *gin.Context) {
+	err := models.UnlinkExternalIdentity(middlewares.GetPrincipal(c).UserID, c.Param("provider"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "provider is not linked"})
+		case errors.Is(err, models.ErrLastLoginMethod):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "provider unlinked"})
+}
+
+// startProviderFlow stores a new login request and responds with the
+// provider's authorization URL. linkUserID is set when linking.
+func startProviderFlow(c *gin.Context, linkUserID *uint) {
+	providerName := c.Param("provider")
+
+	provider, err := oauth.Get(providerName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	authReq, err := oauth.NewAuthRequest()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), authReq)
+	if err != nil {
+		logger.LogError("Could not reach login provider", providerName, ":", err)
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Error: "login provider is unavailable"})
+		return
+	}
+
+	err = models.SaveOAuthState(&models.OAuthState{
+		State:        authReq.State,
+		Provider:     providerName,
+		CodeVerifier: authReq.CodeVerifier,
+		Nonce:        authReq.Nonce,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(config.AppConfig.OAuth.StateExpiry),
+
+		BrowserBindingHash: utils.HashToken(authReq.BrowserBinding),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	setOAuthBrowserCookie(c, providerName, authReq.BrowserBinding, int(config.AppConfig.OAuth.StateExpiry.Seconds()))
+	c.JSON(http.StatusOK, dto.AuthorizationURLResponse{AuthorizationURL: authURL})
+}
+
+// setOAuthBrowserCookie sets the browser binding cookie, scoped to the
+// provider's callback. A negative maxAge removes it.
+func setOAuthBrowserCookie(c *gin.Context, providerName, value string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthBrowserCookie, value, maxAge, "/auth/"+providerName+"/callback", "",
+		config.AppConfig.Server.Env != config.EnvDev, true)
+}
@@ -0,0 +1,487 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"klubRanks/config"
+	"klubRanks/db"
+	"klubRanks/models"
+	"klubRanks/oauth"
+	"klubRanks/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	testProvider = "mock"
+	testClientID = "klubranks-test"
+)
+
+// mockIssuer is an in-process OpenID Connect issuer. Tests authorize a
+// login by handing it the parameters of the authorization URL, and it
+// answers the token request for the code it returns with a signed ID token.
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	codes  map[string]authorization
+	issued int
+}
+
+type authorization struct {
+	subject       string
+	username      string
+	nonce         string
+	codeChallenge string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &mockIssuer{key: key, codes: map[string]authorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint":         issuer.server.URL + "/token",
+			"jwks_uri":               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", issuer.token)
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	auth, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                m.server.URL,
+		"aud":                testClientID,
+		"sub":                auth.subject,
+		"nonce":              auth.nonce,
+		"preferred_username": auth.username,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+	})
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+}
+
+// authorize plays the user signing in at the issuer and returns the code the
+// issuer redirects back with. nonce overrides the one from the URL when set.
+func (m *mockIssuer) authorize(t *testing.T, authURL, subject, username, nonce string) (code, state string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := u.Query()
+	if params.Get("client_id") != testClientID || params.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+	if nonce == "" {
+		nonce = params.Get("nonce")
+	}
+
+	m.mu.Lock()
+	m.issued++
+	code = fmt.Sprintf("code-%d", m.issued)
+	m.codes[code] = authorization{
+		subject:       subject,
+		username:      username,
+		nonce:         nonce,
+		codeChallenge: params.Get("code_challenge"),
+	}
+	m.mu.Unlock()
+
+	return code, params.Get("state")
+}
+
+func setupOAuthTest(t *testing.T) (*gin.Engine, *mockIssuer) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	config.AppConfig = config.Config{
+		Server:   config.ServerConfig{Env: config.EnvDev},
+		Database: config.DatabaseConfig{Driver: "sqlite3", DSN: filepath.Join(t.TempDir(), "test.db")},
+		JWT: config.JWTConfig{
+			Algorithm:       utils.AlgorithmHS256,
+			Secret:          "test-secret",
+			Issuer:          "klubranks",
+			Audience:        "klubranks-api",
+			Expiry:          time.Hour,
+			ChallengeExpiry: 5 * time.Minute,
+		},
+		OAuth: config.OAuthConfig{StateExpiry: 10 * time.Minute},
+		XP:    config.XPConfig{PerCheckIn: 10, DailyDecay: 0.5, LevelBase: 100, LevelGrowth: 1.5},
+	}
+
+	db.InitDB()
+	db.DB = db.DB.Session(&gorm.Session{Logger: gormlogger.Default.LogMode(gormlogger.Silent)})
+	err := db.DB.AutoMigrate(
+		&models.User{},
+		&models.UsernameChange{},
+		&models.ExternalIdentity{},
+		&models.OAuthState{},
+		&models.TwoFactorChallenge{},
+		&models.RecoveryCode{},
+		&models.APIToken{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	issuer := newMockIssuer(t)
+	oauth.Register(oauth.NewOIDCProvider(config.OAuthProviderConfig{
+		Name:         testProvider,
+		Issuer:       issuer.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://localhost/auth/mock/callback",
+		Scopes:       []string{"openid", "profile"},
+	}))
+
+	server := gin.New()
+	RegisterRoutes(server)
+	return server, issuer
+}
+
+func doRequest(t *testing.T, server *gin.Engine, method, path, token string, body any, cookies ...*http.Cookie) (int, map[string]any) {
+	t.Helper()
+
+	rec := record(t, server, method, path, token, body, cookies...)
+	return rec.Code, decodeBody(t, method, path, rec)
+}
+
+func record(t *testing.T, server *gin.Engine, method, path, token string, body any, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeBody(t *testing.T, method, path string, rec *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+
+	var resp map[string]any
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return resp
+}
+
+// startFlow calls the login or link endpoint and returns the authorization
+// URL the user would be sent to, along with the cookie binding the login to
+// the browser that started it.
+func startFlow(t *testing.T, server *gin.Engine, method, path, token string) (string, *http.Cookie) {
+	t.Helper()
+
+	rec := record(t, server, method, path, token, nil)
+	resp := decodeBody(t, method, path, rec)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s %s: got %d %v", method, path, rec.Code, resp)
+	}
+	authURL, _ := resp["authorization_url"].(string)
+	if authURL == "" {
+		t.Fatalf("%s %s: no authorization_url in %v", method, path, resp)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == oauthBrowserCookie {
+			if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+				t.Fatalf("%s %s: browser cookie must be HttpOnly and SameSite=Lax", method, path)
+			}
+			return authURL, cookie
+		}
+	}
+	t.Fatalf("%s %s: no %s cookie set", method, path, oauthBrowserCookie)
+	return "", nil
+}
+
+// callback completes a login in the browser holding cookie, or in one
+// without it when cookie is nil.
+func callback(t *testing.T, server *gin.Engine, code, state string, cookie *http.Cookie) (int, map[string]any) {
+	t.Helper()
+	path := fmt.Sprintf("/auth/%s/callback?code=%s&state=%s", testProvider, url.QueryEscape(code), url.QueryEscape(state))
+	if cookie == nil {
+		return doRequest(t, server, http.MethodGet, path, "", nil)
+	}
+	return doRequest(t, server, http.MethodGet, path, "", nil, cookie)
+}
+
+// providerLogin runs a full login through the mock issuer and returns the
+// logged in user's ID and token.
+func providerLogin(t *testing.T, server *gin.Engine, issuer *mockIssuer, subject, username string) (uint, string) {
+	t.Helper()
+
+	authURL, cookie := startFlow(t, server, http.MethodGet, "/auth/"+testProvider+"/login", "")
+	code, state := issuer.authorize(t, authURL, subject, username, "")
+
+	status, resp := callback(t, server, code, state, cookie)
+	if status != http.StatusOK {
+		t.Fatalf("callback: got %d %v", status, resp)
+	}
+	user, _ := resp["user"].(map[string]any)
+	id, _ := user["id"].(float64)
+	token, _ := resp["token"].(string)
+	if id == 0 || token == "" {
+		t.Fatalf("callback: no user or token in %v", resp)
+	}
+	return uint(id), token
+}
+
+func TestProviderCallbackCreatesAndLogsInUser(t *testing.T) {
+	server, issuer := setupOAuthTest(t)
+
+	userID, _ := providerLogin(t, server, issuer, "subject-1", "alice")
+
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("username = %q, want alice", user.Username)
+	}
+	if user.Password != "" {
+		t.Error("provider user should not have a password")
+	}
+
+	again, _ := providerLogin(t, server, issuer, "subject-1", "alice")
+	if again != userID {
+		t.Errorf("second login got user %d, want %d", again, userID)
+	}
+}
+
+func TestProviderCallbackRejectsReusedState(t *testing.T) {
+	server, issuer := setupOAuthTest(t)
+
+	authURL, cookie := startFlow(t, server, http.MethodGet, "/auth/"+testProvider+"/login", "")
+	code, state := issuer.authorize(t, authURL, "subject-1", "alice", "")
+	if status, resp := callback(t, server, code, state, cookie); status != http.StatusOK {
+		t.Fatalf("first callback: got %d %v", status, resp)
+	}
+
+	code, _ = issuer.authorize(t, authURL, "subject-1", "alice", "")
+	if status, _ := callback(t, server, code, state, cookie); status != http.StatusBadRequest {
+		t.Errorf("reused state: got %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestProviderCallbackRejectsUnknownState(t *testing.T) {
+	server, issuer := setupOAuthTest(t)
+
+	authURL, cookie := startFlow(t, server, http.MethodGet, "/auth/"+testProvider+"/login", "")
+	code, _ := issuer.authorize(t, authURL, "subject-1", "alice", "")
+	if status, _ := callback(t, server, code, "forged-state", cookie); status != http.StatusBadRequest {
+		t.Errorf("unknown state: got %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestProviderCallbackRejectsNonceMismatch(t *testing.T) {
+	server, issuer := setupOAuthTest(t)
+
+	authURL, cookie := startFlow(t, server, http.MethodGet, "/auth/"+testProvider+"/login", "")
+	code, state := issuer.authorize(t, authURL, "subject-1", "alice", "replayed-nonce")
+	if status, _ := callback(t, server, code, state, cookie); status != http.StatusUnauthorized {
+		t.Errorf("nonce mismatch: got %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	if _, err := models.GetUserByExternalIdentity(testProvider, "subject-1"); err == nil {
+		t.Error("user was created despite the nonce mismatch")
+	}
+}
+
+func TestLinkProvider(t *testing.T) {
+	server, issuer := setupOAuthTest(t)
+
+	status, resp := doRequest(t, server, http.MethodPost, "/signup", "", map[string]string{
+		"username":  "bob",
+		"password":  "Str0ngPassword!",
+		"avatar_id": "default",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("signup: got %d %v", status, resp)
+	}
+	bob, err := models.GetUserByUsername("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := utils.GenerateToken(bob.Username, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	linkPath := "/users/me/identities/" + testProvider
+	authURL, cookie := startFlow(t, server, http.MethodPost, linkPath, token)
+	code, state := issuer.authorize(t, authURL, "subject-bob", "bob-elsewhere", "")
+	if status, resp := callback(t, server, code, state, cookie); status != http.StatusOK {
+		t.Fatalf("link callback: got %d %v", status, resp)
+	}
+
+	userID, _ := providerLogin(t, server, issuer, "subject-bob", "bob-elsewhere")
+	if userID != bob.ID {
+		t.Errorf("login with linked provider got user %d, want %d", userID, bob.ID)
+	}
+
+	// A provider account already linked to someone else can't be linked.
+	providerLogin(t, server, issuer, "subject-carol", "carol")
+	authURL, cookie = startFlow(t, server, http.MethodPost, linkPath, token)
+	code, state = issuer.authorize(t, authURL, "subject-carol", "carol", "")
+	if status, _ := callback(t, server, code, state, cookie); status != http.StatusConflict {
+		t.Errorf("linking another user's identity: got %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestProviderCallbackRejectsOtherBrowser(t *testing.T) {
+	server, issuer := setupOAuthTest(t)
+
+	_, attacker := providerLogin(t, server, issuer, "subject-mallory", "mallory")
+
+	// The attacker starts linking and hands the provider URL to the victim,
+	// who signs in at the provider in their own browser.
+	authURL, _ := startFlow(t, server, http.MethodPost, "/users/me/identities/"+testProvider, attacker)
+	_, victimCookie := startFlow(t, server, http.MethodGet, "/auth/"+testProvider+"/login", "")
+
+	code, state := issuer.authorize(t, authURL, "subject-victim", "victim", "")
+	if status, _ := callback(t, server, code, state, victimCookie); status != http.StatusBadRequest {
+		t.Errorf("callback with another flow's cookie: got %d, want %d", status, http.StatusBadRequest)
+	}
+
+	code, _ = issuer.authorize(t, authURL, "subject-victim", "victim", "")
+	if status, _ := callback(t, server, code, state, nil); status != http.StatusBadRequest {
+		t.Errorf("callback without a cookie: got %d, want %d", status, http.StatusBadRequest)
+	}
+
+	if _, err := models.GetUserByExternalIdentity(testProvider, "subject-victim"); err == nil {
+		t.Error("the victim's identity was linked from another browser")
+	}
+}
+
+func TestSetPasswordForProviderUser(t *testing.T) {
+	server, issuer := setupOAuthTest(t)
+
+	_, token := providerLogin(t, server, issuer, "subject-1", "alice")
+
+	status, resp := doRequest(t, server, http.MethodPut, "/users/me/password", token, map[string]string{
+		"new_password": "Str0ngPassword!",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("first password: got %d %v", status, resp)
+	}
+
+	status, _ = doRequest(t, server, http.MethodPost, "/login", "", map[string]string{
+		"username": "alice",
+		"password": "Str0ngPassword!",
+	})
+	if status != http.StatusOK {
+		t.Errorf("login with new password: got %d, want %d", status, http.StatusOK)
+	}
+
+	// Once a password exists, changing it needs the current one.
+	status, _ = doRequest(t, server, http.MethodPut, "/users/me/password", token, map[string]string{
+		"new_password": "An0therPassword!",
+	})
+	if status != http.StatusUnauthorized {
+		t.Errorf("change without current password: got %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	status, _ = doRequest(t, server, http.MethodPut, "/users/me/password", token, map[string]string{
+		"current_password": "Str0ngPassword!",
+		"new_password":     "An0therPassword!",
+	})
+	if status != http.StatusOK {
+		t.Errorf("change with current password: got %d, want %d", status, http.StatusOK)
+	}
+
+	if status, _ := doRequest(t, server, http.MethodDelete, "/users/me/identities/"+testProvider, token, nil); status != http.StatusOK {
+		t.Errorf("unlink after setting a password: got %d, want %d", status, http.StatusOK)
+	}
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"klubRanks/middlewares"
+	"klubRanks/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,33 +23,161 @@ func RegisterRoutes(server *gin.Engine) {
 
 	server.POST("/signup", signup)
 	server.POST("/login", login)
+	server.POST("/login/2fa", LoginTwoFactor)
+	server.GET("/.well-known/jwks.json", GetJWKS)
+	server.GET("/exports/:token", DownloadDataExport)
+	server.GET("/auth/providers", GetLoginProviders)
+	server.GET("/auth/:provider/login", StartProviderLogin)
+	server.GET("/auth/:provider/callback", ProviderCallback)
 
 	auth := server.Group("/")
 	auth.Use(middlewares.Aunthenticate)
 
-	auth.PUT("/users/avatar", UpdateAvatar)
+	// Scopes required when the request uses a personal API token.
+	read := middlewares.RequireScope(models.ScopeRead)
+	checkin := middlewares.RequireScope(models.ScopeCheckin)
+	chat := middlewares.RequireScope(models.ScopeChat)
+	member := middlewares.RequireScope(models.ScopeMember)
+	admin := middlewares.RequireScope(models.ScopeAdmin)
+
+	users := auth.Group("/users")
+	{
+		users.GET("/me", read, GetMyProfile)
+		users.GET("/by-username/:username", read, GetUserProfileByUsername)
+		users.GET("/:userId", read, GetUserProfile)
+	}
+
+	account := auth.Group("/users", middlewares.RequireSession)
+	{
+		account.PUT("/avatar", UpdateAvatar)
+		account.PATCH("/me", UpdateMyProfile)
+		account.DELETE("/me", DeleteMyAccount)
+		account.PUT("/me/password", SetMyPassword)
+		account.POST("/me/export", RequestDataExport)
+		account.GET("/me/export/:exportId", GetDataExport)
+		account.GET("/me/2fa", GetTwoFactorStatus)
+		account.POST("/me/2fa/setup", SetupTwoFactor)
+		account.POST("/me/2fa/confirm", ConfirmTwoFactor)
+		account.POST("/me/2fa/disable", DisableTwoFactor)
+		account.POST("/me/2fa/recovery-codes", ResetRecoveryCodes)
+		account.GET("/me/identities", GetMyIdentities)
+		account.POST("/me/identities/:provider", LinkProvider)
+		account.DELETE("/me/identities/:provider", UnlinkProvider)
+		account.GET("/me/tokens", GetMyAPITokens)
+		account.POST("/me/tokens", CreateAPIToken)
+		account.DELETE("/me/tokens/:tokenId", RevokeAPIToken)
+	}
 
 	clubs := auth.Group("/clubs")
 	{
-		clubs.POST("", CreateClub)
-		clubs.GET("", GetMyClubs)
-		clubs.PUT("/:clubId", UpdateClub)
-		clubs.GET("/:clubId/members", GetClubMembers)
-		clubs.POST("/join/:code", JoinClub)
-		clubs.DELETE("/:clubId/members", LeaveClub)
-		clubs.GET("/:clubId/stats/me", GetCurrentUserStats)
-		clubs.GET("/:clubId/stats/:userId", GetUserStats)
+		clubs.POST("", admin, CreateClub)
+		clubs.GET("", read, GetMyClubs)
+		clubs.PUT("/:clubId", admin, UpdateClub)
+		clubs.DELETE("/:clubId", admin, DeleteClub)
+		clubs.POST("/:clubId/archive", admin, ArchiveClub)
+		clubs.POST("/:clubId/unarchive", admin, UnarchiveClub)
+		clubs.GET("/:clubId/members", read, GetClubMembers)
+		clubs.POST("/join/:code", member, JoinClub)
+		clubs.GET("/discover", read, DiscoverClubs)
+		clubs.GET("/duels", read, GetMyDuels)
+		clubs.GET("/invitations", read, GetMyInvitations)
+		clubs.POST("/invitations/:invitationId/accept", member, AcceptInvitation)
+		clubs.POST("/invitations/:invitationId/decline", member, DeclineInvitation)
+		clubs.GET("/:clubId/invitations", read, GetClubInvitations)
+		clubs.POST("/:clubId/invitations", admin, InviteUser)
+		clubs.DELETE("/:clubId/invitations/:invitationId", admin, CancelInvitation)
+		clubs.POST("/:clubId/join", member, JoinPublicClub)
+		clubs.GET("/:clubId/waitlist", admin, GetClubWaitlist)
+		clubs.GET("/:clubId/waitlist/me", read, GetMyWaitlistPosition)
+		clubs.DELETE("/:clubId/waitlist/me", member, LeaveWaitlist)
+		clubs.GET("/join-requests", read, GetMyJoinRequests)
+		clubs.DELETE("/join-requests/:requestId", member, CancelJoinRequest)
+		clubs.GET("/:clubId/join-requests", admin, GetClubJoinRequests)
+		clubs.POST("/:clubId/join-requests/:requestId/approve", admin, ApproveJoinRequest)
+		clubs.POST("/:clubId/join-requests/:requestId/reject", admin, RejectJoinRequest)
+		clubs.DELETE("/:clubId/members", member, LeaveClub)
+		clubs.PUT("/:clubId/members/:userId/role", admin, UpdateMemberRole)
+		clubs.DELETE("/:clubId/members/:userId", admin, KickMember)
+		clubs.PUT("/:clubId/members/:userId/team", admin, AssignTeam)
+		clubs.POST("/:clubId/members/:userId/score", admin, AdjustMemberScore)
+		clubs.POST("/:clubId/owner", admin, TransferOwnership)
+		clubs.GET("/:clubId/bans", admin, GetClubBans)
+		clubs.POST("/:clubId/bans/:userId", admin, BanMember)
+		clubs.DELETE("/:clubId/bans/:userId", admin, UnbanMember)
+		clubs.GET("/:clubId/stats/me", read, GetCurrentUserStats)
+		clubs.GET("/:clubId/stats/:userId", read, GetUserStats)
+	}
+
+	invites := auth.Group("/clubs/:clubId/invites")
+	{
+		invites.GET("", admin, GetClubInvites)
+		invites.POST("", admin, CreateClubInvite)
+		invites.DELETE("/:inviteId", admin, RevokeClubInvite)
+		invites.POST("/:inviteId/regenerate", admin, RegenerateClubInvite)
+	}
+
+	actions := auth.Group("/clubs/:clubId/actions")
+	{
+		actions.GET("", read, GetClubActions)
+		actions.POST("", admin, CreateClubAction)
+		actions.PUT("/:actionId", admin, UpdateClubAction)
+		actions.DELETE("/:actionId", admin, DeleteClubAction)
+		actions.GET("/:actionId/leaderboard", read, GetActionLeaderboard)
+	}
+
+	teams := auth.Group("/clubs/:clubId/teams")
+	{
+		teams.GET("", read, GetClubTeams)
+		teams.POST("", admin, CreateTeam)
+		teams.GET("/settings", read, GetTeamSettings)
+		teams.PUT("/settings", admin, UpdateTeamSettings)
+		teams.GET("/leaderboard", read, GetTeamLeaderboard)
+		teams.DELETE("/members/me", member, LeaveTeam)
+		teams.PUT("/:teamId", admin, RenameTeam)
+		teams.DELETE("/:teamId", admin, DeleteTeam)
+		teams.POST("/:teamId/members", member, JoinTeam)
+		teams.POST("/:teamId/messages", chat, SendTeamMessage)
+		teams.GET("/:teamId/messages", read, GetTeamMessages)
+	}
+
+	challenges := auth.Group("/clubs/:clubId/challenges")
+	{
+		challenges.GET("", read, GetClubChallenges)
+		challenges.POST("", admin, CreateChallenge)
+		challenges.GET("/:challengeId", read, GetClubChallenge)
+		challenges.DELETE("/:challengeId", admin, CancelChallenge)
+		challenges.POST("/:challengeId/accept", admin, AcceptChallenge)
+		challenges.POST("/:challengeId/decline", admin, DeclineChallenge)
+	}
+
+	duels := auth.Group("/clubs/:clubId/duels")
+	{
+		duels.GET("", read, GetClubDuels)
+		duels.POST("", member, CreateDuel)
+		duels.DELETE("/:duelId", member, CancelDuel)
+		duels.POST("/:duelId/accept", member, AcceptDuel)
+		duels.POST("/:duelId/decline", member, DeclineDuel)
+	}
+
+	goals := auth.Group("/clubs/:clubId/goals")
+	{
+		goals.GET("", read, GetClubGoals)
+		goals.POST("", member, CreateGoal)
+		goals.GET("/me", read, GetMyGoals)
+		goals.PUT("/:goalId", member, UpdateGoal)
+		goals.DELETE("/:goalId", member, DeleteGoal)
 	}
 
 	leaderboard := auth.Group("/clubs/:clubId/leaderboard")
 	{
-		leaderboard.GET("", GetLeaderboard)
-		leaderboard.POST("/score", UpdateLeaderboardScore)
+		leaderboard.GET("", read, GetLeaderboard)
+		leaderboard.POST("/score", checkin, UpdateLeaderboardScore)
 	}
 
 	messages := auth.Group("/clubs/:clubId/messages")
 	{
-		messages.POST("", SendMessage)
-		messages.GET("", GetClubMessages)
+		messages.POST("", chat, SendMessage)
+		messages.GET("", read, GetClubMessages)
+		messages.DELETE("/:messageId", chat, DeleteClubMessage)
 	}
 }
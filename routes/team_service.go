@@ -0,0 +1,561 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetClubTeams godoc
+// @Summary List club teams
+// @Tags Teams
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.TeamResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams [get]
+func GetClubTeams(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	teams, err := models.GetClubTeams(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := make([]dto.TeamResponse, 0, len(teams))
+	for _, team := range teams {
+		resp = append(resp, toTeamResponse(&team))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateTeam godoc
+// @Summary Create a team
+// @Description Needs permission to manage members
+// @Tags Teams
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param team body dto.TeamRequest true "Team"
+// @Success 201 {object} dto.TeamResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams [post]
+func CreateTeam(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	name, ok := bindTeamName(c)
+	if !ok {
+		return
+	}
+	if !requireActiveClub(c, uint(clubID)) {
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+	team, err := models.CreateTeam(userID, uint(clubID), name)
+	if err != nil {
+		writeTeamError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "created team", team.ID, "in club", clubID)
+
+	c.JSON(http.StatusCreated, toTeamResponse(team))
+}
+
+// RenameTeam godoc
+// @Summary Rename a team
+// @Description Needs permission to manage members
+// @Tags Teams
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param teamId path int true "Team ID"
+// @Param team body dto.TeamRequest true "Team"
+// @Success 200 {object} dto.TeamResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams/{teamId} [put]
+func RenameTeam(c *gin.Context) {
+	clubID, teamID, ok := parseClubTeamParams(c)
+	if !ok {
+		return
+	}
+
+	name, ok := bindTeamName(c)
+	if !ok {
+		return
+	}
+	if !requireActiveClub(c, clubID) {
+		return
+	}
+
+	team, err := models.RenameTeam(middlewares.GetPrincipal(c).UserID, clubID, teamID, name)
+	if err != nil {
+		writeTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toTeamResponse(team))
+}
+
+// DeleteTeam godoc
+// @Summary Delete a team
+// @Description Needs permission to manage members. Members stay in the club without a team; the team chat is deleted.
+// @Tags Teams
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param teamId path int true "Team ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams/{teamId} [delete]
+func DeleteTeam(c *gin.Context) {
+	clubID, teamID, ok := parseClubTeamParams(c)
+	if !ok {
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+	if err := models.DeleteTeam(userID, clubID, teamID); err != nil {
+		writeTeamError(c, err)
+		return
+	}
+	logger.LogInfo("User", userID, "deleted team", teamID, "of club", clubID)
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "team deleted"})
+}
+
+// JoinTeam godoc
+// @Summary Join a team
+// @Description Moves the current user into the team, if the club lets members pick their team
+// @Tags Teams
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param teamId path int true "Team ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams/{teamId}/members [post]
+func JoinTeam(c *gin.Context) {
+	clubID, teamID, ok := parseClubTeamParams(c)
+	if !ok {
+		return
+	}
+	if !requireActiveClub(c, clubID) {
+		return
+	}
+
+	if err := models.JoinTeam(middlewares.GetPrincipal(c).UserID, clubID, teamID); err != nil {
+		writeTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "joined team"})
+}
+
+// LeaveTeam godoc
+// @Summary Leave your team
+// @Description Only if the club lets members pick their team
+// @Tags Teams
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams/members/me [delete]
+func LeaveTeam(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+	if !requireActiveClub(c, uint(clubID)) {
+		return
+	}
+
+	if err := models.LeaveTeam(middlewares.GetPrincipal(c).UserID, uint(clubID)); err != nil {
+		writeTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "left team"})
+}
+
+// AssignTeam godoc
+// @Summary Assign a member to a team
+// @Description Needs permission to manage members. A null team_id takes the member out of their team.
+// @Tags Teams
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param userId path int true "User ID"
+// @Param team body dto.AssignTeamRequest true "Team"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/members/{userId}/team [put]
+func AssignTeam(c *gin.Context) {
+	clubID, targetUserID, ok := parseClubMemberParams(c)
+	if !ok {
+		return
+	}
+
+	var req dto.AssignTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	if !requireActiveClub(c, clubID) {
+		return
+	}
+
+	if err := models.AssignTeam(middlewares.GetPrincipal(c).UserID, targetUserID, clubID, req.TeamID); err != nil {
+		writeTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "team updated"})
+}
+
+// GetTeamSettings godoc
+// @Summary Get a club's team settings
+// @Tags Teams
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {object} dto.TeamSettingsResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams/settings [get]
+func GetTeamSettings(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	club, err := models.GetClub(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "club not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toTeamSettingsResponse(club))
+}
+
+// UpdateTeamSettings godoc
+// @Summary Update a club's team settings
+// @Description Needs permission to edit the club. Sets whether members pick their own team and how member scores add up on the team leaderboard: sum, average, or the sum of the top_n best.
+// @Tags Teams
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param settings body dto.TeamSettingsRequest true "Settings"
+// @Success 200 {object} dto.TeamSettingsResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams/settings [put]
+func UpdateTeamSettings(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	var req dto.TeamSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+	if !requireActiveClub(c, uint(clubID)) {
+		return
+	}
+
+	club, err := models.UpdateTeamSettings(middlewares.GetPrincipal(c).UserID, uint(clubID), req.SelfSelect, req.Scoring, req.TopN)
+	if err != nil {
+		writeTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toTeamSettingsResponse(club))
+}
+
+// GetTeamLeaderboard godoc
+// @Summary Get the team leaderboard
+// @Description Ranks the club's teams by their members' scores, combined as the team settings say
+// @Tags Teams
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.TeamLeaderboardEntryResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams/leaderboard [get]
+func GetTeamLeaderboard(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	standings, err := models.GetTeamLeaderboard(uint(clubID))
+	if err != nil {
+		writeTeamError(c, err)
+		return
+	}
+
+	resp := make([]dto.TeamLeaderboardEntryResponse, 0, len(standings))
+	for _, s := range standings {
+		resp = append(resp, dto.TeamLeaderboardEntryResponse{
+			Team:        toTeamResponse(&s.Team),
+			MemberCount: s.MemberCount,
+			Score:       s.Score,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SendTeamMessage godoc
+// @Summary Send a message to a team chat
+// @Description Only members of the team can use its chat
+// @Tags Teams
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param teamId path int true "Team ID"
+// @Param message body dto.SendMessageRequest true "Message payload"
+// @Success 201 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams/{teamId}/messages [post]
+func SendTeamMessage(c *gin.Context) {
+	clubID, teamID, ok := parseClubTeamParams(c)
+	if !ok {
+		return
+	}
+
+	var req dto.SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if !requireActiveClub(c, clubID) {
+		return
+	}
+	userID := middlewares.GetPrincipal(c).UserID
+	if !requireTeamMember(c, userID, clubID, teamID) {
+		return
+	}
+
+	msg := models.Message{
+		ClubID:    clubID,
+		TeamID:    &teamID,
+		UserID:    userID,
+		Message:   req.Message,
+		Type:      models.MessageTypeUser,
+		ReplyToID: req.ReplyToID,
+	}
+	if err := msg.AddMessage(); err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidReply):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrNotClubMember), errors.Is(err, models.ErrBannedFromClub):
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.MessageResponse{Message: "message sent successfully"})
+}
+
+// GetTeamMessages godoc
+// @Summary Get team chat messages
+// @Description Only members of the team can read its chat
+// @Tags Teams
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Param teamId path int true "Team ID"
+// @Param limit query int false "Limit" default(50)
+// @Param offset query int false "Offset" default(0)
+// @Success 200 {array} dto.ClubMessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/teams/{teamId}/messages [get]
+func GetTeamMessages(c *gin.Context) {
+	clubID, teamID, ok := parseClubTeamParams(c)
+	if !ok {
+		return
+	}
+
+	limit := 50
+	offset := 0
+
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			offset = parsed
+		}
+	}
+
+	if !requireTeamMember(c, middlewares.GetPrincipal(c).UserID, clubID, teamID) {
+		return
+	}
+
+	messages, err := models.GetMessagesForTeam(teamID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	writeMessages(c, messages)
+}
+
+// requireTeamMember writes a 404 or 403 and returns false unless the team
+// exists in the club and the user is in it.
+func requireTeamMember(c *gin.Context, userID, clubID, teamID uint) bool {
+	if _, err := models.GetClubTeam(clubID, teamID); err != nil {
+		writeTeamError(c, err)
+		return false
+	}
+
+	isMember, err := models.IsTeamMember(userID, clubID, teamID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: models.ErrNotTeamMember.Error()})
+		return false
+	}
+	return true
+}
+
+func parseClubTeamParams(c *gin.Context) (uint, uint, bool) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return 0, 0, false
+	}
+	teamID, err := strconv.ParseUint(c.Param("teamId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid team id"})
+		return 0, 0, false
+	}
+	return uint(clubID), uint(teamID), true
+}
+
+func bindTeamName(c *gin.Context) (string, bool) {
+	var req dto.TeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return "", false
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return "", false
+	}
+	return strings.TrimSpace(req.Name), true
+}
+
+func writeTeamError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotClubMember), errors.Is(err, models.ErrPermissionDenied),
+		errors.Is(err, models.ErrTeamSelfSelectDisabled), errors.Is(err, models.ErrNotTeamMember):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrTeamNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "club not found"})
+	case errors.Is(err, models.ErrTeamExists):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, models.ErrInvalidTeamScoring):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	}
+}
+
+func toTeamResponse(team *models.ClubTeam) dto.TeamResponse {
+	return dto.TeamResponse{
+		ID:        team.ID,
+		Name:      team.Name,
+		CreatedAt: team.CreatedAt,
+	}
+}
+
+func toTeamSettingsResponse(club *models.Club) dto.TeamSettingsResponse {
+	return dto.TeamSettingsResponse{
+		SelfSelect: club.TeamSelfSelect,
+		Scoring:    club.TeamScoring,
+		TopN:       club.TeamTopN,
+	}
+}
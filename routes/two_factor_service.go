@@ -0,0 +1,284 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/config"
+	"klubRanks/dto"
+	"klubRanks/logger"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"klubRanks/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginTwoFactor godoc
+// @Summary Complete login with a second factor
+// @Description Exchange the challenge token from /login and a TOTP or recovery code for a JWT. A challenge token works once and is locked after 5 wrong codes.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param payload body dto.TwoFactorLoginRequest true "Challenge token and code"
+// @Success 200 {object} dto.LoginResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /login/2fa [post]
+func LoginTwoFactor(c *gin.Context) {
+	var req dto.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "could not parse data"})
+		return
+	}
+
+	userID, challengeID, err := utils.VerifyChallengeToken(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := models.RedeemTwoFactorChallenge(challengeID, userID, req.Code); err != nil {
+		if errors.Is(err, models.ErrTwoFactorChallengeInvalid) {
+			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: models.ErrInvalidTwoFactor.Error()})
+		return
+	}
+
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid credentials"})
+		return
+	}
+
+	token, err := utils.GenerateToken(user.Username, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.LoginResponse{
+		Message: "login successful",
+		Token:   token,
+		User:    toUserDTO(user),
+	})
+}
+
+// GetTwoFactorStatus godoc
+// @Summary Get two-factor authentication status
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} dto.TwoFactorStatusResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/2fa [get]
+func GetTwoFactorStatus(c *gin.Context) {
+	userID := middlewares.GetPrincipal(c).UserID
+
+	enabled, err := models.IsTwoFactorEnabled(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	remaining, err := models.CountUnusedRecoveryCodes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.TwoFactorStatusResponse{
+		Enabled:                enabled,
+		RemainingRecoveryCodes: remaining,
+	})
+}
+
+// SetupTwoFactor godoc
+// @Summary Start TOTP enrollment
+// @Description Generates a new secret and otpauth URI. Two-factor stays disabled until confirmed.
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param payload body dto.TwoFactorSetupRequest true "Current password"
+// @Success 200 {object} dto.TwoFactorSetupResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/2fa/setup [post]
+func SetupTwoFactor(c *gin.Context) {
+	var req dto.TwoFactorSetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if err := models.CheckPassword(userID, req.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	secret, err := models.BeginTOTPEnrollment(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrTwoFactorEnabled) {
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(config.AppConfig.JWT.TOTPIssuer, user.Username, secret),
+	})
+}
+
+// ConfirmTwoFactor godoc
+// @Summary Confirm TOTP enrollment
+// @Description Enables two-factor authentication and returns recovery codes, shown only once
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param payload body dto.TwoFactorCodeRequest true "Code from the authenticator app"
+// @Success 200 {object} dto.RecoveryCodesResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/2fa/confirm [post]
+func ConfirmTwoFactor(c *gin.Context) {
+	var req dto.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	codes, err := models.ConfirmTOTPEnrollment(userID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrTwoFactorEnabled):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, models.ErrInvalidTwoFactor), errors.Is(err, models.ErrTwoFactorNotStarted):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+	logger.LogInfo("Enabled two-factor authentication for user", userID)
+
+	c.JSON(http.StatusOK, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable two-factor authentication
+// @Description Requires the password and a TOTP or recovery code. Removes the secret and all recovery codes.
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param payload body dto.TwoFactorDisableRequest true "Password and code"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/2fa/disable [post]
+func DisableTwoFactor(c *gin.Context) {
+	var req dto.TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if !reauthenticateTwoFactor(c, userID, req.Password, req.Code) {
+		return
+	}
+
+	if err := models.DisableTOTP(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	logger.LogInfo("Disabled two-factor authentication for user", userID)
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "two-factor authentication disabled"})
+}
+
+// ResetRecoveryCodes godoc
+// @Summary Regenerate recovery codes
+// @Description Invalidates all existing recovery codes and returns a new set
+// @Tags Auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param payload body dto.TwoFactorDisableRequest true "Password and code"
+// @Success 200 {object} dto.RecoveryCodesResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/2fa/recovery-codes [post]
+func ResetRecoveryCodes(c *gin.Context) {
+	var req dto.TwoFactorDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if !reauthenticateTwoFactor(c, userID, req.Password, req.Code) {
+		return
+	}
+
+	codes, err := models.RegenerateRecoveryCodes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// issueTwoFactorChallenge stores a login challenge for the user and returns
+// the token for the second login step.
+func issueTwoFactorChallenge(userID uint) (string, error) {
+	challengeID, err := models.CreateTwoFactorChallenge(userID, config.AppConfig.JWT.ChallengeExpiry)
+	if err != nil {
+		return "", err
+	}
+	return utils.GenerateChallengeToken(userID, challengeID)
+}
+
+// reauthenticateTwoFactor checks both factors and writes the error response
+// when either fails.
+func reauthenticateTwoFactor(c *gin.Context, userID uint, password, code string) bool {
+	if err := models.CheckPassword(userID, password); err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: err.Error()})
+		return false
+	}
+
+	if err := models.VerifySecondFactor(userID, code); err != nil {
+		if errors.Is(err, models.ErrTwoFactorNotEnabled) {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+			return false
+		}
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: models.ErrInvalidTwoFactor.Error()})
+		return false
+	}
+	return true
+}
@@ -1,12 +1,15 @@
 package routes
 
 import (
+	"errors"
 	"klubRanks/dto"
 	"klubRanks/logger"
+	"klubRanks/middlewares"
 	"klubRanks/models"
 	"klubRanks/utils"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,7 +22,8 @@ import (
 // @Produce json
 // @Param user body dto.SignupRequest true "User signup payload"
 // @Success 200 {object} dto.MessageResponse
-// @Failure 401 {object} dto.ErrorResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /signup [post]
 func signup(context *gin.Context) {
@@ -30,6 +34,23 @@ func signup(context *gin.Context) {
 		return
 	}
 
+	req.Username = strings.TrimSpace(req.Username)
+
+	if fields := req.Validate(); len(fields) > 0 {
+		context.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	taken, err := models.IsUsernameTaken(req.Username, 0)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if taken {
+		context.JSON(http.StatusConflict, dto.ErrorResponse{Error: "username is already taken"})
+		return
+	}
+
 	user := models.User{
 		Username: req.Username,
 		Password: req.Password,
@@ -37,6 +58,10 @@ func signup(context *gin.Context) {
 	}
 
 	err = user.Save()
+	if errors.Is(err, models.ErrUsernameTaken) {
+		context.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Could not create user " + err.Error()})
 		return
@@ -52,6 +77,7 @@ func signup(context *gin.Context) {
 // @Produce json
 // @Param user body dto.LoginRequest true "User login payload"
 // @Success 200 {object} dto.LoginResponse
+// @Success 202 {object} dto.TwoFactorChallengeResponse
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 401 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
@@ -80,6 +106,20 @@ func login(context *gin.Context) {
 
 	logger.LogDebug("User " + user.Username + " authenticated successfully with ID " + strconv.FormatUint(uint64(user.ID), 10) + " and AvatarID " + user.AvatarID)
 
+	if user.TOTPEnabled {
+		challenge, err := issueTwoFactorChallenge(user.ID)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		context.JSON(http.StatusAccepted, dto.TwoFactorChallengeResponse{
+			Message:           "two-factor authentication required",
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+		})
+		return
+	}
+
 	token, err := utils.GenerateToken(user.Username, user.ID)
 
 	if err != nil {
@@ -91,11 +131,7 @@ func login(context *gin.Context) {
 	context.JSON(http.StatusOK, dto.LoginResponse{
 		Message: "login successful",
 		Token:   token,
-		User: dto.User{
-			ID:       user.ID,
-			Username: user.Username,
-			AvatarID: user.AvatarID,
-		},
+		User:    toUserDTO(&user),
 	})
 }
 
@@ -117,7 +153,7 @@ func UpdateAvatar(c *gin.Context) {
 		return
 	}
 
-	userID := c.GetUint("userId")
+	userID := middlewares.GetPrincipal(c).UserID
 
 	if err := models.UpdateAvatar(userID, req.AvatarID); err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
@@ -126,3 +162,348 @@ func UpdateAvatar(c *gin.Context) {
 
 	c.JSON(http.StatusOK, dto.MessageResponse{Message: "avatar updated"})
 }
+
+// GetMyProfile godoc
+// @Summary Get current user's profile
+// @Description Profile of the authenticated user with a summary of their club memberships
+// @Tags Users
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} dto.ProfileResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me [get]
+func GetMyProfile(c *gin.Context) {
+	userID := middlewares.GetPrincipal(c).UserID
+
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "user not found"})
+		return
+	}
+
+	clubs, err := models.GetClubsForUser(userID, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	memberships, err := models.GetMembershipsForUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	members := make(map[uint]models.Member, len(memberships))
+	for _, member := range memberships {
+		members[member.ClubID] = member
+	}
+	entries, err := getLeaderboardEntriesByClub(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	ranks, err := models.GetUserRanks(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	summaries := make([]dto.ClubMembershipSummary, 0, len(clubs))
+	for _, club := range clubs {
+		member := members[club.ID]
+		entry := entries[club.ID]
+
+		summaries = append(summaries, dto.ClubMembershipSummary{
+			ClubID:        club.ID,
+			Name:          club.Name,
+			Role:          member.Role,
+			Score:         entry.Score,
+			Rank:          ranks[club.ID],
+			CurrentStreak: entry.CurrentStreak,
+			JoinedAt:      member.JoinedAt,
+			Archived:      club.ArchivedAt != nil,
+		})
+	}
+
+	badges, err := models.GetBadgesForUser(userID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ProfileResponse{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Timezone:    user.Timezone,
+		AvatarID:    user.AvatarID,
+		XP:          user.XP,
+		Level:       xpRules().Level(user.XP),
+		CreatedAt:   user.CreatedAt,
+		Clubs:       summaries,
+		Badges:      toBadgeResponses(badges),
+	})
+}
+
+// UpdateMyProfile godoc
+// @Summary Update current user's profile
+// @Description Change username, display name, bio or timezone. Old usernames keep resolving to the user.
+// @Tags Users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param profile body dto.UpdateProfileRequest true "Profile fields to change"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me [patch]
+func UpdateMyProfile(c *gin.Context) {
+	var req dto.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		req.Username = &username
+	}
+
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	if req.Username != nil {
+		taken, err := models.IsUsernameTaken(*req.Username, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: "username is already taken"})
+			return
+		}
+	}
+
+	err := models.UpdateProfile(userID, req.Username, req.DisplayName, req.Bio, req.Timezone)
+	if errors.Is(err, models.ErrUsernameTaken) {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "profile updated"})
+}
+
+// GetUserProfile godoc
+// @Summary Get a user's public profile
+// @Description Public profile with the clubs shared with the current user, aggregate stats and badges from shared or public clubs
+// @Tags Users
+// @Security BearerAuth
+// @Produce json
+// @Param userId path int true "User ID"
+// @Success 200 {object} dto.PublicProfileResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/{userId} [get]
+func GetUserProfile(c *gin.Context) {
+	targetID, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid user id"})
+		return
+	}
+
+	user, err := models.GetUserByID(uint(targetID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "user not found"})
+		return
+	}
+
+	profile, err := buildPublicProfile(middlewares.GetPrincipal(c).UserID, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetUserProfileByUsername godoc
+// @Summary Look up a user by username
+// @Description Resolves current and previous usernames, so old mentions still find the user
+// @Tags Users
+// @Security BearerAuth
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} dto.PublicProfileResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/by-username/{username} [get]
+func GetUserProfileByUsername(c *gin.Context) {
+	user, err := models.GetUserByUsername(c.Param("username"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "user not found"})
+		return
+	}
+
+	profile, err := buildPublicProfile(middlewares.GetPrincipal(c).UserID, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+func buildPublicProfile(viewerID uint, user *models.User) (dto.PublicProfileResponse, error) {
+	var profile dto.PublicProfileResponse
+
+	history, err := models.GetUsernameHistory(user.ID)
+	if err != nil {
+		return profile, err
+	}
+	previous := make([]string, 0, len(history))
+	for _, h := range history {
+		previous = append(previous, h.OldUsername)
+	}
+
+	clubs, err := models.GetSharedClubs(viewerID, user.ID)
+	if err != nil {
+		return profile, err
+	}
+	shared := make([]dto.SharedClub, 0, len(clubs))
+	for _, club := range clubs {
+		shared = append(shared, dto.SharedClub{ID: club.ID, Name: club.Name})
+	}
+
+	stats, err := models.GetUserAggregateStats(user.ID)
+	if err != nil {
+		return profile, err
+	}
+	duels, err := models.GetDuelRecord(user.ID, 0)
+	if err != nil {
+		return profile, err
+	}
+	badges, err := models.GetBadgesVisibleTo(user.ID, viewerID)
+	if err != nil {
+		return profile, err
+	}
+
+	profile = dto.PublicProfileResponse{
+		ID:                user.ID,
+		Username:          user.Username,
+		DisplayName:       user.DisplayName,
+		Bio:               user.Bio,
+		AvatarID:          user.AvatarID,
+		XP:                user.XP,
+		Level:             xpRules().Level(user.XP),
+		CreatedAt:         user.CreatedAt,
+		PreviousUsernames: previous,
+		SharedClubs:       shared,
+		Stats: dto.AggregateStats{
+			ClubCount:     stats.ClubCount,
+			TotalScore:    stats.TotalScore,
+			TotalCheckIns: stats.TotalCheckIns,
+			LongestStreak: stats.LongestStreak,
+			Duels:         toDuelRecord(duels),
+		},
+		Badges: toBadgeResponses(badges),
+	}
+
+	return profile, nil
+}
+
+// DeleteMyAccount godoc
+// @Summary Delete current user's account
+// @Description Re-authenticates with the password, removes memberships and leaderboard entries, hands over or deletes created clubs, anonymizes messages and activity, and revokes all tokens
+// @Tags Users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param payload body dto.DeleteAccountRequest true "Current password"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me [delete]
+func DeleteMyAccount(c *gin.Context) {
+	var req dto.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	if err := models.CheckPassword(userID, req.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := models.DeleteAccount(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	logger.LogInfo("Deleted account for user", userID)
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "account deleted"})
+}
+
+// SetMyPassword godoc
+// @Summary Set or change the current user's password
+// @Description Users who signed up through a login provider have no password and can set one without current_password. Once set, it can be used to log in and to confirm sensitive actions such as deleting the account or setting up two-factor authentication.
+// @Tags Users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param payload body dto.SetPasswordRequest true "Current and new password"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ValidationErrorResponse
+// @Failure 401 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /users/me/password [put]
+func SetMyPassword(c *gin.Context) {
+	var req dto.SetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request"})
+		return
+	}
+	if fields := req.Validate(); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ValidationErrorResponse{Error: "validation failed", Fields: fields})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+
+	err := models.SetPassword(userID, req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	logger.LogInfo("User", userID, "set a new password")
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "password updated"})
+}
+
+func toUserDTO(user *models.User) dto.User {
+	return dto.User{
+		ID:       user.ID,
+		Username: user.Username,
+		AvatarID: user.AvatarID,
+		XP:       user.XP,
+		Level:    xpRules().Level(user.XP),
+	}
+}
@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"errors"
+	"klubRanks/dto"
+	"klubRanks/middlewares"
+	"klubRanks/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetClubWaitlist godoc
+// @Summary List a club's waitlist
+// @Description Admins only. Entries are in admission order.
+// @Tags Clubs
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {array} dto.WaitlistEntryResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 403 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/waitlist [get]
+func GetClubWaitlist(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	userID := middlewares.GetPrincipal(c).UserID
+	if !requireClubPermission(c, userID, uint(clubID), models.PermissionManageMembers) {
+		return
+	}
+
+	entries, err := models.GetWaitlist(uint(clubID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp := make([]dto.WaitlistEntryResponse, 0, len(entries))
+	for i, entry := range entries {
+		r, err := toWaitlistEntryResponse(&entry, i+1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		resp = append(resp, r)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetMyWaitlistPosition godoc
+// @Summary Get my position on a club's waitlist
+// @Tags Clubs
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {object} dto.WaitlistEntryResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/waitlist/me [get]
+func GetMyWaitlistPosition(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	writeWaitlistEntry(c, http.StatusOK, uint(clubID), middlewares.GetPrincipal(c).UserID)
+}
+
+// LeaveWaitlist godoc
+// @Summary Leave a club's waitlist
+// @Tags Clubs
+// @Security BearerAuth
+// @Produce json
+// @Param clubId path int true "Club ID"
+// @Success 200 {object} dto.MessageResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /clubs/{clubId}/waitlist/me [delete]
+func LeaveWaitlist(c *gin.Context) {
+	clubID, err := strconv.ParseUint(c.Param("clubId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid club id"})
+		return
+	}
+
+	if err := models.LeaveWaitlist(middlewares.GetPrincipal(c).UserID, uint(clubID)); err != nil {
+		if errors.Is(err, models.ErrNotWaitlisted) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "left the waitlist"})
+}
+
+// writeWaitlistEntry responds with the user's entry on the club's waitlist
+// and its position, or a 404 if they are not on it.
+func writeWaitlistEntry(c *gin.Context, status int, clubID, userID uint) {
+	entry, position, err := models.GetWaitlistPosition(clubID, userID)
+	if errors.Is(err, models.ErrNotWaitlisted) {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	resp, err := toWaitlistEntryResponse(entry, position)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(status, resp)
+}
+
+func toWaitlistEntryResponse(entry *models.ClubWaitlistEntry, position int) (dto.WaitlistEntryResponse, error) {
+	club, err := models.GetClub(entry.ClubID)
+	if err != nil {
+		return dto.WaitlistEntryResponse{}, err
+	}
+	user, err := models.GetUserByID(entry.UserID)
+	if err != nil {
+		return dto.WaitlistEntryResponse{}, err
+	}
+
+	return dto.WaitlistEntryResponse{
+		ClubID:    club.ID,
+		ClubName:  club.Name,
+		User:      toUserDTO(user),
+		Position:  position,
+		CreatedAt: entry.CreatedAt,
+	}, nil
+}
@@ -3,46 +3,161 @@ package utils
 import (
 	"errors"
 	"klubRanks/config"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const (
+	TokenTypeAccess = "access"
+	// Issued after the password step of a login when two-factor
+	// authentication is enabled; only accepted by the second login step.
+	TokenTypeTwoFactorChallenge = "2fa_challenge"
+	// Personal API tokens are opaque and never JWTs; the type only shows up
+	// on the Principal.
+	TokenTypeAPIToken = "api_token"
+)
+
+// Claims are the claims of every JWT we issue.
+type Claims struct {
+	jwt.RegisteredClaims
+	UserID    uint   `json:"userId"`
+	Username  string `json:"username,omitempty"`
+	Type      string `json:"type"`
+	SessionID string `json:"sid,omitempty"`
+}
+
 func GenerateToken(username string, userId uint) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": username,
-		"userId":   userId,
-		"exp":      time.Now().Add(config.AppConfig.JWT.Expiry).Unix(),
-	})
-	return token.SignedString([]byte(config.AppConfig.JWT.Secret))
+	sessionID, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	return signToken(newClaims(userId, TokenTypeAccess, config.AppConfig.JWT.Expiry, func(c *Claims) {
+		c.Username = username
+		c.SessionID = sessionID
+	}))
+}
+
+// GenerateChallengeToken wraps a stored login challenge, whose ID goes in
+// the jti claim.
+func GenerateChallengeToken(userId uint, challengeID string) (string, error) {
+	return signToken(newClaims(userId, TokenTypeTwoFactorChallenge, config.AppConfig.JWT.ChallengeExpiry, func(c *Claims) {
+		c.ID = challengeID
+	}))
+}
+
+// VerifyToken validates an access token and returns its caller.
+func VerifyToken(token string) (*Principal, error) {
+	claims, err := parseToken(token, TokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		UserID:    claims.UserID,
+		SessionID: claims.SessionID,
+		TokenType: claims.Type,
+		IssuedAt:  claims.IssuedAt.Time,
+	}, nil
+}
+
+// VerifyChallengeToken returns the user and challenge ID of a challenge
+// token.
+func VerifyChallengeToken(token string) (uint, string, error) {
+	claims, err := parseToken(token, TokenTypeTwoFactorChallenge)
+	if err != nil {
+		return 0, "", err
+	}
+	if claims.ID == "" {
+		return 0, "", errors.New("invalid token claims")
+	}
+	return claims.UserID, claims.ID, nil
 }
 
-func VerifyToken(token string) (uint, error) {
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (any, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+func newClaims(userId uint, tokenType string, expiry time.Duration, customize func(*Claims)) *Claims {
+	now := time.Now()
+
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.AppConfig.JWT.Issuer,
+			Audience:  jwt.ClaimStrings{config.AppConfig.JWT.Audience},
+			Subject:   strconv.FormatUint(uint64(userId), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+		},
+		UserID: userId,
+		Type:   tokenType,
+	}
+	if customize != nil {
+		customize(claims)
+	}
+	return claims
+}
+
+// signToken signs with the shared secret in HS256 mode and otherwise with
+// the current key from the keyring, identified by its kid.
+func signToken(claims *Claims) (string, error) {
+	if config.AppConfig.JWT.Algorithm == AlgorithmHS256 {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(config.AppConfig.JWT.Secret))
+	}
+
+	key, err := currentSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// parseToken verifies the signature, expiry, issuer and audience and that
+// the token is of the expected type.
+func parseToken(token string, tokenType string) (*Claims, error) {
+	var claims Claims
+
+	parsedToken, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (any, error) {
+		if config.AppConfig.JWT.Algorithm == AlgorithmHS256 {
+			_, ok := token.Method.(*jwt.SigningMethodHMAC)
+			if !ok {
+				return nil, errors.New("unexpected signing method")
+			}
+			return []byte(config.AppConfig.JWT.Secret), nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, ok := lookupSigningKey(kid)
 		if !ok {
+			return nil, errors.New("unknown signing key")
+		}
+		if token.Method.Alg() != key.Algorithm {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(config.AppConfig.JWT.Secret), nil
-	})
+		return key.Private.Public(), nil
+	},
+		jwt.WithIssuer(config.AppConfig.JWT.Issuer),
+		jwt.WithAudience(config.AppConfig.JWT.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 
 	if err != nil {
-		return 0, errors.New("token is expired or invalid")
+		return nil, errors.New("token is expired or invalid")
 	}
 
-	isValid := parsedToken.Valid
-
-	if !isValid {
-		return 0, errors.New("invalid token")
+	if !parsedToken.Valid {
+		return nil, errors.New("invalid token")
 	}
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
 
-	if !ok {
-		return 0, errors.New("invalid token claims")
+	if claims.Type != tokenType {
+		return nil, errors.New("invalid token type")
+	}
+	if claims.UserID == 0 || claims.IssuedAt == nil {
+		return nil, errors.New("invalid token claims")
 	}
 
-	// email, _ := claims["email"].(string)
-	userId := uint(claims["userId"].(float64))
-
-	return userId, nil
+	return &claims, nil
 }
@@ -0,0 +1,22 @@
+package utils
+
+import "time"
+
+// Principal is the authenticated caller of a request. It carries no
+// username, since that can change while a token is valid; load the user
+// when it is needed.
+type Principal struct {
+	UserID uint
+	// SessionID identifies the login (the JWT "sid" claim) or the API token.
+	SessionID string
+	// Scopes limits what API tokens may do. Login sessions have full access.
+	Scopes    []string
+	TokenType string
+	IssuedAt  time.Time
+}
+
+// IsSession reports whether the caller logged in interactively rather than
+// using a personal API token.
+func (p *Principal) IsSession() bool {
+	return p.TokenType == TokenTypeAccess
+}
@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// SigningKey is an asymmetric key used to sign and verify our JWTs.
+type SigningKey struct {
+	ID          string
+	Algorithm   string
+	Private     crypto.Signer
+	ActivatesAt time.Time
+}
+
+// JSONWebKey is the public part of a signing key as published in the JWKS.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+var keyring struct {
+	mu   sync.RWMutex
+	keys map[string]SigningKey
+}
+
+// GenerateSigningKey creates a new key and returns its ID and the private
+// key as PKCS#8 PEM.
+func GenerateSigningKey(algorithm string) (string, string, error) {
+	var private any
+	var err error
+
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", "", fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", "", err
+	}
+
+	kid, err := GenerateRandomToken(8)
+	if err != nil {
+		return "", "", err
+	}
+
+	return kid, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+func ParseSigningKey(kid, algorithm, privatePEM string, activatesAt time.Time) (SigningKey, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return SigningKey{}, errors.New("invalid PEM for signing key " + kid)
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return SigningKey{}, errors.New("unsupported private key for signing key " + kid)
+	}
+
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != AlgorithmRS256 {
+			return SigningKey{}, fmt.Errorf("signing key %s is RSA but marked %s", kid, algorithm)
+		}
+	case ed25519.PrivateKey:
+		if algorithm != AlgorithmEdDSA {
+			return SigningKey{}, fmt.Errorf("signing key %s is Ed25519 but marked %s", kid, algorithm)
+		}
+	default:
+		return SigningKey{}, errors.New("unsupported private key for signing key " + kid)
+	}
+
+	return SigningKey{ID: kid, Algorithm: algorithm, Private: signer, ActivatesAt: activatesAt}, nil
+}
+
+// SetSigningKeys replaces the keyring. Keys that are not active yet are
+// published and accepted for verification but not used for signing.
+func SetSigningKeys(keys []SigningKey) {
+	byID := make(map[string]SigningKey, len(keys))
+	for _, k := range keys {
+		byID[k.ID] = k
+	}
+
+	keyring.mu.Lock()
+	keyring.keys = byID
+	keyring.mu.Unlock()
+}
+
+// currentSigningKey returns the most recently activated key.
+func currentSigningKey() (SigningKey, error) {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+
+	now := time.Now()
+	var current SigningKey
+	found := false
+	for _, k := range keyring.keys {
+		if k.ActivatesAt.After(now) {
+			continue
+		}
+		if !found || k.ActivatesAt.After(current.ActivatesAt) {
+			current = k
+			found = true
+		}
+	}
+
+	if !found {
+		return SigningKey{}, errors.New("no active signing key")
+	}
+	return current, nil
+}
+
+func lookupSigningKey(kid string) (SigningKey, bool) {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+
+	k, ok := keyring.keys[kid]
+	return k, ok
+}
+
+// PublicJWKS returns the public keys of every key in the keyring.
+func PublicJWKS() []JSONWebKey {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+
+	jwks := make([]JSONWebKey, 0, len(keyring.keys))
+	for _, k := range keyring.keys {
+		jwk := JSONWebKey{Kid: k.ID, Use: "sig", Alg: k.Algorithm}
+
+		switch pub := k.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		jwks = append(jwks, jwk)
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
+
+func signingMethod(algorithm string) jwt.SigningMethod {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodHS256
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	UsernameMinLength = 3
+	UsernameMaxLength = 20
+	PasswordMinLength = 8
+	PasswordMaxLength = 72 // bcrypt ignores everything past 72 bytes
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Names that would be confusing in chat and stats, e.g. "You" is used as the
+// current user's label in the daily score graph.
+var reservedUsernames = map[string]bool{
+	"you":       true,
+	"me":        true,
+	"system":    true,
+	"admin":     true,
+	"root":      true,
+	"klubranks": true,
+	"deleted":   true,
+}
+
+func ValidateUsername(username string) error {
+	if len(username) < UsernameMinLength || len(username) > UsernameMaxLength {
+		return fmt.Errorf("must be between %d and %d characters", UsernameMinLength, UsernameMaxLength)
+	}
+	if !usernamePattern.MatchString(username) {
+		return errors.New("may only contain letters, digits, '_', '.' and '-' and must start with a letter or digit")
+	}
+	// "deleted_<id>" is used for anonymized accounts
+	if lower := strings.ToLower(username); reservedUsernames[lower] || strings.HasPrefix(lower, "deleted_") {
+		return errors.New("is reserved")
+	}
+	return nil
+}
+
+func ValidatePassword(password string) error {
+	if len(password) < PasswordMinLength || len(password) > PasswordMaxLength {
+		return fmt.Errorf("must be between %d and %d characters", PasswordMinLength, PasswordMaxLength)
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsSpace(r):
+			return errors.New("must not contain whitespace")
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("must contain at least one letter and one digit")
+	}
+	return nil
+}